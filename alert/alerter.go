@@ -0,0 +1,208 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/FidelityInternational/cf-loupe/applist"
+)
+
+const (
+	defaultDedupWindow = 24 * time.Hour
+	queueSize          = 100
+)
+
+// Options configures the webhook alerts
+type Options struct {
+	Channels []Channel
+	// DedupWindow is how long to wait before alerting about the same app or
+	// foundation again
+	DedupWindow time.Duration
+}
+
+// Enabled returns true if there is any channel to alert
+func (options Options) Enabled() bool {
+	return len(options.Channels) > 0
+}
+
+// ParseChannels parses a JSON list of channels
+func ParseChannels(channelsJSON string) ([]Channel, error) {
+	channels := []Channel{}
+	if err := json.Unmarshal([]byte(channelsJSON), &channels); err != nil {
+		return nil, err
+	}
+	for _, channel := range channels {
+		if err := channel.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return channels, nil
+}
+
+// Alerter compares each scrape with the previous one and posts the hygiene
+// regressions to the matching channels in the background
+type Alerter struct {
+	channels    []Channel
+	dedupWindow time.Duration
+	httpClient  *http.Client
+	timeNow     func() time.Time
+	queue       chan []Event
+
+	mutex sync.Mutex
+	// violations maps foundation to the keys of the events of its last scrape
+	violations map[string]map[string]bool
+	// lastSent maps event key to when it was last sent, within the
+	// de-duplication window
+	lastSent map[string]time.Time
+}
+
+// NewAlerter returns an alerter posting to the configured channels. Run must
+// be called to post the alerts.
+func NewAlerter(options Options, timeNow func() time.Time) *Alerter {
+	dedupWindow := options.DedupWindow
+	if dedupWindow <= 0 {
+		dedupWindow = defaultDedupWindow
+	}
+
+	return &Alerter{
+		channels:    options.Channels,
+		dedupWindow: dedupWindow,
+		httpClient:  &http.Client{Timeout: 10 * time.Second},
+		timeNow:     timeNow,
+		violations:  map[string]map[string]bool{},
+		lastSent:    map[string]time.Time{},
+		queue:       make(chan []Event, queueSize),
+	}
+}
+
+// Observe queues the regressions since the previous scrape and returns them.
+// The first scrape of a foundation is only recorded, so existing problems do
+// not all alert at start up.
+func (alerter *Alerter) Observe(appData applist.AppData, scrapeErr error) []Event {
+	alerter.mutex.Lock()
+	events := []Event{}
+	if scrapeErr != nil {
+		event := Event{Kind: KindScrapeFailed, Error: scrapeErr.Error()}
+		var foundationErr applist.FoundationError
+		if errors.As(scrapeErr, &foundationErr) {
+			event.Foundation = foundationErr.Foundation
+			event.Error = foundationErr.Err.Error()
+		}
+		events = append(events, event)
+	} else {
+		events = alerter.regressions(appData.Apps)
+	}
+
+	now := alerter.timeNow()
+	for key, lastSent := range alerter.lastSent {
+		if now.Sub(lastSent) >= alerter.dedupWindow {
+			delete(alerter.lastSent, key)
+		}
+	}
+	sent := []Event{}
+	for _, event := range events {
+		if _, ok := alerter.lastSent[event.key()]; ok {
+			continue
+		}
+		alerter.lastSent[event.key()] = now
+		sent = append(sent, event)
+	}
+	alerter.mutex.Unlock()
+
+	if len(sent) == 0 {
+		return sent
+	}
+	select {
+	case alerter.queue <- sent:
+	default:
+		log.Printf("dropped %d alerts as the alert queue is full\n", len(sent))
+	}
+	return sent
+}
+
+// Run posts the queued alerts until ctx is done
+func (alerter *Alerter) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case events := <-alerter.queue:
+			alerter.dispatch(events)
+		}
+	}
+}
+
+// regressions returns the violations that were not in the previous scrape of
+// each foundation, and records the current ones
+func (alerter *Alerter) regressions(apps []applist.App) []Event {
+	current := map[string][]Event{}
+	for _, app := range apps {
+		if _, ok := current[app.Foundation]; !ok {
+			current[app.Foundation] = []Event{}
+		}
+		if app.Buildpack.IsDeprecated {
+			current[app.Foundation] = append(current[app.Foundation], Event{
+				Kind:       KindDeprecated,
+				Foundation: app.Foundation,
+				Org:        app.Org,
+				Space:      app.Space,
+				App:        app.Name,
+				Buildpack:  fmt.Sprintf("%s %s", app.Buildpack.Name, app.Buildpack.Version),
+			})
+		}
+		if app.IsStale {
+			current[app.Foundation] = append(current[app.Foundation], Event{
+				Kind:       KindStale,
+				Foundation: app.Foundation,
+				Org:        app.Org,
+				Space:      app.Space,
+				App:        app.Name,
+				UpdatedAt:  app.UpdatedAt,
+			})
+		}
+	}
+
+	regressions := []Event{}
+	for foundation, events := range current {
+		previous, seen := alerter.violations[foundation]
+		keys := map[string]bool{}
+		for _, event := range events {
+			keys[event.key()] = true
+			if seen && !previous[event.key()] {
+				regressions = append(regressions, event)
+			}
+		}
+		alerter.violations[foundation] = keys
+	}
+	sort.Slice(regressions, func(i, j int) bool {
+		return regressions[i].key() < regressions[j].key()
+	})
+
+	return regressions
+}
+
+// dispatch posts the events of a scrape to each channel matching any of
+// them, in one message per channel
+func (alerter *Alerter) dispatch(events []Event) {
+	for _, channel := range alerter.channels {
+		matching := []Event{}
+		for _, event := range events {
+			if channel.matches(event) {
+				matching = append(matching, event)
+			}
+		}
+		if len(matching) == 0 {
+			continue
+		}
+		if err := channel.send(alerter.httpClient, matching); err != nil {
+			log.Printf("could not alert %s: %s\n", channel.Name, err)
+		}
+	}
+}
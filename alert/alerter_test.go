@@ -0,0 +1,156 @@
+package alert_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	. "github.com/FidelityInternational/cf-loupe/alert"
+	"github.com/FidelityInternational/cf-loupe/applist"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type received struct {
+	path string
+	body map[string]interface{}
+}
+
+var _ = Describe("Alerter", func() {
+	var webhookServer *httptest.Server
+	var mutex sync.Mutex
+	var posts []received
+	var release chan struct{}
+	var now time.Time
+	var alerter *Alerter
+	var apps []applist.App
+
+	BeforeEach(func() {
+		posts = []received{}
+		release = make(chan struct{})
+		close(release)
+		webhookServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+			bytes, _ := ioutil.ReadAll(r.Body)
+			body := map[string]interface{}{}
+			json.Unmarshal(bytes, &body)
+			mutex.Lock()
+			posts = append(posts, received{path: r.URL.Path, body: body})
+			mutex.Unlock()
+		}))
+
+		now, _ = time.Parse(time.RFC3339, "2017-08-15T15:00:06Z")
+		channels, err := ParseChannels(`[
+			{"name": "all", "type": "slack", "url": "` + webhookServer.URL + `/slack"},
+			{"name": "prod", "type": "teams", "url": "` + webhookServer.URL + `/teams", "foundations": ["prod"]},
+			{"name": "project-x", "type": "webhook", "url": "` + webhookServer.URL + `/webhook", "orgs": ["project-x"], "template": "{{.Kind}}: {{.App}}"}
+		]`)
+		Expect(err).To(Succeed())
+
+		alerter = NewAlerter(Options{Channels: channels, DedupWindow: time.Hour}, func() time.Time { return now })
+		go alerter.Run(context.Background())
+
+		apps = []applist.App{
+			{Name: "app1", Foundation: "dev", Org: "project-x", Space: "dev"},
+			{Name: "app2", Foundation: "prod", Org: "project-y", Space: "prod"},
+		}
+	})
+
+	AfterEach(func() {
+		webhookServer.Close()
+	})
+
+	receivedPosts := func() []received {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return posts
+	}
+
+	It("does not alert about the problems found by the first scrape", func() {
+		apps[0].IsStale = true
+		Expect(alerter.Observe(applist.AppData{Apps: apps}, nil)).To(BeEmpty())
+		Consistently(receivedPosts, 50*time.Millisecond).Should(BeEmpty())
+	})
+
+	It("alerts the matching channels about new problems, once per channel per scrape", func() {
+		alerter.Observe(applist.AppData{Apps: apps}, nil)
+
+		apps[0].Buildpack = applist.Buildpack{Name: "java_buildpack", Version: "v1.19", IsDeprecated: true}
+		apps[1].IsStale = true
+		apps[1].UpdatedAt = "2017-07-01"
+		events := alerter.Observe(applist.AppData{Apps: apps}, nil)
+
+		Expect(events).To(HaveLen(2))
+		Expect(events[0].Kind).To(Equal(KindDeprecated))
+		Expect(events[0].App).To(Equal("app1"))
+		Expect(events[1].Kind).To(Equal(KindStale))
+		Expect(events[1].App).To(Equal("app2"))
+
+		Eventually(receivedPosts).Should(HaveLen(3))
+		posts := receivedPosts()
+		Expect(posts[0].path).To(Equal("/slack"))
+		Expect(posts[0].body["text"]).To(Equal("App app1 in dev / project-x / dev is now using a deprecated buildpack (java_buildpack v1.19)\n" +
+			"App app2 in prod / project-y / prod is now stale, it was last updated on 2017-07-01"))
+		Expect(posts[1].path).To(Equal("/teams"))
+		Expect(posts[1].body["@type"]).To(Equal("MessageCard"))
+		Expect(posts[1].body["text"]).To(Equal("App app2 in prod / project-y / prod is now stale, it was last updated on 2017-07-01"))
+		Expect(posts[2].path).To(Equal("/webhook"))
+		Expect(posts[2].body["Text"]).To(Equal("deprecated: app1"))
+		Expect(posts[2].body["Events"]).To(HaveLen(1))
+		Expect(posts[2].body["Events"].([]interface{})[0]).To(HaveKeyWithValue("Foundation", "dev"))
+	})
+
+	It("does not wait for the channels to respond", func() {
+		release = make(chan struct{})
+		defer close(release)
+		alerter.Observe(applist.AppData{Apps: apps}, nil)
+
+		apps[0].IsStale = true
+		done := make(chan []Event)
+		go func() {
+			done <- alerter.Observe(applist.AppData{Apps: apps}, nil)
+		}()
+		Eventually(done).Should(Receive(HaveLen(1)))
+	})
+
+	It("does not alert about the same app again within the de-duplication window", func() {
+		alerter.Observe(applist.AppData{Apps: apps}, nil)
+		apps[0].IsStale = true
+		Expect(alerter.Observe(applist.AppData{Apps: apps}, nil)).To(HaveLen(1))
+
+		apps[0].IsStale = false
+		alerter.Observe(applist.AppData{Apps: apps}, nil)
+		apps[0].IsStale = true
+		Expect(alerter.Observe(applist.AppData{Apps: apps}, nil)).To(BeEmpty())
+
+		now = now.Add(2 * time.Hour)
+		apps[0].IsStale = false
+		alerter.Observe(applist.AppData{Apps: apps}, nil)
+		apps[0].IsStale = true
+		Expect(alerter.Observe(applist.AppData{Apps: apps}, nil)).To(HaveLen(1))
+	})
+
+	It("alerts when a foundation fails to scrape", func() {
+		scrapeErr := applist.FoundationError{Foundation: "prod", Err: errors.New("The server is on fire!")}
+		events := alerter.Observe(applist.AppData{}, scrapeErr)
+
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].Kind).To(Equal(KindScrapeFailed))
+		Expect(events[0].Foundation).To(Equal("prod"))
+		Eventually(receivedPosts).Should(HaveLen(3))
+		Expect(receivedPosts()[0].body["text"]).To(Equal("Foundation prod could not be scraped: The server is on fire!"))
+
+		Expect(alerter.Observe(applist.AppData{}, scrapeErr)).To(BeEmpty())
+	})
+
+	It("rejects invalid channels", func() {
+		_, err := ParseChannels(`[{"name": "pager", "type": "pager", "url": "http://example.com"}]`)
+		Expect(err).To(MatchError(`alert channel "pager" has unknown type "pager"`))
+	})
+})
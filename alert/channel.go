@@ -0,0 +1,145 @@
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+)
+
+// Channel types
+const (
+	TypeSlack   = "slack"
+	TypeTeams   = "teams"
+	TypeWebhook = "webhook"
+)
+
+// Channel is an incoming webhook receiving the events of some foundations and orgs
+type Channel struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	URL  string `json:"url"`
+	// Foundations and Orgs restrict the events sent to the channel. An empty
+	// list matches everything.
+	Foundations []string `json:"foundations"`
+	Orgs        []string `json:"orgs"`
+	// Template renders the message text from an Event. The default is the
+	// event's Message.
+	Template string `json:"template"`
+}
+
+// validate checks the channel type and template
+func (channel Channel) validate() error {
+	switch channel.Type {
+	case TypeSlack, TypeTeams, TypeWebhook:
+	default:
+		return fmt.Errorf("alert channel %q has unknown type %q", channel.Name, channel.Type)
+	}
+	if channel.URL == "" {
+		return fmt.Errorf("alert channel %q has no url", channel.Name)
+	}
+	if _, err := channel.template(); err != nil {
+		return fmt.Errorf("alert channel %q has an invalid template: %s", channel.Name, err)
+	}
+	return nil
+}
+
+func (channel Channel) template() (*template.Template, error) {
+	text := channel.Template
+	if text == "" {
+		text = "{{.Message}}"
+	}
+	return template.New(channel.Name).Parse(text)
+}
+
+func (channel Channel) matches(event Event) bool {
+	return matchesAny(channel.Foundations, event.Foundation) && (event.Org == "" || matchesAny(channel.Orgs, event.Org))
+}
+
+func matchesAny(values []string, value string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// text renders the message text of each event, one per line
+func (channel Channel) text(events []Event) ([]string, error) {
+	templ, err := channel.template()
+	if err != nil {
+		return nil, err
+	}
+
+	lines := []string{}
+	for _, event := range events {
+		var text bytes.Buffer
+		if err = templ.Execute(&text, event); err != nil {
+			return nil, err
+		}
+		lines = append(lines, text.String())
+	}
+	return lines, nil
+}
+
+// payload returns the JSON body to post for the events of a scrape
+func (channel Channel) payload(events []Event) ([]byte, error) {
+	lines, err := channel.text(events)
+	if err != nil {
+		return nil, err
+	}
+	text := strings.Join(lines, "\n")
+
+	switch channel.Type {
+	case TypeSlack:
+		return json.Marshal(map[string]string{"text": text})
+	case TypeTeams:
+		summary := fmt.Sprintf("%d alerts", len(events))
+		if len(events) == 1 {
+			summary = events[0].Kind
+		}
+		return json.Marshal(map[string]string{
+			"@type":    "MessageCard",
+			"@context": "https://schema.org/extensions",
+			"summary":  summary,
+			"text":     text,
+		})
+	}
+
+	type textEvent struct {
+		Event
+		Text string
+	}
+	textEvents := []textEvent{}
+	for i, event := range events {
+		textEvents = append(textEvents, textEvent{event, lines[i]})
+	}
+	return json.Marshal(struct {
+		Events []textEvent
+		Text   string
+	}{textEvents, text})
+}
+
+func (channel Channel) send(httpClient *http.Client, events []Event) error {
+	body, err := channel.payload(events)
+	if err != nil {
+		return err
+	}
+
+	resp, err := httpClient.Post(channel.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("alert channel %q returned %s", channel.Name, resp.Status)
+	}
+	return nil
+}
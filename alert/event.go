@@ -0,0 +1,40 @@
+package alert
+
+import "fmt"
+
+// Kinds of hygiene regressions
+const (
+	KindDeprecated   = "deprecated"
+	KindStale        = "stale"
+	KindScrapeFailed = "scrape-failed"
+)
+
+// Event is a hygiene regression found by a scrape
+type Event struct {
+	Kind       string
+	Foundation string
+	Org        string `json:",omitempty"`
+	Space      string `json:",omitempty"`
+	App        string `json:",omitempty"`
+	Buildpack  string `json:",omitempty"`
+	UpdatedAt  string `json:",omitempty"`
+	Error      string `json:",omitempty"`
+}
+
+// key identifies the subject of an event for de-duplication
+func (event Event) key() string {
+	return fmt.Sprintf("%s/%s/%s/%s/%s", event.Kind, event.Foundation, event.Org, event.Space, event.App)
+}
+
+// Message describes the event in a sentence
+func (event Event) Message() string {
+	switch event.Kind {
+	case KindDeprecated:
+		return fmt.Sprintf("App %s in %s / %s / %s is now using a deprecated buildpack (%s)", event.App, event.Foundation, event.Org, event.Space, event.Buildpack)
+	case KindStale:
+		return fmt.Sprintf("App %s in %s / %s / %s is now stale, it was last updated on %s", event.App, event.Foundation, event.Org, event.Space, event.UpdatedAt)
+	case KindScrapeFailed:
+		return fmt.Sprintf("Foundation %s could not be scraped: %s", event.Foundation, event.Error)
+	}
+	return event.Kind
+}
@@ -15,10 +15,63 @@ import (
 
 const staleAppMinAge = time.Hour * 24 * 14 // two weeks
 const buildpackFreshnessCap = 1            // can be at most 1 version out of date
+const notApplicable = "Not applicable"
+const defaultInstanceWorkers = 10
+
+// App statuses, describing how far an app got through staging and starting
+const (
+	StatusStaged        = "staged"
+	StatusNeverPushed   = "never-pushed"
+	StatusStagingFailed = "staging-failed"
+	StatusPending       = "pending"
+	StatusCrashed       = "crashed"
+)
+
+// Options enables the optional, more expensive parts of a scrape
+type Options struct {
+	// InstanceHealth fetches the live state of each instance of every started app
+	InstanceHealth bool
+	// ResourceUsage fetches the CPU, memory and disk usage of every started app
+	ResourceUsage bool
+	// Routes fetches every route and the routes of every app
+	Routes bool
+	// Services fetches every service instance and binding
+	Services bool
+	// Metadata fetches the labels and annotations of every app, space and org
+	Metadata bool
+	// Capacity fetches every org and space quota and reports the memory
+	// allocated in each org and space against it
+	Capacity bool
+	// OwnerKeys are the label or annotation keys naming the owner of an app
+	OwnerKeys []string
+	// InstanceWorkers bounds the concurrent per app requests per foundation
+	InstanceWorkers int
+	// CapacityWarningPercent is the share of a memory quota above which an org
+	// or space is reported as near its limit
+	CapacityWarningPercent float64
+	// Telemetry records how each foundation was fetched, if set
+	Telemetry *Telemetry
+}
+
+func (options Options) instanceWorkers() int {
+	if options.InstanceWorkers <= 0 {
+		return defaultInstanceWorkers
+	}
+	return options.InstanceWorkers
+}
 
 type AppData struct {
 	Apps    []App
 	Summary Summary
+	// Capacity is nil unless capacity is being collected
+	Capacity *CapacityReport
+	// Routes is nil unless routes are being collected
+	Routes *RouteReport
+	// Services is nil unless services are being collected
+	Services *ServicesReport
+	// OrgNames maps foundation, then org GUID, to the name of the org. It is
+	// not served, and not kept by Filter.
+	OrgNames map[string]map[string]string `json:"-"`
 }
 
 // App contains app information and its buildpack
@@ -33,6 +86,38 @@ type App struct {
 	Instances  int
 	MemoryMB   int
 	State      string
+	Status     string
+
+	StagingFailedReason      string
+	StagingFailedDescription string
+
+	// Health is nil unless instance health is being collected and the app is started
+	Health *InstanceHealth
+	// Usage is nil unless resource usage is being collected and the app is started
+	Usage *ResourceUsage
+	// URLs is nil unless routes are being collected
+	URLs []string
+	// Services is nil unless services are being collected
+	Services []BoundService
+
+	// Labels and Annotations include those inherited from the app's space and
+	// org. They are nil unless metadata is being collected.
+	Labels      map[string]string
+	Annotations map[string]string
+	Owner       string
+}
+
+// InstanceHealth contains the live states of an app's instances
+type InstanceHealth struct {
+	Running    int
+	Crashed    int // includes instances that are down
+	Starting   int
+	IsDegraded bool // fewer instances are running than desired
+}
+
+// Key identifies an app across scrapes
+func (app App) Key() string {
+	return fmt.Sprintf("%s/%s/%s/%s", app.Foundation, app.Org, app.Space, app.Name)
 }
 
 // IsHappy returns true if the app is neither stale nor deprecated
@@ -52,60 +137,145 @@ type Buildpack struct {
 }
 
 type Summary struct {
-	TotalApps      int
-	StaleApps      int
-	DeprecatedApps int
+	TotalApps         int
+	StaleApps         int
+	DeprecatedApps    int
+	NeverPushedApps   int
+	StagingFailedApps int
+	PendingApps       int
+	CrashedApps       int
+	DegradedApps      int
+	UnownedApps       int // only counts apps whose metadata has been collected
 }
 
 // BuildAppData returns App Data
-func BuildAppData(cfClients map[string]cf.IClient, now time.Time) (AppData, error) {
-	allApps := []App{}
-
-	foundations, err := getFoundationsAsync(cfClients)
+func BuildAppData(cfClients map[string]cf.IClient, now time.Time, options Options) (AppData, error) {
+	foundations, err := getFoundationsAsync(cfClients, options)
 	if err != nil {
 		return AppData{}, err
 	}
 
+	return buildAppDataFromFoundations(foundations, now, options)
+}
+
+// buildAppDataFromFoundations builds the app data of foundations that have been fetched
+func buildAppDataFromFoundations(foundations map[string]Foundation, now time.Time, options Options) (AppData, error) {
+	allApps := []App{}
+	var capacity *CapacityReport
+	if options.Capacity {
+		capacity = &CapacityReport{
+			Orgs:   []OrgCapacity{},
+			Spaces: []SpaceCapacity{},
+		}
+	}
+	var routes *RouteReport
+	if options.Routes {
+		routes = &RouteReport{
+			OrphanedRoutes: []OrphanedRoute{},
+			UnroutedApps:   []UnroutedApp{},
+		}
+	}
+	var services *ServicesReport
+	if options.Services {
+		services = &ServicesReport{
+			Plans:            []ServicePlanUsage{},
+			UnboundInstances: []UnboundServiceInstance{},
+		}
+	}
+
+	orgNames := map[string]map[string]string{}
 	for foundationName, foundation := range foundations {
 		appsForFoundation, err := BuildAppList(foundation, now, foundationName)
 		if err != nil {
 			return AppData{}, err
 		}
+		orgNames[foundationName] = map[string]string{}
+		for orgGUID, org := range foundation.GoCFOrgs {
+			orgNames[foundationName][orgGUID] = org.Name
+		}
 
+		AssignOwners(appsForFoundation, options.ownerKeys())
 		allApps = append(allApps, appsForFoundation...)
+		if capacity != nil && foundation.GoCFOrgQuotas != nil {
+			capacity.merge(BuildCapacityReport(foundation, foundationName, options.capacityWarningPercent()))
+		}
+		if routes != nil {
+			routes.merge(BuildRouteReport(foundation, foundationName))
+		}
+		if services != nil {
+			services.merge(BuildServicesReport(foundation, foundationName))
+		}
 	}
 
 	summary := BuildSummary(allApps)
 
 	return AppData{
-		Apps:    allApps,
-		Summary: summary,
+		Apps:     allApps,
+		Summary:  summary,
+		Capacity: capacity,
+		Routes:   routes,
+		Services: services,
+		OrgNames: orgNames,
 	}, nil
 }
 
 // BuildSummary returns a new summary of an app list
 func BuildSummary(apps []App) Summary {
-	staleApps := 0
-	deprecatedApps := 0
+	summary := Summary{
+		TotalApps: len(apps),
+	}
 
 	for _, app := range apps {
 		if app.IsStale {
-			staleApps++
+			summary.StaleApps++
 		}
 		if app.Buildpack.IsDeprecated {
-			deprecatedApps++
+			summary.DeprecatedApps++
+		}
+
+		switch app.Status {
+		case StatusNeverPushed:
+			summary.NeverPushedApps++
+		case StatusStagingFailed:
+			summary.StagingFailedApps++
+		case StatusPending:
+			summary.PendingApps++
+		case StatusCrashed:
+			summary.CrashedApps++
+		}
+
+		if app.Health != nil && app.Health.IsDegraded {
+			summary.DegradedApps++
+		}
+		if app.Labels != nil && app.Owner == "" {
+			summary.UnownedApps++
 		}
 	}
 
-	return Summary{
-		TotalApps:      len(apps),
-		StaleApps:      staleApps,
-		DeprecatedApps: deprecatedApps,
+	return summary
+}
+
+// FilterByStatus returns the apps with the given status, or all apps if status is empty
+func FilterByStatus(apps []App, status string) []App {
+	if status == "" {
+		return apps
 	}
+
+	filteredApps := []App{}
+	for _, app := range apps {
+		if app.Status == status {
+			filteredApps = append(filteredApps, app)
+		}
+	}
+
+	return filteredApps
 }
 
 // SupportStatus is the inverse of deprecation status
 func (buildpack Buildpack) SupportStatus() string {
+	if buildpack.Version == notApplicable {
+		return "n/a"
+	}
 	if buildpack.Version == "" {
 		return "no"
 	}
@@ -122,6 +292,8 @@ func BuildAppList(foundation Foundation, now time.Time, foundationName string) (
 		return nil, err
 	}
 
+	servicesMap := appServices(foundation)
+
 	apps := []App{}
 	for _, cfClientApp := range foundation.GoCFApps {
 		if cfClientApp.UpdatedAt == "" {
@@ -136,11 +308,11 @@ func BuildAppList(foundation Foundation, now time.Time, foundationName string) (
 		var buildpack Buildpack
 		if buildpackGUID == "" {
 			if cfClientApp.Buildpack == "" {
+				// The app has never been staged, so there is no buildpack to judge;
+				// the reason is reported by its status instead
 				buildpack = Buildpack{
-					Name:         "Undetected - app unable to start",
-					Version:      "Not applicable",
-					Freshness:    99,
-					IsDeprecated: true,
+					Name:    "Undetected",
+					Version: notApplicable,
 				}
 			} else {
 				buildpack = Buildpack{
@@ -175,6 +347,13 @@ func BuildAppList(foundation Foundation, now time.Time, foundationName string) (
 		orgName := org.Name
 
 		isStale := now.Sub(updatedAt) >= staleAppMinAge
+		labels, annotations := inheritedMetadata(foundation, orgGUID, spaceGUID, cfClientApp.Guid)
+
+		status := appStatus(cfClientApp, appInstanceStates(foundation, cfClientApp.Guid))
+		var health *InstanceHealth
+		if appInstances, ok := foundation.GoCFAppInstances[cfClientApp.Guid]; ok {
+			health = buildInstanceHealth(appInstances, cfClientApp.Instances)
+		}
 
 		apps = append(apps, App{
 			Name:       cfClientApp.Name,
@@ -187,11 +366,95 @@ func BuildAppList(foundation Foundation, now time.Time, foundationName string) (
 			Instances:  cfClientApp.Instances,
 			MemoryMB:   cfClientApp.Memory,
 			State:      strings.ToLower(cfClientApp.State),
+			Status:     status,
+
+			StagingFailedReason:      cfClientApp.StagingFailedReason,
+			StagingFailedDescription: cfClientApp.StagingFailedDescription,
+
+			Health: health,
+			Usage:  buildResourceUsage(foundation.GoCFAppStats[cfClientApp.Guid]),
+			URLs:   appURLs(foundation, cfClientApp.Guid),
+
+			Services: boundServices(servicesMap, cfClientApp.Guid),
+
+			Labels:      labels,
+			Annotations: annotations,
 		})
 	}
 	return apps, nil
 }
 
+func buildInstanceHealth(appInstances map[string]gocf.AppInstance, desiredInstances int) *InstanceHealth {
+	health := InstanceHealth{}
+
+	for _, appInstance := range appInstances {
+		switch strings.ToUpper(appInstance.State) {
+		case "RUNNING":
+			health.Running++
+		case "STARTING":
+			health.Starting++
+		case "CRASHED", "DOWN":
+			health.Crashed++
+		}
+	}
+	health.IsDegraded = health.Running < desiredInstances
+
+	return &health
+}
+
+// appStatus classifies an app by its package state. A package that was never
+// uploaded is still PENDING, so the package upload time tells it apart from an
+// app that is waiting to be staged. A started app whose instances have been
+// collected is crashed if none of them are running and some have crashed.
+func appStatus(cfClientApp gocf.App, instanceStates []string) string {
+	switch strings.ToUpper(cfClientApp.PackageState) {
+	case "FAILED":
+		return StatusStagingFailed
+	case "PENDING":
+		if cfClientApp.PackageUpdatedAt == "" {
+			return StatusNeverPushed
+		}
+		return StatusPending
+	}
+
+	if strings.ToUpper(cfClientApp.State) == "STARTED" && isCrashed(instanceStates) {
+		return StatusCrashed
+	}
+	return StatusStaged
+}
+
+// appInstanceStates returns the states of an app's instances, from its
+// instances if instance health is being collected or else from its stats. It
+// is empty if neither is.
+func appInstanceStates(foundation Foundation, appGUID string) []string {
+	states := []string{}
+	if appInstances, ok := foundation.GoCFAppInstances[appGUID]; ok {
+		for _, appInstance := range appInstances {
+			states = append(states, appInstance.State)
+		}
+		return states
+	}
+	for _, appStats := range foundation.GoCFAppStats[appGUID] {
+		states = append(states, appStats.State)
+	}
+	return states
+}
+
+// isCrashed returns true if no instance is running and at least one has
+// crashed or is down
+func isCrashed(instanceStates []string) bool {
+	crashed := false
+	for _, state := range instanceStates {
+		switch strings.ToUpper(state) {
+		case "RUNNING":
+			return false
+		case "CRASHED", "DOWN":
+			crashed = true
+		}
+	}
+	return crashed
+}
+
 func generateBuildpacks(gocfbuildpacksMap map[string]gocf.Buildpack) (map[string]Buildpack, error) {
 	buildpacksMap := map[string]Buildpack{}
 
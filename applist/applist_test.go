@@ -36,7 +36,7 @@ var _ = Describe("Build", func() {
 			{Name: "app-php_buildpack", DetectedBuildpackGuid: "guid-21", UpdatedAt: "2017-08-21T12:00:00Z", SpaceGuid: "def456", Instances: 1, Memory: 512, State: "stopped"},
 			{Name: "app-binary_buildpack", DetectedBuildpackGuid: "guid-22", UpdatedAt: "2017-08-22T12:00:00Z", SpaceGuid: "def456", Instances: 1, Memory: 512, State: "stopped"},
 			{Name: "app-dotnet", DetectedBuildpackGuid: "guid-23", UpdatedAt: "2017-08-23T12:00:00Z", SpaceGuid: "def456", Instances: 1, Memory: 512, State: "stopped"},
-			{Name: "app-no-buildpack", DetectedBuildpackGuid: "", UpdatedAt: "2017-08-23T12:00:00Z", SpaceGuid: "def456", Instances: 1, Memory: 512, State: "stopped"},
+			{Name: "app-no-buildpack", DetectedBuildpackGuid: "", UpdatedAt: "2017-08-23T12:00:00Z", SpaceGuid: "def456", Instances: 1, Memory: 512, State: "stopped", PackageState: "PENDING"},
 			{Name: "app-java-v4", DetectedBuildpackGuid: "guid-24", UpdatedAt: "2017-08-24T12:00:00Z", SpaceGuid: "def456", Instances: 1, Memory: 512, State: "stopped"},
 			{Name: "app-java-another-v4", DetectedBuildpackGuid: "guid-25", UpdatedAt: "2017-08-25T12:00:00Z", SpaceGuid: "def456", Instances: 1, Memory: 512, State: "stopped"},
 			{Name: "rg-app-java-v3", DetectedBuildpackGuid: "guid-26", UpdatedAt: "2017-08-26T12:00:00Z", SpaceGuid: "def456", Instances: 1, Memory: 512, State: "stopped"},
@@ -119,7 +119,8 @@ var _ = Describe("Build", func() {
 		Expect(appList[20].Buildpack).To(Equal(Buildpack{Name: "php", Version: "4.3.33", Freshness: 0, IsDeprecated: false}))
 		Expect(appList[21].Buildpack).To(Equal(Buildpack{Name: "binary", Version: "1.0.13", Freshness: 0, IsDeprecated: false}))
 		Expect(appList[22].Buildpack).To(Equal(Buildpack{Name: "dotnet-core", Version: "1.0.18", Freshness: 0, IsDeprecated: false}))
-		Expect(appList[23].Buildpack).To(Equal(Buildpack{Name: "Undetected - app unable to start", Version: "Not applicable", Freshness: 99, IsDeprecated: true}))
+		Expect(appList[23].Buildpack).To(Equal(Buildpack{Name: "Undetected", Version: "Not applicable", Freshness: 0, IsDeprecated: false}))
+		Expect(appList[23].Status).To(Equal(StatusNeverPushed))
 		Expect(appList[24].Buildpack).To(Equal(Buildpack{Name: "java", Version: "4.6", Freshness: 1, IsDeprecated: false}))
 		Expect(appList[25].Buildpack).To(Equal(Buildpack{Name: "java", Version: "4.7.1", Freshness: 0, IsDeprecated: false}))
 		Expect(appList[26].Buildpack).To(Equal(Buildpack{Name: "java", Version: "3.19", Freshness: 0, IsDeprecated: false}))
@@ -228,6 +229,138 @@ var _ = Describe("Build", func() {
 		})
 	})
 
+	Context("when apps have not been staged successfully", func() {
+		var foundation Foundation
+
+		BeforeEach(func() {
+			foundation = Foundation{
+				GoCFApps: []gocf.App{
+					{Name: "app-staged", UpdatedAt: "2017-08-12T16:41:45Z", DetectedBuildpackGuid: "def456", SpaceGuid: "def456", State: "STARTED", PackageState: "STAGED", PackageUpdatedAt: "2017-08-12T16:41:45Z"},
+					{Name: "app-never-pushed", UpdatedAt: "2017-08-12T16:41:45Z", SpaceGuid: "def456", State: "STOPPED", PackageState: "PENDING"},
+					{Name: "app-staging-failed", UpdatedAt: "2017-08-12T16:41:45Z", SpaceGuid: "def456", State: "STARTED", PackageState: "FAILED", PackageUpdatedAt: "2017-08-12T16:41:45Z", StagingFailedReason: "NoAppDetectedError", StagingFailedDescription: "An app was not successfully detected by any available buildpack"},
+					{Name: "app-pending", UpdatedAt: "2017-08-12T16:41:45Z", SpaceGuid: "def456", State: "STARTED", PackageState: "PENDING", PackageUpdatedAt: "2017-08-12T16:41:45Z"},
+					{Guid: "app-crashed-guid", Name: "app-crashed", UpdatedAt: "2017-08-12T16:41:45Z", SpaceGuid: "def456", State: "STARTED", PackageState: "STAGED", PackageUpdatedAt: "2017-08-12T16:41:45Z"},
+					{Name: "app-stopped", UpdatedAt: "2017-08-12T16:41:45Z", SpaceGuid: "def456", State: "STOPPED", PackageState: "STAGED", PackageUpdatedAt: "2017-08-12T16:41:45Z"},
+				},
+				GoCFAppStats: map[string]map[string]gocf.AppStats{
+					"app-crashed-guid": {"0": {State: "CRASHED"}},
+				},
+				GoCFBuildpacks: map[string]gocf.Buildpack{
+					"def456": {
+						Name:     "java_buildpack",
+						Filename: "java-buildpack-v1_19-fidelity-abc1234.zip",
+					},
+				},
+				GoCFOrgs: map[string]gocf.Org{
+					"abc123": {
+						Name: "APP1234-project-x",
+					},
+				},
+				GoCFSpaces: map[string]gocf.Space{
+					"def456": {
+						Name:             "DEV",
+						OrganizationGuid: "abc123",
+					},
+				},
+			}
+		})
+
+		It("classifies each app by status", func() {
+			currentTime, _ := time.Parse(time.RFC3339, "2017-08-24T12:00:00Z")
+			appList, err := BuildAppList(foundation, currentTime, "dev")
+			Expect(err).To(Succeed())
+			Expect(appList).To(HaveLen(6))
+			Expect(appList[0].Status).To(Equal(StatusStaged))
+			Expect(appList[1].Status).To(Equal(StatusNeverPushed))
+			Expect(appList[2].Status).To(Equal(StatusStagingFailed))
+			Expect(appList[2].StagingFailedReason).To(Equal("NoAppDetectedError"))
+			Expect(appList[2].StagingFailedDescription).To(Equal("An app was not successfully detected by any available buildpack"))
+			Expect(appList[3].Status).To(Equal(StatusPending))
+			Expect(appList[4].Status).To(Equal(StatusCrashed))
+			Expect(appList[5].Status).To(Equal(StatusStaged))
+		})
+
+		It("does not guess that a started app crashed without its instance states", func() {
+			foundation.GoCFAppStats = nil
+
+			currentTime, _ := time.Parse(time.RFC3339, "2017-08-24T12:00:00Z")
+			appList, err := BuildAppList(foundation, currentTime, "dev")
+			Expect(err).To(Succeed())
+			Expect(appList[4].Status).To(Equal(StatusStaged))
+		})
+
+		It("does not count unstaged apps as using a deprecated buildpack", func() {
+			currentTime, _ := time.Parse(time.RFC3339, "2017-08-24T12:00:00Z")
+			appList, err := BuildAppList(foundation, currentTime, "dev")
+			Expect(err).To(Succeed())
+
+			for _, app := range appList[1:5] {
+				Expect(app.Buildpack.IsDeprecated).To(BeFalse())
+				Expect(app.Buildpack.SupportStatus()).To(Equal("n/a"))
+			}
+
+			summary := BuildSummary(appList)
+			Expect(summary.TotalApps).To(Equal(6))
+			Expect(summary.DeprecatedApps).To(Equal(0))
+			Expect(summary.NeverPushedApps).To(Equal(1))
+			Expect(summary.StagingFailedApps).To(Equal(1))
+			Expect(summary.PendingApps).To(Equal(1))
+			Expect(summary.CrashedApps).To(Equal(1))
+		})
+
+		It("filters apps by status", func() {
+			currentTime, _ := time.Parse(time.RFC3339, "2017-08-24T12:00:00Z")
+			appList, err := BuildAppList(foundation, currentTime, "dev")
+			Expect(err).To(Succeed())
+
+			filtered := FilterByStatus(appList, StatusStagingFailed)
+			Expect(filtered).To(HaveLen(1))
+			Expect(filtered[0].Name).To(Equal("app-staging-failed"))
+
+			Expect(FilterByStatus(appList, "")).To(HaveLen(6))
+		})
+	})
+
+	Context("when instance health has been collected", func() {
+		It("reports the instance states and marks apps with no running instances as crashed", func() {
+			foundation := Foundation{
+				GoCFApps: []gocf.App{
+					{Guid: "app1-guid", Name: "app1", UpdatedAt: "2017-08-12T16:41:45Z", DetectedBuildpackGuid: "def456", SpaceGuid: "def456", Instances: 2, State: "STARTED", PackageState: "STAGED"},
+					{Guid: "app2-guid", Name: "app2", UpdatedAt: "2017-08-12T16:41:45Z", DetectedBuildpackGuid: "def456", SpaceGuid: "def456", Instances: 1, State: "STARTED", PackageState: "STAGED"},
+				},
+				GoCFBuildpacks: map[string]gocf.Buildpack{
+					"def456": {
+						Name:     "java_buildpack",
+						Filename: "java-buildpack-v1_19-fidelity-abc1234.zip",
+					},
+				},
+				GoCFOrgs: map[string]gocf.Org{
+					"abc123": {
+						Name: "APP1234-project-x",
+					},
+				},
+				GoCFSpaces: map[string]gocf.Space{
+					"def456": {
+						Name:             "DEV",
+						OrganizationGuid: "abc123",
+					},
+				},
+				GoCFAppInstances: map[string]map[string]gocf.AppInstance{
+					"app1-guid": {"0": {State: "RUNNING"}, "1": {State: "STARTING"}},
+					"app2-guid": {"0": {State: "DOWN"}},
+				},
+			}
+
+			currentTime, _ := time.Parse(time.RFC3339, "2017-08-24T12:00:00Z")
+			appList, err := BuildAppList(foundation, currentTime, "dev")
+			Expect(err).To(Succeed())
+			Expect(appList[0].Health).To(Equal(&InstanceHealth{Running: 1, Starting: 1, IsDegraded: true}))
+			Expect(appList[0].Status).To(Equal(StatusStaged))
+			Expect(appList[1].Health).To(Equal(&InstanceHealth{Crashed: 1, IsDegraded: true}))
+			Expect(appList[1].Status).To(Equal(StatusCrashed))
+		})
+	})
+
 	Context("when the buildpack can't be found", func() {
 		It("returns a meaningful error message", func() {
 			foundation := Foundation{
@@ -0,0 +1,161 @@
+package applist
+
+import (
+	"sort"
+	"strings"
+)
+
+// Unlimited is the memory limit of a quota that does not restrict memory,
+// or of a space without a space quota
+const Unlimited = -1
+
+const defaultCapacityWarningPercent = 80
+
+// CapacityReport contains the memory allocated in each org and space against its quota
+type CapacityReport struct {
+	Orgs   []OrgCapacity
+	Spaces []SpaceCapacity
+}
+
+// OrgCapacity contains the memory allocated in an org against its quota
+type OrgCapacity struct {
+	Foundation string
+	Org        string
+	Capacity
+}
+
+// SpaceCapacity contains the memory allocated in a space against its space quota
+type SpaceCapacity struct {
+	Foundation string
+	Org        string
+	Space      string
+	Capacity
+}
+
+// Capacity compares the memory allocated to started apps with a quota's memory limit
+type Capacity struct {
+	Quota             string
+	AllocatedMemoryMB int
+	MemoryLimitMB     int
+	UsedPercent       float64
+	IsNearLimit       bool
+}
+
+func (options Options) capacityWarningPercent() float64 {
+	if options.CapacityWarningPercent <= 0 {
+		return defaultCapacityWarningPercent
+	}
+	return options.CapacityWarningPercent
+}
+
+// BuildCapacityReport returns the memory allocated in every org and space of a
+// foundation against its quota. As with quota enforcement, only started apps
+// count towards the allocated memory.
+func BuildCapacityReport(foundation Foundation, foundationName string, warningPercent float64) CapacityReport {
+	orgAllocated := map[string]int{}
+	spaceAllocated := map[string]int{}
+
+	for _, cfClientApp := range foundation.GoCFApps {
+		if strings.ToUpper(cfClientApp.State) != "STARTED" {
+			continue
+		}
+		space, ok := foundation.GoCFSpaces[cfClientApp.SpaceGuid]
+		if !ok {
+			continue
+		}
+
+		allocated := cfClientApp.Memory * cfClientApp.Instances
+		spaceAllocated[cfClientApp.SpaceGuid] += allocated
+		orgAllocated[space.OrganizationGuid] += allocated
+	}
+
+	report := CapacityReport{
+		Orgs:   []OrgCapacity{},
+		Spaces: []SpaceCapacity{},
+	}
+
+	for orgGUID, org := range foundation.GoCFOrgs {
+		capacity := Capacity{
+			AllocatedMemoryMB: orgAllocated[orgGUID],
+			MemoryLimitMB:     Unlimited,
+		}
+		if orgQuota, ok := foundation.GoCFOrgQuotas[org.QuotaDefinitionGuid]; ok {
+			capacity.Quota = orgQuota.Name
+			capacity.MemoryLimitMB = orgQuota.MemoryLimit
+		}
+
+		report.Orgs = append(report.Orgs, OrgCapacity{
+			Foundation: foundationName,
+			Org:        org.Name,
+			Capacity:   capacity.withUsage(warningPercent),
+		})
+	}
+
+	for spaceGUID, space := range foundation.GoCFSpaces {
+		org, ok := foundation.GoCFOrgs[space.OrganizationGuid]
+		if !ok {
+			continue
+		}
+
+		capacity := Capacity{
+			AllocatedMemoryMB: spaceAllocated[spaceGUID],
+			MemoryLimitMB:     Unlimited,
+		}
+		if spaceQuota, ok := foundation.GoCFSpaceQuotas[space.QuotaDefinitionGuid]; ok {
+			capacity.Quota = spaceQuota.Name
+			capacity.MemoryLimitMB = spaceQuota.MemoryLimit
+		}
+
+		report.Spaces = append(report.Spaces, SpaceCapacity{
+			Foundation: foundationName,
+			Org:        org.Name,
+			Space:      space.Name,
+			Capacity:   capacity.withUsage(warningPercent),
+		})
+	}
+
+	report.sort()
+	return report
+}
+
+// merge adds the orgs and spaces of another report
+func (report *CapacityReport) merge(other CapacityReport) {
+	report.Orgs = append(report.Orgs, other.Orgs...)
+	report.Spaces = append(report.Spaces, other.Spaces...)
+	report.sort()
+}
+
+func (report *CapacityReport) sort() {
+	sort.Slice(report.Orgs, func(i, j int) bool {
+		a, b := report.Orgs[i], report.Orgs[j]
+		if a.Foundation != b.Foundation {
+			return a.Foundation < b.Foundation
+		}
+		return a.Org < b.Org
+	})
+	sort.Slice(report.Spaces, func(i, j int) bool {
+		a, b := report.Spaces[i], report.Spaces[j]
+		if a.Foundation != b.Foundation {
+			return a.Foundation < b.Foundation
+		}
+		if a.Org != b.Org {
+			return a.Org < b.Org
+		}
+		return a.Space < b.Space
+	})
+}
+
+func (capacity Capacity) withUsage(warningPercent float64) Capacity {
+	if capacity.MemoryLimitMB == Unlimited {
+		return capacity
+	}
+
+	if capacity.MemoryLimitMB == 0 {
+		capacity.IsNearLimit = capacity.AllocatedMemoryMB > 0
+		return capacity
+	}
+
+	capacity.UsedPercent = float64(capacity.AllocatedMemoryMB) / float64(capacity.MemoryLimitMB) * 100
+	capacity.IsNearLimit = capacity.UsedPercent >= warningPercent
+	return capacity
+}
@@ -0,0 +1,82 @@
+package applist_test
+
+import (
+	. "github.com/FidelityInternational/cf-loupe/applist"
+	gocf "github.com/cloudfoundry-community/go-cfclient"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("BuildCapacityReport", func() {
+	var foundation Foundation
+
+	BeforeEach(func() {
+		foundation = Foundation{
+			GoCFApps: []gocf.App{
+				{Name: "app1", SpaceGuid: "space1", Instances: 2, Memory: 1024, State: "STARTED"},
+				{Name: "app2", SpaceGuid: "space1", Instances: 1, Memory: 2048, State: "STARTED"},
+				{Name: "app3", SpaceGuid: "space2", Instances: 4, Memory: 512, State: "STARTED"},
+				{Name: "app4", SpaceGuid: "space2", Instances: 10, Memory: 1024, State: "STOPPED"},
+				{Name: "app5", SpaceGuid: "space3", Instances: 1, Memory: 128, State: "STARTED"},
+			},
+			GoCFOrgs: map[string]gocf.Org{
+				"org1": {Name: "project-x", QuotaDefinitionGuid: "small"},
+				"org2": {Name: "project-y", QuotaDefinitionGuid: "unknown"},
+			},
+			GoCFSpaces: map[string]gocf.Space{
+				"space1": {Name: "dev", OrganizationGuid: "org1", QuotaDefinitionGuid: "dev-quota"},
+				"space2": {Name: "test", OrganizationGuid: "org1"},
+				"space3": {Name: "dev", OrganizationGuid: "org2"},
+			},
+			GoCFOrgQuotas: map[string]gocf.OrgQuota{
+				"small": {Name: "small", MemoryLimit: 7000},
+			},
+			GoCFSpaceQuotas: map[string]gocf.SpaceQuota{
+				"dev-quota": {Name: "dev-quota", MemoryLimit: 8192},
+			},
+		}
+	})
+
+	It("sums the memory allocated to started apps in each org against its quota", func() {
+		report := BuildCapacityReport(foundation, "dev", 80)
+
+		Expect(report.Orgs).To(HaveLen(2))
+		Expect(report.Orgs[0]).To(Equal(OrgCapacity{
+			Foundation: "dev",
+			Org:        "project-x",
+			Capacity: Capacity{
+				Quota:             "small",
+				AllocatedMemoryMB: 6144,
+				MemoryLimitMB:     7000,
+				UsedPercent:       float64(6144) / 7000 * 100,
+				IsNearLimit:       true,
+			},
+		}))
+		Expect(report.Orgs[1].Org).To(Equal("project-y"))
+		Expect(report.Orgs[1].AllocatedMemoryMB).To(Equal(128))
+		Expect(report.Orgs[1].MemoryLimitMB).To(Equal(Unlimited))
+		Expect(report.Orgs[1].IsNearLimit).To(BeFalse())
+	})
+
+	It("sums the memory allocated to started apps in each space against its space quota", func() {
+		report := BuildCapacityReport(foundation, "dev", 80)
+
+		Expect(report.Spaces).To(HaveLen(3))
+		Expect(report.Spaces[0].Org).To(Equal("project-x"))
+		Expect(report.Spaces[0].Space).To(Equal("dev"))
+		Expect(report.Spaces[0].Quota).To(Equal("dev-quota"))
+		Expect(report.Spaces[0].AllocatedMemoryMB).To(Equal(4096))
+		Expect(report.Spaces[0].UsedPercent).To(Equal(50.0))
+		Expect(report.Spaces[0].IsNearLimit).To(BeFalse())
+		Expect(report.Spaces[1].Space).To(Equal("test"))
+		Expect(report.Spaces[1].AllocatedMemoryMB).To(Equal(2048))
+		Expect(report.Spaces[1].MemoryLimitMB).To(Equal(Unlimited))
+		Expect(report.Spaces[2].Org).To(Equal("project-y"))
+	})
+
+	It("uses the warning threshold", func() {
+		report := BuildCapacityReport(foundation, "dev", 40)
+		Expect(report.Spaces[0].IsNearLimit).To(BeTrue())
+	})
+})
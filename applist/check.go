@@ -0,0 +1,69 @@
+package applist
+
+import (
+	"fmt"
+)
+
+// AppQuery identifies a single app
+type AppQuery struct {
+	Foundation string
+	Org        string
+	Space      string
+	App        string
+}
+
+// Validate returns an error if any part of the query is missing
+func (query AppQuery) Validate() error {
+	if query.Foundation == "" || query.Org == "" || query.Space == "" || query.App == "" {
+		return fmt.Errorf("foundation, org, space and app are required, got %q", query.String())
+	}
+	return nil
+}
+
+func (query AppQuery) String() string {
+	return fmt.Sprintf("%s/%s/%s/%s", query.Foundation, query.Org, query.Space, query.App)
+}
+
+// CheckResult says whether an app meets the same rules the dashboard
+// highlights, and why not if it does not
+type CheckResult struct {
+	AppQuery
+	Found   bool
+	Pass    bool
+	Reasons []string
+}
+
+// CheckApp finds an app and checks that it is neither stale nor using a
+// deprecated buildpack
+func CheckApp(apps []App, query AppQuery) CheckResult {
+	result := CheckResult{
+		AppQuery: query,
+		Reasons:  []string{},
+	}
+
+	for _, app := range apps {
+		if app.Foundation != query.Foundation || app.Org != query.Org || app.Space != query.Space || app.Name != query.App {
+			continue
+		}
+
+		result.Found = true
+		if app.IsStale {
+			result.Reasons = append(result.Reasons, fmt.Sprintf("app was last updated on %s, more than %d days ago", app.UpdatedAt, int(staleAppMinAge.Hours()/24)))
+		}
+		if app.Buildpack.IsDeprecated {
+			result.Reasons = append(result.Reasons, deprecationReason(app.Buildpack))
+		}
+		result.Pass = len(result.Reasons) == 0
+		return result
+	}
+
+	result.Reasons = append(result.Reasons, "app not found")
+	return result
+}
+
+func deprecationReason(buildpack Buildpack) string {
+	if buildpack.Version == "" || buildpack.Version == notApplicable {
+		return fmt.Sprintf("buildpack %s is not supported", buildpack.Name)
+	}
+	return fmt.Sprintf("buildpack %s %s is out of support, %d versions behind the latest", buildpack.Name, buildpack.Version, buildpack.Freshness)
+}
@@ -0,0 +1,67 @@
+package applist_test
+
+import (
+	. "github.com/FidelityInternational/cf-loupe/applist"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CheckApp", func() {
+	var apps []App
+
+	BeforeEach(func() {
+		apps = []App{
+			{
+				Name: "fresh", Foundation: "dev", Org: "project-x", Space: "test", UpdatedAt: "2017-08-12",
+				Buildpack: Buildpack{Name: "ruby_buildpack", Version: "2.0.2"},
+			},
+			{
+				Name: "old", Foundation: "dev", Org: "project-x", Space: "test", UpdatedAt: "2016-07-19", IsStale: true,
+				Buildpack: Buildpack{Name: "ruby_buildpack", Version: "2.0.0", Freshness: 2, IsDeprecated: true},
+			},
+			{
+				Name: "custom", Foundation: "dev", Org: "project-x", Space: "test", UpdatedAt: "2017-08-12",
+				Buildpack: Buildpack{Name: "https://github.com/cloudfoundry/staticfile-buildpack", IsDeprecated: true},
+			},
+		}
+	})
+
+	It("passes an app that is neither stale nor deprecated", func() {
+		result := CheckApp(apps, AppQuery{Foundation: "dev", Org: "project-x", Space: "test", App: "fresh"})
+
+		Expect(result.Found).To(BeTrue())
+		Expect(result.Pass).To(BeTrue())
+		Expect(result.Reasons).To(BeEmpty())
+	})
+
+	It("fails a stale app with a deprecated buildpack, giving both reasons", func() {
+		result := CheckApp(apps, AppQuery{Foundation: "dev", Org: "project-x", Space: "test", App: "old"})
+
+		Expect(result.Pass).To(BeFalse())
+		Expect(result.Reasons).To(Equal([]string{
+			"app was last updated on 2016-07-19, more than 14 days ago",
+			"buildpack ruby_buildpack 2.0.0 is out of support, 2 versions behind the latest",
+		}))
+	})
+
+	It("fails an app using a buildpack whose version is unknown", func() {
+		result := CheckApp(apps, AppQuery{Foundation: "dev", Org: "project-x", Space: "test", App: "custom"})
+
+		Expect(result.Pass).To(BeFalse())
+		Expect(result.Reasons).To(Equal([]string{"buildpack https://github.com/cloudfoundry/staticfile-buildpack is not supported"}))
+	})
+
+	It("fails an app that cannot be found", func() {
+		result := CheckApp(apps, AppQuery{Foundation: "prod", Org: "project-x", Space: "test", App: "fresh"})
+
+		Expect(result.Found).To(BeFalse())
+		Expect(result.Pass).To(BeFalse())
+		Expect(result.Reasons).To(Equal([]string{"app not found"}))
+	})
+
+	It("requires every part of the query", func() {
+		err := AppQuery{Foundation: "dev", App: "fresh"}.Validate()
+		Expect(err).To(MatchError(`foundation, org, space and app are required, got "dev///fresh"`))
+	})
+})
@@ -1,6 +1,12 @@
 package applist
 
 import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
 	"github.com/FidelityInternational/cf-loupe/cf"
 	gocf "github.com/cloudfoundry-community/go-cfclient"
 )
@@ -10,6 +16,48 @@ type Foundation struct {
 	GoCFBuildpacks map[string]gocf.Buildpack
 	GoCFOrgs       map[string]gocf.Org
 	GoCFSpaces     map[string]gocf.Space
+
+	// GoCFOrgQuotas and GoCFSpaceQuotas are nil when capacity is not being
+	// collected or the quotas could not be fetched
+	GoCFOrgQuotas   map[string]gocf.OrgQuota
+	GoCFSpaceQuotas map[string]gocf.SpaceQuota
+
+	// GoCFAppInstances maps app GUID to its instance states. It is nil when
+	// instance health is not being collected.
+	GoCFAppInstances map[string]map[string]gocf.AppInstance
+
+	// GoCFAppStats maps app GUID to its instance stats. It is nil when
+	// resource usage is not being collected.
+	GoCFAppStats map[string]map[string]gocf.AppStats
+
+	// GoCFRoutes, GoCFDomains and GoCFAppRoutes are nil when routes are not
+	// being collected. GoCFAppRoutes maps app GUID to its routes.
+	GoCFRoutes    map[string]gocf.Route
+	GoCFDomains   map[string]gocf.Domain
+	GoCFAppRoutes map[string][]gocf.Route
+
+	// The service fields are nil when services are not being collected
+	GoCFServiceInstances             map[string]gocf.ServiceInstance
+	GoCFUserProvidedServiceInstances map[string]gocf.UserProvidedServiceInstance
+	GoCFServiceBindings              map[string]gocf.ServiceBinding
+	GoCFServices                     map[string]gocf.Service
+	GoCFServicePlans                 map[string]gocf.ServicePlan
+
+	// The metadata fields map GUID to labels and annotations. They are nil
+	// when metadata is not being collected.
+	AppMetadata   map[string]cf.Metadata
+	SpaceMetadata map[string]cf.Metadata
+	OrgMetadata   map[string]cf.Metadata
+}
+
+// FoundationError is returned when a foundation could not be scraped
+type FoundationError struct {
+	Foundation string
+	Err        error
+}
+
+func (err FoundationError) Error() string {
+	return fmt.Sprintf("could not scrape %s: %s", err.Foundation, err.Err)
 }
 
 type cfClientAppsElement struct {
@@ -36,30 +84,84 @@ type spaceMapElement struct {
 	err        error
 }
 
-func getFoundationsAsync(cfClients map[string]cf.IClient) (map[string]Foundation, error) {
-	foundations := map[string]Foundation{}
+type quotasElement struct {
+	orgQuotaMap   map[string]gocf.OrgQuota
+	spaceQuotaMap map[string]gocf.SpaceQuota
+	foundation    string
+	err           error
+}
+
+type routesElement struct {
+	routeMap     map[string]gocf.Route
+	domainMap    map[string]gocf.Domain
+	appRoutesMap map[string][]gocf.Route
+	foundation   string
+	err          error
+}
+
+type servicesElement struct {
+	serviceInstanceMap             map[string]gocf.ServiceInstance
+	userProvidedServiceInstanceMap map[string]gocf.UserProvidedServiceInstance
+	serviceBindingMap              map[string]gocf.ServiceBinding
+	serviceMap                     map[string]gocf.Service
+	servicePlanMap                 map[string]gocf.ServicePlan
+	foundation                     string
+	err                            error
+}
+
+type metadataElement struct {
+	appMetadata   map[string]cf.Metadata
+	spaceMetadata map[string]cf.Metadata
+	orgMetadata   map[string]cf.Metadata
+	foundation    string
+	err           error
+}
+
+type appInstancesMapElement struct {
+	appInstancesMap map[string]map[string]gocf.AppInstance
+	foundation      string
+}
+
+type appStatsMapElement struct {
+	appStatsMap map[string]map[string]gocf.AppStats
+	foundation  string
+}
+
+func getFoundationsAsync(cfClients map[string]cf.IClient, options Options) (foundations map[string]Foundation, err error) {
+	start := time.Now()
+	// fetched is when the last part of each foundation was fetched
+	fetched := map[string]time.Time{}
+	authenticated := map[string]bool{}
+	defer func() {
+		recordFoundations(cfClients, options.Telemetry, start, fetched, authenticated, err)
+	}()
+
+	foundations = map[string]Foundation{}
 	for foundationName := range cfClients {
 		foundations[foundationName] = Foundation{}
 	}
 
+	// Every channel has room for an element from each foundation, so that the
+	// goroutines of the other foundations don't block forever when one fails.
+
 	// channel of app lists for each foundation
-	cfClientAppsChannel := make(chan cfClientAppsElement)
+	cfClientAppsChannel := make(chan cfClientAppsElement, len(cfClients))
 
 	// channel of buildpack maps for each foundation
-	buildpacksMapsChannel := make(chan buildpacksMapsElement)
+	buildpacksMapsChannel := make(chan buildpacksMapsElement, len(cfClients))
 
 	// channel of org maps for each foundation
-	orgMapChannel := make(chan orgMapElement)
+	orgMapChannel := make(chan orgMapElement, len(cfClients))
 
 	// channel of org maps for each foundation
-	spaceMapChannel := make(chan spaceMapElement)
+	spaceMapChannel := make(chan spaceMapElement, len(cfClients))
 
 	// Asynchronously fetch the list of apps for each foundation and the map of buildpacks
 	for foundation, cfClient := range cfClients {
-		err := cfClient.ReAuth()
-		if err != nil {
-			return foundations, err
+		if err := cfClient.ReAuth(); err != nil {
+			return nil, FoundationError{Foundation: foundation, Err: err}
 		}
+		authenticated[foundation] = true
 
 		go listAppsAsync(foundation, cfClient, cfClientAppsChannel)
 		go getBuildpacksAsync(foundation, cfClient, buildpacksMapsChannel)
@@ -71,8 +173,9 @@ func getFoundationsAsync(cfClients map[string]cf.IClient) (map[string]Foundation
 	for i := 0; i < len(cfClients); i++ {
 		cfClientAppsElem := <-cfClientAppsChannel
 		if cfClientAppsElem.err != nil {
-			return nil, cfClientAppsElem.err
+			return nil, FoundationError{Foundation: cfClientAppsElem.foundation, Err: cfClientAppsElem.err}
 		}
+		fetched[cfClientAppsElem.foundation] = time.Now()
 		foundation := foundations[cfClientAppsElem.foundation]
 		foundation.GoCFApps = cfClientAppsElem.cfClientApps
 		foundations[cfClientAppsElem.foundation] = foundation
@@ -83,8 +186,9 @@ func getFoundationsAsync(cfClients map[string]cf.IClient) (map[string]Foundation
 	for i := 0; i < len(cfClients); i++ {
 		buildpacksMapsElem := <-buildpacksMapsChannel
 		if buildpacksMapsElem.err != nil {
-			return nil, buildpacksMapsElem.err
+			return nil, FoundationError{Foundation: buildpacksMapsElem.foundation, Err: buildpacksMapsElem.err}
 		}
+		fetched[buildpacksMapsElem.foundation] = time.Now()
 		foundation := foundations[buildpacksMapsElem.foundation]
 		foundation.GoCFBuildpacks = buildpacksMapsElem.buildpacksMap
 		foundations[buildpacksMapsElem.foundation] = foundation
@@ -95,8 +199,9 @@ func getFoundationsAsync(cfClients map[string]cf.IClient) (map[string]Foundation
 	for i := 0; i < len(cfClients); i++ {
 		orgMapElem := <-orgMapChannel
 		if orgMapElem.err != nil {
-			return nil, orgMapElem.err
+			return nil, FoundationError{Foundation: orgMapElem.foundation, Err: orgMapElem.err}
 		}
+		fetched[orgMapElem.foundation] = time.Now()
 		foundation := foundations[orgMapElem.foundation]
 		foundation.GoCFOrgs = orgMapElem.orgMap
 		foundations[orgMapElem.foundation] = foundation
@@ -107,17 +212,208 @@ func getFoundationsAsync(cfClients map[string]cf.IClient) (map[string]Foundation
 	for i := 0; i < len(cfClients); i++ {
 		spaceMapElem := <-spaceMapChannel
 		if spaceMapElem.err != nil {
-			return nil, spaceMapElem.err
+			return nil, FoundationError{Foundation: spaceMapElem.foundation, Err: spaceMapElem.err}
 		}
+		fetched[spaceMapElem.foundation] = time.Now()
 		foundation := foundations[spaceMapElem.foundation]
 		foundation.GoCFSpaces = spaceMapElem.spaceMap
 		foundations[spaceMapElem.foundation] = foundation
 	}
 	close(spaceMapChannel)
 
+	// channel of org and space quotas for each foundation
+	quotasChannel := make(chan quotasElement, len(cfClients))
+
+	// channel of app instance maps for each foundation
+	appInstancesMapChannel := make(chan appInstancesMapElement, len(cfClients))
+
+	// channel of app stats maps for each foundation
+	appStatsMapChannel := make(chan appStatsMapElement, len(cfClients))
+
+	// channel of routes and their app mappings for each foundation
+	routesChannel := make(chan routesElement, len(cfClients))
+
+	// channel of service instances, bindings, offerings and plans for each foundation
+	servicesChannel := make(chan servicesElement, len(cfClients))
+
+	// channel of app, space and org metadata for each foundation
+	metadataChannel := make(chan metadataElement, len(cfClients))
+
+	// Asynchronously fetch the per app details that have been enabled for each foundation
+	for foundationName, foundation := range foundations {
+		if options.Capacity {
+			go getQuotasAsync(foundationName, cfClients[foundationName], quotasChannel)
+		}
+		if options.InstanceHealth {
+			go getAppInstancesAsync(foundationName, cfClients[foundationName], foundation.GoCFApps, options.instanceWorkers(), appInstancesMapChannel)
+		}
+		if options.ResourceUsage {
+			go getAppStatsAsync(foundationName, cfClients[foundationName], foundation.GoCFApps, options.instanceWorkers(), appStatsMapChannel)
+		}
+		if options.Routes {
+			go getRoutesAsync(foundationName, cfClients[foundationName], foundation.GoCFApps, options.instanceWorkers(), routesChannel)
+		}
+		if options.Services {
+			go getServicesAsync(foundationName, cfClients[foundationName], servicesChannel)
+		}
+		if options.Metadata {
+			go getMetadataAsync(foundationName, cfClients[foundationName], metadataChannel)
+		}
+	}
+
+	// Wait until the quotas have been fetched from each foundation. A
+	// foundation whose quotas can't be fetched is left out of the capacity
+	// report rather than failing the scrape.
+	if options.Capacity {
+		for i := 0; i < len(cfClients); i++ {
+			quotasElem := <-quotasChannel
+			if quotasElem.err != nil {
+				log.Printf("could not fetch quotas of %s, leaving it out of the capacity report: %s\n", quotasElem.foundation, quotasElem.err)
+				continue
+			}
+			fetched[quotasElem.foundation] = time.Now()
+			foundation := foundations[quotasElem.foundation]
+			foundation.GoCFOrgQuotas = quotasElem.orgQuotaMap
+			foundation.GoCFSpaceQuotas = quotasElem.spaceQuotaMap
+			foundations[quotasElem.foundation] = foundation
+		}
+	}
+	close(quotasChannel)
+
+	// Wait until the instances of every started app have been fetched from each foundation
+	if options.InstanceHealth {
+		for i := 0; i < len(cfClients); i++ {
+			appInstancesMapElem := <-appInstancesMapChannel
+			fetched[appInstancesMapElem.foundation] = time.Now()
+			foundation := foundations[appInstancesMapElem.foundation]
+			foundation.GoCFAppInstances = appInstancesMapElem.appInstancesMap
+			foundations[appInstancesMapElem.foundation] = foundation
+		}
+	}
+	close(appInstancesMapChannel)
+
+	// Wait until the stats of every started app have been fetched from each foundation
+	if options.ResourceUsage {
+		for i := 0; i < len(cfClients); i++ {
+			appStatsMapElem := <-appStatsMapChannel
+			fetched[appStatsMapElem.foundation] = time.Now()
+			foundation := foundations[appStatsMapElem.foundation]
+			foundation.GoCFAppStats = appStatsMapElem.appStatsMap
+			foundations[appStatsMapElem.foundation] = foundation
+		}
+	}
+	close(appStatsMapChannel)
+
+	// Wait until the routes and the routes of every app have been fetched from each foundation
+	if options.Routes {
+		for i := 0; i < len(cfClients); i++ {
+			routesElem := <-routesChannel
+			if routesElem.err != nil {
+				return nil, FoundationError{Foundation: routesElem.foundation, Err: routesElem.err}
+			}
+			fetched[routesElem.foundation] = time.Now()
+			foundation := foundations[routesElem.foundation]
+			foundation.GoCFRoutes = routesElem.routeMap
+			foundation.GoCFDomains = routesElem.domainMap
+			foundation.GoCFAppRoutes = routesElem.appRoutesMap
+			foundations[routesElem.foundation] = foundation
+		}
+	}
+	close(routesChannel)
+
+	// Wait until the service instances and bindings have been fetched from each foundation
+	if options.Services {
+		for i := 0; i < len(cfClients); i++ {
+			servicesElem := <-servicesChannel
+			if servicesElem.err != nil {
+				return nil, FoundationError{Foundation: servicesElem.foundation, Err: servicesElem.err}
+			}
+			fetched[servicesElem.foundation] = time.Now()
+			foundation := foundations[servicesElem.foundation]
+			foundation.GoCFServiceInstances = servicesElem.serviceInstanceMap
+			foundation.GoCFUserProvidedServiceInstances = servicesElem.userProvidedServiceInstanceMap
+			foundation.GoCFServiceBindings = servicesElem.serviceBindingMap
+			foundation.GoCFServices = servicesElem.serviceMap
+			foundation.GoCFServicePlans = servicesElem.servicePlanMap
+			foundations[servicesElem.foundation] = foundation
+		}
+	}
+	close(servicesChannel)
+
+	// Wait until the labels and annotations have been fetched from each foundation
+	if options.Metadata {
+		for i := 0; i < len(cfClients); i++ {
+			metadataElem := <-metadataChannel
+			if metadataElem.err != nil {
+				return nil, FoundationError{Foundation: metadataElem.foundation, Err: metadataElem.err}
+			}
+			fetched[metadataElem.foundation] = time.Now()
+			foundation := foundations[metadataElem.foundation]
+			foundation.AppMetadata = metadataElem.appMetadata
+			foundation.SpaceMetadata = metadataElem.spaceMetadata
+			foundation.OrgMetadata = metadataElem.orgMetadata
+			foundations[metadataElem.foundation] = foundation
+		}
+	}
+	close(metadataChannel)
+
 	return foundations, nil
 }
 
+// recordFoundations logs and records how long each foundation and each of
+// its lists took to fetch, and the error of the foundation that failed
+func recordFoundations(cfClients map[string]cf.IClient, telemetry *Telemetry, start time.Time, fetched map[string]time.Time, authenticated map[string]bool, err error) {
+	for foundationName, cfClient := range cfClients {
+		foundationScrape := FoundationScrape{
+			Foundation:    foundationName,
+			Duration:      time.Since(start),
+			Authenticated: authenticated[foundationName],
+			Lists:         takeListStats(cfClient),
+		}
+		if foundationErr, ok := err.(FoundationError); ok && foundationErr.Foundation == foundationName {
+			foundationScrape.Error = foundationErr.Err.Error()
+			log.Printf("could not scrape %s: %s\n", foundationName, foundationErr.Err)
+		} else if err == nil {
+			foundationScrape.Duration = fetched[foundationName].Sub(start)
+			logListStats(foundationName, foundationScrape.Lists)
+		}
+		telemetry.recordFoundation(foundationScrape, cfClient)
+	}
+}
+
+// statsRecorder is a client that records how it fetched each list
+type statsRecorder interface {
+	TakeStats() []cf.ListStats
+}
+
+// takeListStats returns how each list was fetched since the last scrape, if
+// the client records it
+func takeListStats(cfClient cf.IClient) []cf.ListStats {
+	recorder, ok := cfClient.(statsRecorder)
+	if !ok {
+		return nil
+	}
+	return recorder.TakeStats()
+}
+
+// logListStats logs how long each list of a foundation took, so a slow
+// foundation or list stands out
+func logListStats(foundation string, stats []cf.ListStats) {
+	if len(stats) == 0 {
+		return
+	}
+
+	lists := []string{}
+	for _, list := range stats {
+		pages := "pages"
+		if list.Pages == 1 {
+			pages = "page"
+		}
+		lists = append(lists, fmt.Sprintf("%s %d %s in %s", list.Resource, list.Pages, pages, list.Duration.Round(time.Millisecond)))
+	}
+	log.Printf("fetched %s: %s\n", foundation, strings.Join(lists, ", "))
+}
+
 func listAppsAsync(foundation string, cfClient cf.IClient, cfClientAppsChannel chan cfClientAppsElement) {
 	cfClientApps, err := cfClient.ListApps()
 	cfClientAppsChannel <- cfClientAppsElement{
@@ -153,3 +449,171 @@ func getSpacesAsync(foundation string, cfClient cf.IClient, spaceMapChannel chan
 		err:        err,
 	}
 }
+
+// getQuotasAsync fetches every org quota definition and space quota definition
+func getQuotasAsync(foundation string, cfClient cf.IClient, quotasChannel chan quotasElement) {
+	elem := quotasElement{foundation: foundation}
+
+	elem.orgQuotaMap, elem.err = cfClient.GetOrgQuotas()
+	if elem.err == nil {
+		elem.spaceQuotaMap, elem.err = cfClient.GetSpaceQuotas()
+	}
+
+	quotasChannel <- elem
+}
+
+// getAppInstancesAsync fetches the instances of every started app.
+// Apps whose instances can't be fetched are left out of the map.
+func getAppInstancesAsync(foundation string, cfClient cf.IClient, cfClientApps []gocf.App, workers int, appInstancesMapChannel chan appInstancesMapElement) {
+	appInstancesMap := map[string]map[string]gocf.AppInstance{}
+	var mutex sync.Mutex
+
+	forEachApp(cfClientApps, isStarted, workers, func(appGUID string) {
+		appInstances, err := cfClient.GetAppInstances(appGUID)
+		if err != nil {
+			log.Printf("could not fetch instances of app %s on %s: %s\n", appGUID, foundation, err)
+			return
+		}
+
+		mutex.Lock()
+		appInstancesMap[appGUID] = appInstances
+		mutex.Unlock()
+	})
+
+	appInstancesMapChannel <- appInstancesMapElement{
+		appInstancesMap: appInstancesMap,
+		foundation:      foundation,
+	}
+}
+
+// getAppStatsAsync fetches the instance stats of every started app.
+// Apps whose stats can't be fetched are left out of the map.
+func getAppStatsAsync(foundation string, cfClient cf.IClient, cfClientApps []gocf.App, workers int, appStatsMapChannel chan appStatsMapElement) {
+	appStatsMap := map[string]map[string]gocf.AppStats{}
+	var mutex sync.Mutex
+
+	forEachApp(cfClientApps, isStarted, workers, func(appGUID string) {
+		appStats, err := cfClient.GetAppStats(appGUID)
+		if err != nil {
+			log.Printf("could not fetch stats of app %s on %s: %s\n", appGUID, foundation, err)
+			return
+		}
+
+		mutex.Lock()
+		appStatsMap[appGUID] = appStats
+		mutex.Unlock()
+	})
+
+	appStatsMapChannel <- appStatsMapElement{
+		appStatsMap: appStatsMap,
+		foundation:  foundation,
+	}
+}
+
+// getRoutesAsync fetches every route and domain, then the routes of every app.
+// Apps whose routes can't be fetched are left out of the app routes map.
+func getRoutesAsync(foundation string, cfClient cf.IClient, cfClientApps []gocf.App, workers int, routesChannel chan routesElement) {
+	routeMap, err := cfClient.GetRoutes()
+	if err != nil {
+		routesChannel <- routesElement{foundation: foundation, err: err}
+		return
+	}
+
+	domainMap, err := cfClient.GetDomains()
+	if err != nil {
+		routesChannel <- routesElement{foundation: foundation, err: err}
+		return
+	}
+
+	appRoutesMap := map[string][]gocf.Route{}
+	var mutex sync.Mutex
+
+	forEachApp(cfClientApps, isAnyApp, workers, func(appGUID string) {
+		appRoutes, err := cfClient.GetAppRoutes(appGUID)
+		if err != nil {
+			log.Printf("could not fetch routes of app %s on %s: %s\n", appGUID, foundation, err)
+			return
+		}
+
+		mutex.Lock()
+		appRoutesMap[appGUID] = appRoutes
+		mutex.Unlock()
+	})
+
+	routesChannel <- routesElement{
+		routeMap:     routeMap,
+		domainMap:    domainMap,
+		appRoutesMap: appRoutesMap,
+		foundation:   foundation,
+	}
+}
+
+// getServicesAsync fetches every service instance, user provided service
+// instance, service binding, service offering and service plan
+func getServicesAsync(foundation string, cfClient cf.IClient, servicesChannel chan servicesElement) {
+	elem := servicesElement{foundation: foundation}
+
+	elem.serviceInstanceMap, elem.err = cfClient.GetServiceInstances()
+	if elem.err == nil {
+		elem.userProvidedServiceInstanceMap, elem.err = cfClient.GetUserProvidedServiceInstances()
+	}
+	if elem.err == nil {
+		elem.serviceBindingMap, elem.err = cfClient.GetServiceBindings()
+	}
+	if elem.err == nil {
+		elem.serviceMap, elem.err = cfClient.GetServices()
+	}
+	if elem.err == nil {
+		elem.servicePlanMap, elem.err = cfClient.GetServicePlans()
+	}
+
+	servicesChannel <- elem
+}
+
+// getMetadataAsync fetches the labels and annotations of every app, space and org
+func getMetadataAsync(foundation string, cfClient cf.IClient, metadataChannel chan metadataElement) {
+	elem := metadataElement{foundation: foundation}
+
+	elem.appMetadata, elem.err = cfClient.GetAppMetadata()
+	if elem.err == nil {
+		elem.spaceMetadata, elem.err = cfClient.GetSpaceMetadata()
+	}
+	if elem.err == nil {
+		elem.orgMetadata, elem.err = cfClient.GetOrgMetadata()
+	}
+
+	metadataChannel <- elem
+}
+
+// forEachApp calls fetch with the GUID of every app matching include using a
+// pool of workers, so that large foundations are not queried one app at a time
+func forEachApp(cfClientApps []gocf.App, include func(gocf.App) bool, workers int, fetch func(appGUID string)) {
+	appGUIDs := make(chan string)
+	var waitGroup sync.WaitGroup
+
+	for i := 0; i < workers; i++ {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			for appGUID := range appGUIDs {
+				fetch(appGUID)
+			}
+		}()
+	}
+
+	for _, cfClientApp := range cfClientApps {
+		if include(cfClientApp) {
+			appGUIDs <- cfClientApp.Guid
+		}
+	}
+	close(appGUIDs)
+	waitGroup.Wait()
+}
+
+func isStarted(cfClientApp gocf.App) bool {
+	return strings.ToUpper(cfClientApp.State) == "STARTED"
+}
+
+func isAnyApp(cfClientApp gocf.App) bool {
+	return true
+}
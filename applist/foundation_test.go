@@ -0,0 +1,122 @@
+package applist_test
+
+import (
+	"errors"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	. "github.com/FidelityInternational/cf-loupe/applist"
+	"github.com/FidelityInternational/cf-loupe/cf"
+	gocf "github.com/cloudfoundry-community/go-cfclient"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// listingClient lists an org and nothing else, waiting for release first if
+// it is not nil. It fails to list apps if appsErr is set and quotas if
+// quotasErr is set, and counts its quota requests if quotaRequests is set.
+type listingClient struct {
+	cf.IClient
+	release       chan struct{}
+	appsErr       error
+	quotasErr     error
+	quotaRequests *int32
+}
+
+func (client listingClient) wait() {
+	if client.release != nil {
+		<-client.release
+	}
+}
+
+func (client listingClient) ReAuth() error {
+	return nil
+}
+
+func (client listingClient) ListApps() ([]gocf.App, error) {
+	client.wait()
+	return []gocf.App{}, client.appsErr
+}
+
+func (client listingClient) GetBuildpacks() (map[string]gocf.Buildpack, error) {
+	client.wait()
+	return map[string]gocf.Buildpack{}, nil
+}
+
+func (client listingClient) GetOrgs() (map[string]gocf.Org, error) {
+	client.wait()
+	return map[string]gocf.Org{"org-1": {Guid: "org-1", Name: "org1"}}, nil
+}
+
+func (client listingClient) GetSpaces() (map[string]gocf.Space, error) {
+	client.wait()
+	return map[string]gocf.Space{}, nil
+}
+
+func (client listingClient) GetOrgQuotas() (map[string]gocf.OrgQuota, error) {
+	client.wait()
+	if client.quotaRequests != nil {
+		atomic.AddInt32(client.quotaRequests, 1)
+	}
+	return map[string]gocf.OrgQuota{}, client.quotasErr
+}
+
+func (client listingClient) GetSpaceQuotas() (map[string]gocf.SpaceQuota, error) {
+	client.wait()
+	if client.quotaRequests != nil {
+		atomic.AddInt32(client.quotaRequests, 1)
+	}
+	return map[string]gocf.SpaceQuota{}, client.quotasErr
+}
+
+var _ = Describe("Fetching foundations", func() {
+	It("does not leave the other foundations' goroutines behind when one fails", func() {
+		cfClients := map[string]cf.IClient{"dev": listingClient{}, "prod": listingClient{}}
+		_, err := BuildAppData(cfClients, time.Now(), Options{})
+		Expect(err).To(Succeed())
+		before := runtime.NumGoroutine()
+
+		release := make(chan struct{})
+		cfClients["dev"] = listingClient{appsErr: errors.New("CF-InjectedFailure")}
+		cfClients["prod"] = listingClient{release: release}
+
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			close(release)
+		}()
+		_, err = BuildAppData(cfClients, time.Now(), Options{})
+		Expect(err).To(MatchError(ContainSubstring("could not scrape dev")))
+
+		Eventually(runtime.NumGoroutine).Should(BeNumerically("<=", before))
+	})
+
+	It("only fetches quotas when capacity is collected", func() {
+		var quotaRequests int32
+		cfClients := map[string]cf.IClient{"dev": listingClient{quotaRequests: &quotaRequests}}
+
+		appData, err := BuildAppData(cfClients, time.Now(), Options{})
+		Expect(err).To(Succeed())
+		Expect(appData.Capacity).To(BeNil())
+		Expect(atomic.LoadInt32(&quotaRequests)).To(BeZero())
+
+		appData, err = BuildAppData(cfClients, time.Now(), Options{Capacity: true})
+		Expect(err).To(Succeed())
+		Expect(appData.Capacity.Orgs).To(HaveLen(1))
+		Expect(atomic.LoadInt32(&quotaRequests)).To(Equal(int32(2)))
+	})
+
+	It("leaves a foundation whose quotas can't be fetched out of the capacity report", func() {
+		cfClients := map[string]cf.IClient{
+			"dev":  listingClient{quotasErr: errors.New("CF-InjectedFailure")},
+			"prod": listingClient{},
+		}
+
+		appData, err := BuildAppData(cfClients, time.Now(), Options{Capacity: true})
+		Expect(err).To(Succeed())
+		Expect(appData.Capacity.Orgs).To(Equal([]OrgCapacity{
+			{Foundation: "prod", Org: "org1", Capacity: Capacity{MemoryLimitMB: Unlimited}},
+		}))
+	})
+})
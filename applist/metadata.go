@@ -0,0 +1,119 @@
+package applist
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/FidelityInternational/cf-loupe/cf"
+)
+
+var defaultOwnerKeys = []string{"team", "owner", "owner-email"}
+
+// LabelGroup summarises the apps sharing a label or annotation value
+type LabelGroup struct {
+	Value   string
+	Summary Summary
+}
+
+func (options Options) ownerKeys() []string {
+	if len(options.OwnerKeys) == 0 {
+		return defaultOwnerKeys
+	}
+	return options.OwnerKeys
+}
+
+// MetadataValue returns the value of an app's label, or of its annotation if
+// there is no label with that key
+func (app App) MetadataValue(key string) (string, bool) {
+	if value, ok := app.Labels[key]; ok {
+		return value, true
+	}
+	value, ok := app.Annotations[key]
+	return value, ok
+}
+
+// AssignOwners sets the owner of each app to the value of the first owner key
+// found in its labels or annotations
+func AssignOwners(apps []App, ownerKeys []string) {
+	for i, app := range apps {
+		for _, key := range ownerKeys {
+			if value, ok := app.MetadataValue(key); ok && value != "" {
+				apps[i].Owner = value
+				break
+			}
+		}
+	}
+}
+
+// FilterByLabel returns the apps matching a selector of the form "key" or
+// "key=value", or all apps if the selector is empty
+func FilterByLabel(apps []App, selector string) []App {
+	if selector == "" {
+		return apps
+	}
+
+	parts := strings.SplitN(selector, "=", 2)
+	key := parts[0]
+
+	filteredApps := []App{}
+	for _, app := range apps {
+		value, ok := app.MetadataValue(key)
+		if !ok {
+			continue
+		}
+		if len(parts) == 2 && value != parts[1] {
+			continue
+		}
+		filteredApps = append(filteredApps, app)
+	}
+
+	return filteredApps
+}
+
+// GroupByLabel summarises the apps for each value of a label or annotation.
+// Apps without the key are grouped under an empty value.
+func GroupByLabel(apps []App, key string) []LabelGroup {
+	appsByValue := map[string][]App{}
+	for _, app := range apps {
+		value, _ := app.MetadataValue(key)
+		appsByValue[value] = append(appsByValue[value], app)
+	}
+
+	groups := []LabelGroup{}
+	for value, groupApps := range appsByValue {
+		groups = append(groups, LabelGroup{
+			Value:   value,
+			Summary: BuildSummary(groupApps),
+		})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Value < groups[j].Value
+	})
+
+	return groups
+}
+
+// inheritedMetadata merges the metadata of an org, space and app, with the
+// most specific resource winning. It returns nil maps if metadata was not fetched.
+func inheritedMetadata(foundation Foundation, orgGUID, spaceGUID, appGUID string) (map[string]string, map[string]string) {
+	if foundation.AppMetadata == nil {
+		return nil, nil
+	}
+
+	labels := map[string]string{}
+	annotations := map[string]string{}
+	for _, metadata := range []cf.Metadata{
+		foundation.OrgMetadata[orgGUID],
+		foundation.SpaceMetadata[spaceGUID],
+		foundation.AppMetadata[appGUID],
+	} {
+		for key, value := range metadata.Labels {
+			labels[key] = value
+		}
+		for key, value := range metadata.Annotations {
+			annotations[key] = value
+		}
+	}
+
+	return labels, annotations
+}
@@ -0,0 +1,113 @@
+package applist_test
+
+import (
+	"time"
+
+	. "github.com/FidelityInternational/cf-loupe/applist"
+	"github.com/FidelityInternational/cf-loupe/cf"
+	gocf "github.com/cloudfoundry-community/go-cfclient"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Metadata", func() {
+	var foundation Foundation
+	var currentTime time.Time
+
+	BeforeEach(func() {
+		currentTime, _ = time.Parse(time.RFC3339, "2017-08-15T15:00:06Z")
+		foundation = Foundation{
+			GoCFApps: []gocf.App{
+				{Guid: "app1-guid", Name: "app1", UpdatedAt: "2017-08-12T16:41:45Z", DetectedBuildpackGuid: "def456", SpaceGuid: "def456"},
+				{Guid: "app2-guid", Name: "app2", UpdatedAt: "2017-08-12T16:41:45Z", DetectedBuildpackGuid: "def456", SpaceGuid: "def456"},
+				{Guid: "app3-guid", Name: "app3", UpdatedAt: "2017-08-12T16:41:45Z", DetectedBuildpackGuid: "def456", SpaceGuid: "ghi789"},
+			},
+			GoCFBuildpacks: map[string]gocf.Buildpack{
+				"def456": {
+					Name:     "java_buildpack",
+					Filename: "java-buildpack-v1_19-fidelity-abc1234.zip",
+				},
+			},
+			GoCFOrgs: map[string]gocf.Org{
+				"abc123": {
+					Name: "APP1234-project-x",
+				},
+			},
+			GoCFSpaces: map[string]gocf.Space{
+				"def456": {
+					Name:             "DEV",
+					OrganizationGuid: "abc123",
+				},
+				"ghi789": {
+					Name:             "TEST",
+					OrganizationGuid: "abc123",
+				},
+			},
+			OrgMetadata: map[string]cf.Metadata{
+				"abc123": {Labels: map[string]string{"cost-centre": "1234"}},
+			},
+			SpaceMetadata: map[string]cf.Metadata{
+				"def456": {Labels: map[string]string{"team": "payments", "env": "dev"}},
+			},
+			AppMetadata: map[string]cf.Metadata{
+				"app1-guid": {
+					Labels:      map[string]string{"team": "orders"},
+					Annotations: map[string]string{"owner-email": "orders@example.com"},
+				},
+			},
+		}
+	})
+
+	It("inherits labels from the space and org, with the app winning", func() {
+		appList, err := BuildAppList(foundation, currentTime, "dev")
+		Expect(err).To(Succeed())
+
+		Expect(appList[0].Labels).To(Equal(map[string]string{"cost-centre": "1234", "team": "orders", "env": "dev"}))
+		Expect(appList[0].Annotations).To(Equal(map[string]string{"owner-email": "orders@example.com"}))
+		Expect(appList[1].Labels).To(Equal(map[string]string{"cost-centre": "1234", "team": "payments", "env": "dev"}))
+		Expect(appList[2].Labels).To(Equal(map[string]string{"cost-centre": "1234"}))
+	})
+
+	It("leaves labels unset when metadata was not fetched", func() {
+		foundation.AppMetadata = nil
+		appList, err := BuildAppList(foundation, currentTime, "dev")
+		Expect(err).To(Succeed())
+
+		Expect(appList[0].Labels).To(BeNil())
+		Expect(BuildSummary(appList).UnownedApps).To(Equal(0))
+	})
+
+	It("assigns owners from the first owner key found", func() {
+		appList, err := BuildAppList(foundation, currentTime, "dev")
+		Expect(err).To(Succeed())
+
+		AssignOwners(appList, []string{"owner-email", "team"})
+		Expect(appList[0].Owner).To(Equal("orders@example.com"))
+		Expect(appList[1].Owner).To(Equal("payments"))
+		Expect(appList[2].Owner).To(Equal(""))
+		Expect(BuildSummary(appList).UnownedApps).To(Equal(1))
+	})
+
+	It("filters apps by label key and value", func() {
+		appList, err := BuildAppList(foundation, currentTime, "dev")
+		Expect(err).To(Succeed())
+
+		Expect(FilterByLabel(appList, "env")).To(HaveLen(2))
+		Expect(FilterByLabel(appList, "team=orders")).To(HaveLen(1))
+		Expect(FilterByLabel(appList, "owner-email=orders@example.com")).To(HaveLen(1))
+		Expect(FilterByLabel(appList, "")).To(HaveLen(3))
+	})
+
+	It("groups apps by label value", func() {
+		appList, err := BuildAppList(foundation, currentTime, "dev")
+		Expect(err).To(Succeed())
+
+		groups := GroupByLabel(appList, "team")
+		Expect(groups).To(HaveLen(3))
+		Expect(groups[0].Value).To(Equal(""))
+		Expect(groups[0].Summary.TotalApps).To(Equal(1))
+		Expect(groups[1].Value).To(Equal("orders"))
+		Expect(groups[2].Value).To(Equal("payments"))
+	})
+})
@@ -0,0 +1,147 @@
+package applist
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	gocf "github.com/cloudfoundry-community/go-cfclient"
+)
+
+// RouteReport lists the routes and apps that are candidates for clean up
+type RouteReport struct {
+	OrphanedRoutes []OrphanedRoute
+	UnroutedApps   []UnroutedApp
+}
+
+// OrphanedRoute is a route that is not mapped to any app
+type OrphanedRoute struct {
+	URL        string
+	Foundation string
+	Org        string
+	Space      string
+}
+
+// UnroutedApp is an app with no routes that does not look like a worker.
+// Apps with a process or no health check are considered workers.
+type UnroutedApp struct {
+	Name       string
+	Foundation string
+	Org        string
+	Space      string
+}
+
+// BuildRouteReport returns the orphaned routes and unrouted apps of a foundation
+func BuildRouteReport(foundation Foundation, foundationName string) RouteReport {
+	report := RouteReport{
+		OrphanedRoutes: []OrphanedRoute{},
+		UnroutedApps:   []UnroutedApp{},
+	}
+
+	mappedRoutes := map[string]bool{}
+	for _, appRoutes := range foundation.GoCFAppRoutes {
+		for _, route := range appRoutes {
+			mappedRoutes[route.Guid] = true
+		}
+	}
+
+	for routeGUID, route := range foundation.GoCFRoutes {
+		if mappedRoutes[routeGUID] || route.ServiceInstanceGuid != "" {
+			continue
+		}
+
+		org, space := orgAndSpaceNames(foundation, route.SpaceGuid)
+		report.OrphanedRoutes = append(report.OrphanedRoutes, OrphanedRoute{
+			URL:        routeURL(route, foundation.GoCFDomains),
+			Foundation: foundationName,
+			Org:        org,
+			Space:      space,
+		})
+	}
+
+	for _, cfClientApp := range foundation.GoCFApps {
+		appRoutes, ok := foundation.GoCFAppRoutes[cfClientApp.Guid]
+		if !ok || len(appRoutes) > 0 || isWorker(cfClientApp) {
+			continue
+		}
+
+		org, space := orgAndSpaceNames(foundation, cfClientApp.SpaceGuid)
+		report.UnroutedApps = append(report.UnroutedApps, UnroutedApp{
+			Name:       cfClientApp.Name,
+			Foundation: foundationName,
+			Org:        org,
+			Space:      space,
+		})
+	}
+
+	report.sort()
+	return report
+}
+
+// merge adds the routes and apps of another report
+func (report *RouteReport) merge(other RouteReport) {
+	report.OrphanedRoutes = append(report.OrphanedRoutes, other.OrphanedRoutes...)
+	report.UnroutedApps = append(report.UnroutedApps, other.UnroutedApps...)
+	report.sort()
+}
+
+func (report *RouteReport) sort() {
+	sort.Slice(report.OrphanedRoutes, func(i, j int) bool {
+		a, b := report.OrphanedRoutes[i], report.OrphanedRoutes[j]
+		if a.Foundation != b.Foundation {
+			return a.Foundation < b.Foundation
+		}
+		return a.URL < b.URL
+	})
+	sort.Slice(report.UnroutedApps, func(i, j int) bool {
+		a, b := report.UnroutedApps[i], report.UnroutedApps[j]
+		if a.Foundation != b.Foundation {
+			return a.Foundation < b.Foundation
+		}
+		if a.Org != b.Org {
+			return a.Org < b.Org
+		}
+		if a.Space != b.Space {
+			return a.Space < b.Space
+		}
+		return a.Name < b.Name
+	})
+}
+
+// appURLs returns the URLs of an app, or nil if its routes were not fetched
+func appURLs(foundation Foundation, appGUID string) []string {
+	appRoutes, ok := foundation.GoCFAppRoutes[appGUID]
+	if !ok {
+		return nil
+	}
+
+	urls := []string{}
+	for _, route := range appRoutes {
+		urls = append(urls, routeURL(route, foundation.GoCFDomains))
+	}
+	sort.Strings(urls)
+
+	return urls
+}
+
+func routeURL(route gocf.Route, domains map[string]gocf.Domain) string {
+	domain := domains[route.DomainGuid].Name
+	if route.Port > 0 {
+		return fmt.Sprintf("%s:%d", domain, route.Port)
+	}
+	if route.Host != "" {
+		domain = route.Host + "." + domain
+	}
+	return domain + route.Path
+}
+
+func isWorker(cfClientApp gocf.App) bool {
+	healthCheckType := strings.ToLower(cfClientApp.HealthCheckType)
+	return healthCheckType == "process" || healthCheckType == "none"
+}
+
+func orgAndSpaceNames(foundation Foundation, spaceGUID string) (string, string) {
+	space := foundation.GoCFSpaces[spaceGUID]
+	org := foundation.GoCFOrgs[space.OrganizationGuid]
+	return org.Name, space.Name
+}
@@ -0,0 +1,89 @@
+package applist_test
+
+import (
+	"time"
+
+	. "github.com/FidelityInternational/cf-loupe/applist"
+	gocf "github.com/cloudfoundry-community/go-cfclient"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Routes", func() {
+	var foundation Foundation
+
+	BeforeEach(func() {
+		foundation = Foundation{
+			GoCFApps: []gocf.App{
+				{Guid: "app1-guid", Name: "app1", UpdatedAt: "2017-08-12T16:41:45Z", DetectedBuildpackGuid: "def456", SpaceGuid: "def456", HealthCheckType: "port"},
+				{Guid: "app2-guid", Name: "app2", UpdatedAt: "2017-08-12T16:41:45Z", DetectedBuildpackGuid: "def456", SpaceGuid: "def456", HealthCheckType: "port"},
+				{Guid: "worker-guid", Name: "worker", UpdatedAt: "2017-08-12T16:41:45Z", DetectedBuildpackGuid: "def456", SpaceGuid: "def456", HealthCheckType: "process"},
+				{Guid: "unknown-guid", Name: "unknown", UpdatedAt: "2017-08-12T16:41:45Z", DetectedBuildpackGuid: "def456", SpaceGuid: "def456", HealthCheckType: "port"},
+			},
+			GoCFBuildpacks: map[string]gocf.Buildpack{
+				"def456": {
+					Name:     "java_buildpack",
+					Filename: "java-buildpack-v1_19-fidelity-abc1234.zip",
+				},
+			},
+			GoCFOrgs: map[string]gocf.Org{
+				"abc123": {
+					Name: "APP1234-project-x",
+				},
+			},
+			GoCFSpaces: map[string]gocf.Space{
+				"def456": {
+					Name:             "DEV",
+					OrganizationGuid: "abc123",
+				},
+			},
+			GoCFDomains: map[string]gocf.Domain{
+				"apps-domain": {Name: "apps.example.com"},
+				"tcp-domain":  {Name: "tcp.example.com"},
+			},
+			GoCFRoutes: map[string]gocf.Route{
+				"route1": {Guid: "route1", Host: "app1", DomainGuid: "apps-domain", SpaceGuid: "def456"},
+				"route2": {Guid: "route2", Host: "app1", Path: "/api", DomainGuid: "apps-domain", SpaceGuid: "def456"},
+				"route3": {Guid: "route3", DomainGuid: "tcp-domain", Port: 1024, SpaceGuid: "def456"},
+				"route4": {Guid: "route4", Host: "forgotten", DomainGuid: "apps-domain", SpaceGuid: "def456"},
+			},
+			GoCFAppRoutes: map[string][]gocf.Route{
+				"app1-guid": {
+					{Guid: "route2", Host: "app1", Path: "/api", DomainGuid: "apps-domain"},
+					{Guid: "route1", Host: "app1", DomainGuid: "apps-domain"},
+				},
+				"app2-guid":   {{Guid: "route3", DomainGuid: "tcp-domain", Port: 1024}},
+				"worker-guid": {},
+			},
+		}
+	})
+
+	It("returns the URLs of each app", func() {
+		currentTime, _ := time.Parse(time.RFC3339, "2017-08-24T12:00:00Z")
+		appList, err := BuildAppList(foundation, currentTime, "dev")
+		Expect(err).To(Succeed())
+
+		Expect(appList[0].URLs).To(Equal([]string{"app1.apps.example.com", "app1.apps.example.com/api"}))
+		Expect(appList[1].URLs).To(Equal([]string{"tcp.example.com:1024"}))
+		Expect(appList[2].URLs).To(BeEmpty())
+		Expect(appList[3].URLs).To(BeNil())
+	})
+
+	It("reports routes mapped to no app", func() {
+		report := BuildRouteReport(foundation, "dev")
+
+		Expect(report.OrphanedRoutes).To(Equal([]OrphanedRoute{
+			{URL: "forgotten.apps.example.com", Foundation: "dev", Org: "APP1234-project-x", Space: "DEV"},
+		}))
+	})
+
+	It("reports apps with no routes that are not workers", func() {
+		foundation.GoCFAppRoutes["app2-guid"] = []gocf.Route{}
+		report := BuildRouteReport(foundation, "dev")
+
+		Expect(report.UnroutedApps).To(Equal([]UnroutedApp{
+			{Name: "app2", Foundation: "dev", Org: "APP1234-project-x", Space: "DEV"},
+		}))
+	})
+})
@@ -0,0 +1,221 @@
+package applist
+
+import (
+	"sort"
+)
+
+const userProvidedService = "user-provided"
+
+// BoundService is a service instance bound to an app
+type BoundService struct {
+	Name    string
+	Service string
+	Plan    string
+}
+
+// ServicesReport contains the usage of every service plan and the service
+// instances that are not bound to any app
+type ServicesReport struct {
+	Plans            []ServicePlanUsage
+	UnboundInstances []UnboundServiceInstance
+}
+
+// ServicePlanUsage contains the number of instances of a service plan and the
+// number of apps bound to them
+type ServicePlanUsage struct {
+	Foundation string
+	Service    string
+	Plan       string
+	IsActive   bool // false if the plan or its offering can no longer be provisioned
+	Instances  int
+	BoundApps  int
+}
+
+// UnboundServiceInstance is a service instance that is not bound to any app
+type UnboundServiceInstance struct {
+	Name       string
+	Service    string
+	Plan       string
+	Foundation string
+	Org        string
+	Space      string
+}
+
+// serviceInstance is a managed or user provided service instance
+type serviceInstance struct {
+	name      string
+	service   string
+	plan      string
+	planGUID  string
+	spaceGUID string
+}
+
+func serviceInstances(foundation Foundation) map[string]serviceInstance {
+	instances := map[string]serviceInstance{}
+
+	for guid, instance := range foundation.GoCFServiceInstances {
+		plan := foundation.GoCFServicePlans[instance.ServicePlanGuid]
+		service := foundation.GoCFServices[plan.ServiceGuid]
+		instances[guid] = serviceInstance{
+			name:      instance.Name,
+			service:   service.Label,
+			plan:      plan.Name,
+			planGUID:  instance.ServicePlanGuid,
+			spaceGUID: instance.SpaceGuid,
+		}
+	}
+
+	for guid, instance := range foundation.GoCFUserProvidedServiceInstances {
+		instances[guid] = serviceInstance{
+			name:      instance.Name,
+			service:   userProvidedService,
+			spaceGUID: instance.SpaceGuid,
+		}
+	}
+
+	return instances
+}
+
+// appServices returns the services bound to each app, or nil if services were not fetched
+func appServices(foundation Foundation) map[string][]BoundService {
+	if foundation.GoCFServiceBindings == nil {
+		return nil
+	}
+
+	instances := serviceInstances(foundation)
+	boundServices := map[string][]BoundService{}
+
+	for _, binding := range foundation.GoCFServiceBindings {
+		instance, ok := instances[binding.ServiceInstanceGuid]
+		if !ok {
+			continue
+		}
+		boundServices[binding.AppGuid] = append(boundServices[binding.AppGuid], BoundService{
+			Name:    instance.name,
+			Service: instance.service,
+			Plan:    instance.plan,
+		})
+	}
+
+	for appGUID, services := range boundServices {
+		sort.Slice(services, func(i, j int) bool {
+			return services[i].Name < services[j].Name
+		})
+		boundServices[appGUID] = services
+	}
+
+	return boundServices
+}
+
+func boundServices(servicesMap map[string][]BoundService, appGUID string) []BoundService {
+	if servicesMap == nil {
+		return nil
+	}
+	if services, ok := servicesMap[appGUID]; ok {
+		return services
+	}
+	return []BoundService{}
+}
+
+// BuildServicesReport returns the usage of every service plan of a foundation
+// and the service instances that are not bound to any app
+func BuildServicesReport(foundation Foundation, foundationName string) ServicesReport {
+	report := ServicesReport{
+		Plans:            []ServicePlanUsage{},
+		UnboundInstances: []UnboundServiceInstance{},
+	}
+
+	instances := serviceInstances(foundation)
+
+	boundApps := map[string]map[string]bool{}
+	for _, binding := range foundation.GoCFServiceBindings {
+		if boundApps[binding.ServiceInstanceGuid] == nil {
+			boundApps[binding.ServiceInstanceGuid] = map[string]bool{}
+		}
+		boundApps[binding.ServiceInstanceGuid][binding.AppGuid] = true
+	}
+
+	plans := map[string]*ServicePlanUsage{}
+	for planGUID, plan := range foundation.GoCFServicePlans {
+		service := foundation.GoCFServices[plan.ServiceGuid]
+		plans[planGUID] = &ServicePlanUsage{
+			Foundation: foundationName,
+			Service:    service.Label,
+			Plan:       plan.Name,
+			IsActive:   plan.Active && service.Active,
+		}
+	}
+	userProvided := &ServicePlanUsage{
+		Foundation: foundationName,
+		Service:    userProvidedService,
+		IsActive:   true,
+	}
+
+	for guid, instance := range instances {
+		plan := userProvided
+		if instance.service != userProvidedService {
+			var ok bool
+			plan, ok = plans[instance.planGUID]
+			if !ok {
+				continue
+			}
+		}
+		plan.Instances++
+		plan.BoundApps += len(boundApps[guid])
+
+		if len(boundApps[guid]) == 0 {
+			org, space := orgAndSpaceNames(foundation, instance.spaceGUID)
+			report.UnboundInstances = append(report.UnboundInstances, UnboundServiceInstance{
+				Name:       instance.name,
+				Service:    instance.service,
+				Plan:       instance.plan,
+				Foundation: foundationName,
+				Org:        org,
+				Space:      space,
+			})
+		}
+	}
+
+	for _, plan := range plans {
+		report.Plans = append(report.Plans, *plan)
+	}
+	if userProvided.Instances > 0 {
+		report.Plans = append(report.Plans, *userProvided)
+	}
+
+	report.sort()
+	return report
+}
+
+// merge adds the plans and instances of another report
+func (report *ServicesReport) merge(other ServicesReport) {
+	report.Plans = append(report.Plans, other.Plans...)
+	report.UnboundInstances = append(report.UnboundInstances, other.UnboundInstances...)
+	report.sort()
+}
+
+func (report *ServicesReport) sort() {
+	sort.Slice(report.Plans, func(i, j int) bool {
+		a, b := report.Plans[i], report.Plans[j]
+		if a.Foundation != b.Foundation {
+			return a.Foundation < b.Foundation
+		}
+		if a.Service != b.Service {
+			return a.Service < b.Service
+		}
+		return a.Plan < b.Plan
+	})
+	sort.Slice(report.UnboundInstances, func(i, j int) bool {
+		a, b := report.UnboundInstances[i], report.UnboundInstances[j]
+		if a.Foundation != b.Foundation {
+			return a.Foundation < b.Foundation
+		}
+		if a.Org != b.Org {
+			return a.Org < b.Org
+		}
+		if a.Space != b.Space {
+			return a.Space < b.Space
+		}
+		return a.Name < b.Name
+	})
+}
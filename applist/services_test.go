@@ -0,0 +1,107 @@
+package applist_test
+
+import (
+	"time"
+
+	. "github.com/FidelityInternational/cf-loupe/applist"
+	gocf "github.com/cloudfoundry-community/go-cfclient"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Services", func() {
+	var foundation Foundation
+
+	BeforeEach(func() {
+		foundation = Foundation{
+			GoCFApps: []gocf.App{
+				{Guid: "app1-guid", Name: "app1", UpdatedAt: "2017-08-12T16:41:45Z", DetectedBuildpackGuid: "def456", SpaceGuid: "def456"},
+				{Guid: "app2-guid", Name: "app2", UpdatedAt: "2017-08-12T16:41:45Z", DetectedBuildpackGuid: "def456", SpaceGuid: "def456"},
+				{Guid: "app3-guid", Name: "app3", UpdatedAt: "2017-08-12T16:41:45Z", DetectedBuildpackGuid: "def456", SpaceGuid: "def456"},
+			},
+			GoCFBuildpacks: map[string]gocf.Buildpack{
+				"def456": {
+					Name:     "java_buildpack",
+					Filename: "java-buildpack-v1_19-fidelity-abc1234.zip",
+				},
+			},
+			GoCFOrgs: map[string]gocf.Org{
+				"abc123": {
+					Name: "APP1234-project-x",
+				},
+			},
+			GoCFSpaces: map[string]gocf.Space{
+				"def456": {
+					Name:             "DEV",
+					OrganizationGuid: "abc123",
+				},
+			},
+			GoCFServices: map[string]gocf.Service{
+				"mysql": {Label: "p-mysql", Active: true},
+			},
+			GoCFServicePlans: map[string]gocf.ServicePlan{
+				"small": {Name: "small", ServiceGuid: "mysql", Active: true},
+				"old":   {Name: "100mb-dev", ServiceGuid: "mysql", Active: false},
+			},
+			GoCFServiceInstances: map[string]gocf.ServiceInstance{
+				"db1": {Name: "orders-db", ServicePlanGuid: "small", SpaceGuid: "def456"},
+				"db2": {Name: "legacy-db", ServicePlanGuid: "old", SpaceGuid: "def456"},
+				"db3": {Name: "forgotten-db", ServicePlanGuid: "small", SpaceGuid: "def456"},
+			},
+			GoCFUserProvidedServiceInstances: map[string]gocf.UserProvidedServiceInstance{
+				"ups1": {Name: "splunk", SpaceGuid: "def456"},
+			},
+			GoCFServiceBindings: map[string]gocf.ServiceBinding{
+				"binding1": {AppGuid: "app1-guid", ServiceInstanceGuid: "db1"},
+				"binding2": {AppGuid: "app1-guid", ServiceInstanceGuid: "ups1"},
+				"binding3": {AppGuid: "app2-guid", ServiceInstanceGuid: "db1"},
+				"binding4": {AppGuid: "app2-guid", ServiceInstanceGuid: "db2"},
+			},
+		}
+	})
+
+	It("attaches the bound services to each app", func() {
+		currentTime, _ := time.Parse(time.RFC3339, "2017-08-24T12:00:00Z")
+		appList, err := BuildAppList(foundation, currentTime, "dev")
+		Expect(err).To(Succeed())
+
+		Expect(appList[0].Services).To(Equal([]BoundService{
+			{Name: "orders-db", Service: "p-mysql", Plan: "small"},
+			{Name: "splunk", Service: "user-provided"},
+		}))
+		Expect(appList[1].Services).To(Equal([]BoundService{
+			{Name: "legacy-db", Service: "p-mysql", Plan: "100mb-dev"},
+			{Name: "orders-db", Service: "p-mysql", Plan: "small"},
+		}))
+		Expect(appList[2].Services).To(BeEmpty())
+		Expect(appList[2].Services).NotTo(BeNil())
+	})
+
+	It("leaves the services of each app empty when services are not collected", func() {
+		foundation.GoCFServiceBindings = nil
+
+		currentTime, _ := time.Parse(time.RFC3339, "2017-08-24T12:00:00Z")
+		appList, err := BuildAppList(foundation, currentTime, "dev")
+		Expect(err).To(Succeed())
+		Expect(appList[0].Services).To(BeNil())
+	})
+
+	It("counts the instances and bound apps of each plan", func() {
+		report := BuildServicesReport(foundation, "dev")
+
+		Expect(report.Plans).To(Equal([]ServicePlanUsage{
+			{Foundation: "dev", Service: "p-mysql", Plan: "100mb-dev", IsActive: false, Instances: 1, BoundApps: 1},
+			{Foundation: "dev", Service: "p-mysql", Plan: "small", IsActive: true, Instances: 2, BoundApps: 2},
+			{Foundation: "dev", Service: "user-provided", IsActive: true, Instances: 1, BoundApps: 1},
+		}))
+	})
+
+	It("lists the service instances not bound to any app", func() {
+		report := BuildServicesReport(foundation, "dev")
+
+		Expect(report.UnboundInstances).To(Equal([]UnboundServiceInstance{
+			{Name: "forgotten-db", Service: "p-mysql", Plan: "small", Foundation: "dev", Org: "APP1234-project-x", Space: "DEV"},
+		}))
+	})
+})
@@ -0,0 +1,228 @@
+package applist
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/FidelityInternational/cf-loupe/cf"
+	gocf "github.com/cloudfoundry-community/go-cfclient"
+)
+
+// syncOverlap is how far before the last sync changes are asked for, as an
+// event can be recorded a little after the time it is stamped with
+const syncOverlap = time.Minute
+
+// changesLister is a client that can list the apps that changed since a time
+type changesLister interface {
+	ListAppChanges(since time.Time) ([]gocf.AppEventEntity, error)
+	GetApp(appGUID string) (gocf.App, bool, error)
+}
+
+// Syncer builds app data, fetching only what changed since the last scrape.
+// Each foundation is fetched in full the first time and then every full sync
+// interval. In between, the apps created, changed or deleted since the last
+// sync are found from their audit events and fetched one by one. Buildpacks,
+// instances and stats are always fetched again. Orgs, spaces, quotas,
+// services and metadata are kept until the next full sync.
+type Syncer struct {
+	cfClients        map[string]cf.IClient
+	options          Options
+	fullSyncInterval time.Duration
+
+	mutex  sync.Mutex
+	synced map[string]syncedFoundation
+}
+
+type syncedFoundation struct {
+	foundation   Foundation
+	lastSync     time.Time
+	lastFullSync time.Time
+}
+
+// NewSyncer returns a Syncer that fetches each foundation in full every
+// fullSyncInterval
+func NewSyncer(cfClients map[string]cf.IClient, options Options, fullSyncInterval time.Duration) *Syncer {
+	return &Syncer{
+		cfClients:        cfClients,
+		options:          options,
+		fullSyncInterval: fullSyncInterval,
+		synced:           map[string]syncedFoundation{},
+	}
+}
+
+type syncedFoundationElement struct {
+	synced     syncedFoundation
+	foundation string
+	err        error
+}
+
+// BuildAppData syncs every foundation and returns their app data
+func (syncer *Syncer) BuildAppData(now time.Time) (AppData, error) {
+	syncer.mutex.Lock()
+	defer syncer.mutex.Unlock()
+
+	syncedChannel := make(chan syncedFoundationElement, len(syncer.cfClients))
+	for foundation, cfClient := range syncer.cfClients {
+		go func(foundation string, cfClient cf.IClient) {
+			synced, err := syncer.sync(foundation, cfClient, now)
+			syncedChannel <- syncedFoundationElement{synced: synced, foundation: foundation, err: err}
+		}(foundation, cfClient)
+	}
+
+	foundations := map[string]Foundation{}
+	var err error
+	for i := 0; i < len(syncer.cfClients); i++ {
+		syncedElem := <-syncedChannel
+		if syncedElem.err != nil {
+			if err == nil {
+				err = syncedElem.err
+			}
+			continue
+		}
+		syncer.synced[syncedElem.foundation] = syncedElem.synced
+		foundations[syncedElem.foundation] = syncedElem.synced.foundation
+	}
+	if err != nil {
+		return AppData{}, err
+	}
+
+	return buildAppDataFromFoundations(foundations, now, syncer.options)
+}
+
+// sync fetches what changed on a foundation since it was last synced, or all
+// of it when it has not been synced yet, a full sync is due or the changes
+// can't be fetched
+func (syncer *Syncer) sync(foundation string, cfClient cf.IClient, now time.Time) (syncedFoundation, error) {
+	previous, synced := syncer.synced[foundation]
+	lister, canList := cfClient.(changesLister)
+	if synced && canList && now.Sub(previous.lastFullSync) < syncer.fullSyncInterval {
+		changed, err := syncChanges(foundation, cfClient, lister, previous.foundation, previous.lastSync.Add(-syncOverlap), syncer.options)
+		if err == nil {
+			return syncedFoundation{foundation: changed, lastSync: now, lastFullSync: previous.lastFullSync}, nil
+		}
+		log.Printf("could not fetch the changes on %s, fetching all of it: %s\n", foundation, err)
+	}
+
+	foundations, err := getFoundationsAsync(map[string]cf.IClient{foundation: cfClient}, syncer.options)
+	if err != nil {
+		return syncedFoundation{}, err
+	}
+	return syncedFoundation{foundation: foundations[foundation], lastSync: now, lastFullSync: now}, nil
+}
+
+// syncChanges returns a synced foundation with the apps that changed since a
+// time fetched again, deleted apps removed and new apps added at the end
+func syncChanges(foundation string, cfClient cf.IClient, lister changesLister, synced Foundation, since time.Time, options Options) (changed Foundation, err error) {
+	foundationScrape := FoundationScrape{Foundation: foundation, Incremental: true}
+	start := time.Now()
+	defer func() {
+		foundationScrape.Duration = time.Since(start)
+		foundationScrape.Lists = takeListStats(cfClient)
+		if err != nil {
+			foundationScrape.Error = err.Error()
+		} else {
+			logListStats(foundation, foundationScrape.Lists)
+		}
+		options.Telemetry.recordFoundation(foundationScrape, cfClient)
+	}()
+
+	if err := cfClient.ReAuth(); err != nil {
+		return Foundation{}, err
+	}
+	foundationScrape.Authenticated = true
+
+	events, err := lister.ListAppChanges(since)
+	if err != nil {
+		return Foundation{}, err
+	}
+
+	// changedApps maps app GUID to the app, or nil if it was deleted
+	changedApps := map[string]*gocf.App{}
+	for _, event := range events {
+		if _, fetched := changedApps[event.Actee]; fetched {
+			continue
+		}
+		app, found, err := lister.GetApp(event.Actee)
+		if err != nil {
+			return Foundation{}, err
+		}
+		if !found {
+			changedApps[event.Actee] = nil
+			continue
+		}
+		if _, ok := synced.GoCFSpaces[app.SpaceGuid]; !ok {
+			return Foundation{}, fmt.Errorf("app %s is in space %s, which was created since the last full sync", app.Guid, app.SpaceGuid)
+		}
+		changedApps[event.Actee] = &app
+	}
+
+	buildpacks, err := cfClient.GetBuildpacks()
+	if err != nil {
+		return Foundation{}, err
+	}
+
+	apps := []gocf.App{}
+	for _, app := range synced.GoCFApps {
+		changedApp, wasChanged := changedApps[app.Guid]
+		if !wasChanged {
+			apps = append(apps, app)
+		} else if changedApp != nil {
+			apps = append(apps, *changedApp)
+		}
+	}
+	added := map[string]bool{}
+	for _, app := range apps {
+		added[app.Guid] = true
+	}
+	for _, event := range events {
+		if changedApp := changedApps[event.Actee]; changedApp != nil && !added[event.Actee] {
+			apps = append(apps, *changedApp)
+			added[event.Actee] = true
+		}
+	}
+
+	changed = synced
+	changed.GoCFApps = apps
+	changed.GoCFBuildpacks = buildpacks
+
+	if options.InstanceHealth {
+		appInstancesMapChannel := make(chan appInstancesMapElement, 1)
+		getAppInstancesAsync(foundation, cfClient, apps, options.instanceWorkers(), appInstancesMapChannel)
+		changed.GoCFAppInstances = (<-appInstancesMapChannel).appInstancesMap
+	}
+	if options.ResourceUsage {
+		appStatsMapChannel := make(chan appStatsMapElement, 1)
+		getAppStatsAsync(foundation, cfClient, apps, options.instanceWorkers(), appStatsMapChannel)
+		changed.GoCFAppStats = (<-appStatsMapChannel).appStatsMap
+	}
+	if options.Routes {
+		changed.GoCFAppRoutes = syncAppRoutes(foundation, cfClient, synced.GoCFAppRoutes, changedApps)
+	}
+
+	return changed, nil
+}
+
+// syncAppRoutes returns the app routes with the routes of changed apps
+// fetched again and those of deleted apps removed
+func syncAppRoutes(foundation string, cfClient cf.IClient, appRoutesMap map[string][]gocf.Route, changedApps map[string]*gocf.App) map[string][]gocf.Route {
+	synced := map[string][]gocf.Route{}
+	for appGUID, appRoutes := range appRoutesMap {
+		synced[appGUID] = appRoutes
+	}
+
+	for appGUID, changedApp := range changedApps {
+		delete(synced, appGUID)
+		if changedApp == nil {
+			continue
+		}
+		appRoutes, err := cfClient.GetAppRoutes(appGUID)
+		if err != nil {
+			log.Printf("could not fetch routes of app %s on %s: %s\n", appGUID, foundation, err)
+			continue
+		}
+		synced[appGUID] = appRoutes
+	}
+	return synced
+}
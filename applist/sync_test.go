@@ -0,0 +1,245 @@
+package applist_test
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	. "github.com/FidelityInternational/cf-loupe/applist"
+	"github.com/FidelityInternational/cf-loupe/cf"
+	"github.com/FidelityInternational/cf-loupe/helpers"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/types"
+)
+
+var _ = Describe("Syncer", func() {
+	var cc *helpers.FakeCloudController
+	var syncer *Syncer
+	var now time.Time
+
+	app := func(guid, name, spaceGUID, state string) helpers.V2Resource {
+		return helpers.V2Resource{
+			Metadata: map[string]interface{}{"guid": guid, "updated_at": "2017-08-12T16:41:45Z"},
+			Entity: map[string]interface{}{
+				"name":                    name,
+				"space_guid":              spaceGUID,
+				"state":                   state,
+				"instances":               1,
+				"memory":                  512,
+				"detected_buildpack_guid": "buildpack-1",
+			},
+		}
+	}
+	event := func(eventType, appGUID string, timestamp time.Time) helpers.V2Resource {
+		return helpers.V2Resource{
+			Metadata: map[string]interface{}{"guid": fmt.Sprintf("event-%s-%s", appGUID, eventType)},
+			Entity: map[string]interface{}{
+				"type":       eventType,
+				"actee":      appGUID,
+				"actee_type": "app",
+				"timestamp":  timestamp.UTC().Format(time.RFC3339),
+			},
+		}
+	}
+	appNames := func(appData AppData) []string {
+		names := []string{}
+		for _, app := range appData.Apps {
+			names = append(names, app.Name)
+		}
+		return names
+	}
+	// requestsDuring returns the paths requested while sync runs
+	requestsDuring := func(sync func()) []string {
+		before := len(cc.Requests())
+		sync()
+		return cc.Requests()[before:]
+	}
+	requestFor := func(path string) types.GomegaMatcher {
+		return ContainElement(HavePrefix(path + "?"))
+	}
+
+	BeforeEach(func() {
+		now = time.Date(2017, 8, 15, 12, 0, 0, 0, time.UTC)
+
+		cc = helpers.NewFakeCloudController()
+		cc.AddV2("/v2/organizations", helpers.V2Resource{
+			Metadata: map[string]interface{}{"guid": "org-1"},
+			Entity:   map[string]interface{}{"name": "org1"},
+		})
+		cc.AddV2("/v2/spaces", helpers.V2Resource{
+			Metadata: map[string]interface{}{"guid": "space-1"},
+			Entity:   map[string]interface{}{"name": "space1", "organization_guid": "org-1"},
+		})
+		cc.AddV2("/v2/buildpacks", helpers.V2Resource{
+			Metadata: map[string]interface{}{"guid": "buildpack-1"},
+			Entity:   map[string]interface{}{"name": "ruby_buildpack", "filename": "ruby_buildpack-cached-v1.7.40.zip"},
+		})
+		cc.AddV2("/v2/apps",
+			app("app-1", "possum", "space-1", "STARTED"),
+			app("app-2", "wombat", "space-1", "STARTED"),
+			app("app-3", "quokka", "space-1", "STARTED"),
+		)
+
+		clients, err := cf.BuildClientsFromEnvironment([]string{
+			"CF_USERNAME_1=admin",
+			"CF_PASSWORD_1=1234",
+			"CF_FOUNDATION_1=dev",
+			fmt.Sprintf("CF_API_1=%s", cc.Server.URL),
+		})
+		Expect(err).To(Succeed())
+		syncer = NewSyncer(clients, Options{}, time.Hour)
+
+		requests := requestsDuring(func() {
+			appData, err := syncer.BuildAppData(now)
+			Expect(err).To(Succeed())
+			Expect(appNames(appData)).To(Equal([]string{"possum", "wombat", "quokka"}))
+		})
+		Expect(requests).To(requestFor("/v2/organizations"))
+	})
+
+	AfterEach(func() {
+		cc.Close()
+	})
+
+	It("only fetches the apps that changed since the last sync", func() {
+		cc.RemoveV2("/v2/apps", "app-2")
+		cc.AddV2("/v2/apps", app("app-2", "wombat", "space-1", "STOPPED"))
+		cc.AddV2("/v2/events", event("audit.app.stop", "app-2", now.Add(time.Minute)))
+
+		var appData AppData
+		requests := requestsDuring(func() {
+			var err error
+			appData, err = syncer.BuildAppData(now.Add(2 * time.Minute))
+			Expect(err).To(Succeed())
+		})
+
+		Expect(appNames(appData)).To(Equal([]string{"possum", "wombat", "quokka"}))
+		Expect(appData.Apps[1].State).To(Equal("stopped"))
+		Expect(appData.Apps[0].Org).To(Equal("org1"))
+		Expect(appData.Apps[0].Space).To(Equal("space1"))
+
+		Expect(requests).To(requestFor("/v2/events"))
+		Expect(requests).To(ContainElement("/v2/apps/app-2"))
+		Expect(requests).To(requestFor("/v2/buildpacks"))
+		Expect(requests).NotTo(requestFor("/v2/apps"))
+		Expect(requests).NotTo(requestFor("/v2/organizations"))
+		Expect(requests).NotTo(requestFor("/v2/spaces"))
+	})
+
+	It("asks for the events and apps updated since a minute before the last sync", func() {
+		requests := requestsDuring(func() {
+			_, err := syncer.BuildAppData(now.Add(5 * time.Minute))
+			Expect(err).To(Succeed())
+		})
+		Expect(requests).To(ContainElement(ContainSubstring("timestamp%3E%3D2017-08-15T11%3A59%3A00Z")))
+		Expect(requests).To(ContainElement(ContainSubstring("updated_ats%5Bgte%5D=2017-08-15T11%3A59%3A00Z")))
+	})
+
+	It("fetches an app changed in the same second as the last sync once", func() {
+		cc.RemoveV2("/v2/apps", "app-2")
+		cc.AddV2("/v2/apps", app("app-2", "wombat", "space-1", "STOPPED"))
+		cc.AddV2("/v2/events",
+			event("audit.app.update", "app-2", now.Add(-time.Minute)),
+			event("audit.app.stop", "app-2", now.Add(-time.Minute)),
+		)
+		cc.AddV3("/v3/apps", map[string]interface{}{"guid": "app-2", "updated_at": now.Add(-time.Minute).Format(time.RFC3339)})
+
+		var appData AppData
+		requests := requestsDuring(func() {
+			var err error
+			appData, err = syncer.BuildAppData(now.Add(2 * time.Minute))
+			Expect(err).To(Succeed())
+		})
+
+		Expect(appData.Apps[1].State).To(Equal("stopped"))
+		appRequests := 0
+		for _, request := range requests {
+			if request == "/v2/apps/app-2" {
+				appRequests++
+			}
+		}
+		Expect(appRequests).To(Equal(1))
+	})
+
+	It("fetches the apps updated without an event", func() {
+		cc.RemoveV2("/v2/apps", "app-3")
+		cc.AddV2("/v2/apps", app("app-3", "quokka", "space-1", "STOPPED"))
+		cc.AddV3("/v3/apps",
+			map[string]interface{}{"guid": "app-1", "updated_at": "2017-08-12T16:41:45Z"},
+			map[string]interface{}{"guid": "app-3", "updated_at": now.Add(time.Minute).Format(time.RFC3339)},
+		)
+
+		var appData AppData
+		requests := requestsDuring(func() {
+			var err error
+			appData, err = syncer.BuildAppData(now.Add(2 * time.Minute))
+			Expect(err).To(Succeed())
+		})
+
+		Expect(appNames(appData)).To(Equal([]string{"possum", "wombat", "quokka"}))
+		Expect(appData.Apps[2].State).To(Equal("stopped"))
+		Expect(requests).To(ContainElement("/v2/apps/app-3"))
+		Expect(requests).NotTo(ContainElement("/v2/apps/app-1"))
+	})
+
+	It("removes deleted apps and adds created apps at the end", func() {
+		cc.RemoveV2("/v2/apps", "app-1")
+		cc.AddV2("/v2/apps", app("app-4", "numbat", "space-1", "STARTED"))
+		cc.AddV2("/v2/events",
+			event("audit.app.delete-request", "app-1", now.Add(time.Minute)),
+			event("audit.app.create", "app-4", now.Add(time.Minute)),
+		)
+
+		appData, err := syncer.BuildAppData(now.Add(2 * time.Minute))
+		Expect(err).To(Succeed())
+		Expect(appNames(appData)).To(Equal([]string{"wombat", "quokka", "numbat"}))
+	})
+
+	It("fetches everything when an app is in a space created since the last full sync", func() {
+		cc.AddV2("/v2/spaces", helpers.V2Resource{
+			Metadata: map[string]interface{}{"guid": "space-2"},
+			Entity:   map[string]interface{}{"name": "space2", "organization_guid": "org-1"},
+		})
+		cc.AddV2("/v2/apps", app("app-4", "numbat", "space-2", "STARTED"))
+		cc.AddV2("/v2/events", event("audit.app.create", "app-4", now.Add(time.Minute)))
+
+		var appData AppData
+		requests := requestsDuring(func() {
+			var err error
+			appData, err = syncer.BuildAppData(now.Add(2 * time.Minute))
+			Expect(err).To(Succeed())
+		})
+		Expect(requests).To(requestFor("/v2/spaces"))
+		Expect(appNames(appData)).To(ContainElement("numbat"))
+		Expect(appData.Apps[3].Space).To(Equal("space2"))
+	})
+
+	It("fetches everything when the changes can't be fetched", func() {
+		cc.Fail("/v2/events", http.StatusServiceUnavailable)
+
+		requests := requestsDuring(func() {
+			_, err := syncer.BuildAppData(now.Add(2 * time.Minute))
+			Expect(err).To(Succeed())
+		})
+		Expect(requests).To(requestFor("/v2/apps"))
+		Expect(requests).To(requestFor("/v2/organizations"))
+	})
+
+	It("fetches everything once the full sync interval has passed", func() {
+		requests := requestsDuring(func() {
+			_, err := syncer.BuildAppData(now.Add(time.Hour))
+			Expect(err).To(Succeed())
+		})
+		Expect(requests).NotTo(requestFor("/v2/events"))
+		Expect(requests).To(requestFor("/v2/organizations"))
+	})
+
+	It("returns an error when a foundation can't be fetched at all", func() {
+		cc.Fail("/v2/apps", http.StatusServiceUnavailable)
+
+		_, err := syncer.BuildAppData(now.Add(time.Hour))
+		Expect(err).To(MatchError(ContainSubstring("could not scrape dev")))
+	})
+})
@@ -0,0 +1,149 @@
+package applist
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/FidelityInternational/cf-loupe/cf"
+)
+
+// Scrape describes how the app data was fetched from every foundation
+type Scrape struct {
+	Start       time.Time
+	Duration    time.Duration
+	Error       string
+	Foundations []FoundationScrape
+}
+
+// FoundationScrape describes how a foundation was fetched. Lists are only
+// recorded for clients that time them.
+type FoundationScrape struct {
+	Foundation string
+	Duration   time.Duration
+	// Incremental is true if only the apps that changed were fetched
+	Incremental    bool
+	Authenticated  bool
+	TokenRefreshes int
+	Lists          []cf.ListStats
+	Error          string
+}
+
+// tokenRefreshCounter is a client that counts its token refreshes
+type tokenRefreshCounter interface {
+	TakeTokenRefreshes() int
+}
+
+// Telemetry keeps the last scrapes. The foundations fetched since the last
+// call to Finish make up the next scrape. A nil Telemetry records nothing.
+type Telemetry struct {
+	size int
+
+	mutex       sync.Mutex
+	foundations []FoundationScrape
+	scrapes     []Scrape
+	lastSuccess *Scrape
+	// latest maps foundation name to how it was last fetched
+	latest map[string]FoundationScrape
+}
+
+// NewTelemetry returns a Telemetry that keeps the last size scrapes
+func NewTelemetry(size int) *Telemetry {
+	return &Telemetry{size: size, latest: map[string]FoundationScrape{}}
+}
+
+// recordFoundation adds how a foundation was fetched to the current scrape,
+// along with the lists and token refreshes its client recorded
+func (telemetry *Telemetry) recordFoundation(foundationScrape FoundationScrape, cfClient cf.IClient) {
+	if counter, ok := cfClient.(tokenRefreshCounter); ok {
+		foundationScrape.TokenRefreshes = counter.TakeTokenRefreshes()
+	}
+	if telemetry == nil {
+		return
+	}
+
+	telemetry.mutex.Lock()
+	defer telemetry.mutex.Unlock()
+
+	telemetry.foundations = append(telemetry.foundations, foundationScrape)
+}
+
+// Finish records a scrape that started at a time, took duration and failed
+// with err, if not nil
+func (telemetry *Telemetry) Finish(start time.Time, duration time.Duration, err error) {
+	if telemetry == nil {
+		return
+	}
+
+	telemetry.mutex.Lock()
+	defer telemetry.mutex.Unlock()
+
+	scrape := Scrape{
+		Start:       start,
+		Duration:    duration,
+		Foundations: telemetry.foundations,
+	}
+	if scrape.Foundations == nil {
+		scrape.Foundations = []FoundationScrape{}
+	}
+	if err != nil {
+		scrape.Error = err.Error()
+	}
+	sort.SliceStable(scrape.Foundations, func(i, j int) bool {
+		return scrape.Foundations[i].Foundation < scrape.Foundations[j].Foundation
+	})
+	telemetry.foundations = nil
+	for _, foundationScrape := range scrape.Foundations {
+		telemetry.latest[foundationScrape.Foundation] = foundationScrape
+	}
+	if err == nil {
+		telemetry.lastSuccess = &scrape
+	}
+
+	telemetry.scrapes = append([]Scrape{scrape}, telemetry.scrapes...)
+	if len(telemetry.scrapes) > telemetry.size {
+		telemetry.scrapes = telemetry.scrapes[:telemetry.size]
+	}
+}
+
+// Scrapes returns the last scrapes, the latest first
+func (telemetry *Telemetry) Scrapes() []Scrape {
+	if telemetry == nil {
+		return []Scrape{}
+	}
+
+	telemetry.mutex.Lock()
+	defer telemetry.mutex.Unlock()
+
+	return append([]Scrape{}, telemetry.scrapes...)
+}
+
+// LastSuccess returns the last scrape that did not fail, or false if none has
+// succeeded yet
+func (telemetry *Telemetry) LastSuccess() (Scrape, bool) {
+	if telemetry == nil {
+		return Scrape{}, false
+	}
+
+	telemetry.mutex.Lock()
+	defer telemetry.mutex.Unlock()
+
+	if telemetry.lastSuccess == nil {
+		return Scrape{}, false
+	}
+	return *telemetry.lastSuccess, true
+}
+
+// LatestFoundation returns how a foundation was last fetched, or false if it
+// has not been yet
+func (telemetry *Telemetry) LatestFoundation(foundation string) (FoundationScrape, bool) {
+	if telemetry == nil {
+		return FoundationScrape{}, false
+	}
+
+	telemetry.mutex.Lock()
+	defer telemetry.mutex.Unlock()
+
+	foundationScrape, ok := telemetry.latest[foundation]
+	return foundationScrape, ok
+}
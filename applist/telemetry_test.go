@@ -0,0 +1,174 @@
+package applist_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	. "github.com/FidelityInternational/cf-loupe/applist"
+	"github.com/FidelityInternational/cf-loupe/cf"
+	"github.com/FidelityInternational/cf-loupe/helpers"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Telemetry", func() {
+	var cc *helpers.FakeCloudController
+	var cfClients map[string]cf.IClient
+	var telemetry *Telemetry
+	var now time.Time
+
+	BeforeEach(func() {
+		now = time.Date(2017, 8, 15, 12, 0, 0, 0, time.UTC)
+
+		cc = helpers.NewFakeCloudController()
+		cc.PageSize = 2
+		for i := 1; i <= 3; i++ {
+			cc.AddV2("/v2/apps", helpers.V2Resource{
+				Metadata: map[string]interface{}{"guid": fmt.Sprintf("app-%d", i), "updated_at": "2017-08-12T16:41:45Z"},
+				Entity:   map[string]interface{}{"name": fmt.Sprintf("app%d", i), "space_guid": "space-1", "state": "STARTED", "instances": 1},
+			})
+		}
+		cc.AddV2("/v2/spaces", helpers.V2Resource{
+			Metadata: map[string]interface{}{"guid": "space-1"},
+			Entity:   map[string]interface{}{"name": "space1", "organization_guid": "org-1"},
+		})
+		cc.AddV2("/v2/organizations", helpers.V2Resource{
+			Metadata: map[string]interface{}{"guid": "org-1"},
+			Entity:   map[string]interface{}{"name": "org1"},
+		})
+
+		var err error
+		cfClients, err = cf.BuildClientsFromEnvironment([]string{
+			"CF_USERNAME_1=admin",
+			"CF_PASSWORD_1=1234",
+			"CF_FOUNDATION_1=dev",
+			fmt.Sprintf("CF_API_1=%s", cc.Server.URL),
+			"CF_MAX_RETRIES_1=0",
+		})
+		Expect(err).To(Succeed())
+		telemetry = NewTelemetry(2)
+	})
+
+	AfterEach(func() {
+		cc.Close()
+	})
+
+	It("records how long each foundation and each of its lists took", func() {
+		start := time.Now()
+		_, err := BuildAppData(cfClients, now, Options{Telemetry: telemetry})
+		Expect(err).To(Succeed())
+		telemetry.Finish(start, time.Since(start), err)
+
+		scrapes := telemetry.Scrapes()
+		Expect(scrapes).To(HaveLen(1))
+		Expect(scrapes[0].Start).To(Equal(start))
+		Expect(scrapes[0].Error).To(BeEmpty())
+		Expect(scrapes[0].Foundations).To(HaveLen(1))
+
+		foundation := scrapes[0].Foundations[0]
+		Expect(foundation.Foundation).To(Equal("dev"))
+		Expect(foundation.Authenticated).To(BeTrue())
+		Expect(foundation.Incremental).To(BeFalse())
+		Expect(foundation.Duration).To(BeNumerically(">", 0))
+		Expect(foundation.Duration).To(BeNumerically("<=", scrapes[0].Duration))
+		Expect(foundation.Error).To(BeEmpty())
+
+		pages := map[string]int{}
+		for _, list := range foundation.Lists {
+			pages[list.Resource] = list.Pages
+		}
+		Expect(pages).To(HaveKeyWithValue("apps", 2))
+		Expect(pages).To(HaveKeyWithValue("spaces", 1))
+		Expect(pages).To(HaveKeyWithValue("organizations", 1))
+		Expect(pages).To(HaveKey("buildpacks"))
+	})
+
+	It("records the error of the foundation that failed", func() {
+		cc.Fail("/v2/apps", http.StatusServiceUnavailable)
+
+		start := time.Now()
+		_, err := BuildAppData(cfClients, now, Options{Telemetry: telemetry})
+		Expect(err).To(HaveOccurred())
+		telemetry.Finish(start, time.Since(start), err)
+
+		scrape := telemetry.Scrapes()[0]
+		Expect(scrape.Error).To(ContainSubstring("could not scrape dev"))
+		Expect(scrape.Foundations[0].Authenticated).To(BeTrue())
+		Expect(scrape.Foundations[0].Error).To(ContainSubstring("CF-InjectedFailure"))
+	})
+
+	It("counts token refreshes", func() {
+		start := time.Now()
+		_, err := BuildAppData(cfClients, now, Options{Telemetry: telemetry})
+		Expect(err).To(Succeed())
+		_, err = BuildAppData(cfClients, now, Options{Telemetry: telemetry})
+		Expect(err).To(Succeed())
+		telemetry.Finish(start, time.Since(start), err)
+
+		// The fake UAA's tokens expire at once, so every scrape refreshes them
+		foundations := telemetry.Scrapes()[0].Foundations
+		Expect(foundations).To(HaveLen(2))
+		Expect(foundations[1].TokenRefreshes).To(BeNumerically(">=", 1))
+	})
+
+	It("records incremental syncs", func() {
+		syncer := NewSyncer(cfClients, Options{Telemetry: telemetry}, time.Hour)
+		_, err := syncer.BuildAppData(now)
+		Expect(err).To(Succeed())
+		telemetry.Finish(time.Now(), time.Second, err)
+		_, err = syncer.BuildAppData(now.Add(time.Minute))
+		Expect(err).To(Succeed())
+		telemetry.Finish(time.Now(), time.Second, err)
+
+		scrapes := telemetry.Scrapes()
+		Expect(scrapes[0].Foundations[0].Incremental).To(BeTrue())
+		Expect(scrapes[1].Foundations[0].Incremental).To(BeFalse())
+	})
+
+	It("keeps the last scrapes, the latest first", func() {
+		for i := 0; i < 3; i++ {
+			telemetry.Finish(now.Add(time.Duration(i)*time.Minute), time.Second, errors.New("nothing to scrape"))
+		}
+
+		scrapes := telemetry.Scrapes()
+		Expect(scrapes).To(HaveLen(2))
+		Expect(scrapes[0].Start).To(Equal(now.Add(2 * time.Minute)))
+		Expect(scrapes[1].Start).To(Equal(now.Add(time.Minute)))
+		Expect(scrapes[0].Foundations).To(BeEmpty())
+	})
+
+	It("records nothing when nil", func() {
+		var telemetry *Telemetry
+		_, err := BuildAppData(cfClients, now, Options{Telemetry: telemetry})
+		Expect(err).To(Succeed())
+		telemetry.Finish(now, time.Second, err)
+		Expect(telemetry.Scrapes()).To(BeEmpty())
+	})
+
+	It("keeps the last successful scrape and how each foundation was last fetched", func() {
+		_, ok := telemetry.LastSuccess()
+		Expect(ok).To(BeFalse())
+
+		_, err := BuildAppData(cfClients, now, Options{Telemetry: telemetry})
+		Expect(err).To(Succeed())
+		telemetry.Finish(now, time.Second, err)
+
+		cc.Fail("/v2/apps", http.StatusServiceUnavailable)
+		_, err = BuildAppData(cfClients, now, Options{Telemetry: telemetry})
+		Expect(err).To(HaveOccurred())
+		telemetry.Finish(now.Add(time.Minute), time.Second, err)
+
+		lastSuccess, ok := telemetry.LastSuccess()
+		Expect(ok).To(BeTrue())
+		Expect(lastSuccess.Start).To(Equal(now))
+
+		foundation, ok := telemetry.LatestFoundation("dev")
+		Expect(ok).To(BeTrue())
+		Expect(foundation.Error).To(ContainSubstring("CF-InjectedFailure"))
+		_, ok = telemetry.LatestFoundation("prod")
+		Expect(ok).To(BeFalse())
+	})
+})
@@ -0,0 +1,208 @@
+package applist
+
+import (
+	"sort"
+
+	gocf "github.com/cloudfoundry-community/go-cfclient"
+)
+
+// ResourceUsage contains the resource usage of an app, summed across its instances
+type ResourceUsage struct {
+	UsageTotals
+	Instances map[string]InstanceUsage
+}
+
+// InstanceUsage contains the resource usage of a single app instance
+type InstanceUsage struct {
+	CPU              float64 // fraction of a CPU core
+	MemoryBytes      int
+	MemoryQuotaBytes int
+	DiskBytes        int
+	DiskQuotaBytes   int
+}
+
+// UsageTotals sums resource usage and quotas
+type UsageTotals struct {
+	CPU              float64
+	MemoryBytes      int
+	MemoryQuotaBytes int
+	DiskBytes        int
+	DiskQuotaBytes   int
+}
+
+// MemoryPercent returns the memory used as a percentage of the memory quota
+func (totals UsageTotals) MemoryPercent() float64 {
+	if totals.MemoryQuotaBytes == 0 {
+		return 0
+	}
+	return float64(totals.MemoryBytes) / float64(totals.MemoryQuotaBytes) * 100
+}
+
+// DiskPercent returns the disk used as a percentage of the disk quota
+func (totals UsageTotals) DiskPercent() float64 {
+	if totals.DiskQuotaBytes == 0 {
+		return 0
+	}
+	return float64(totals.DiskBytes) / float64(totals.DiskQuotaBytes) * 100
+}
+
+func (totals *UsageTotals) add(other UsageTotals) {
+	totals.CPU += other.CPU
+	totals.MemoryBytes += other.MemoryBytes
+	totals.MemoryQuotaBytes += other.MemoryQuotaBytes
+	totals.DiskBytes += other.DiskBytes
+	totals.DiskQuotaBytes += other.DiskQuotaBytes
+}
+
+// OrgUsage contains the resource usage of every app in an org
+type OrgUsage struct {
+	Foundation string
+	Org        string
+	Apps       int
+	UsageTotals
+}
+
+// SpaceUsage contains the resource usage of every app in a space
+type SpaceUsage struct {
+	Foundation string
+	Org        string
+	Space      string
+	Apps       int
+	UsageTotals
+}
+
+// UsageReport contains resource usage aggregated per org and per space
+type UsageReport struct {
+	Orgs   []OrgUsage
+	Spaces []SpaceUsage
+}
+
+// RightSizingCandidate is an app using less memory than the report threshold
+type RightSizingCandidate struct {
+	Name          string
+	Foundation    string
+	Org           string
+	Space         string
+	Instances     int
+	MemoryMB      int
+	MemoryPercent float64
+}
+
+func buildResourceUsage(appStats map[string]gocf.AppStats) *ResourceUsage {
+	if appStats == nil {
+		return nil
+	}
+
+	usage := ResourceUsage{
+		Instances: map[string]InstanceUsage{},
+	}
+
+	for index, instanceStats := range appStats {
+		instanceUsage := InstanceUsage{
+			CPU:              instanceStats.Stats.Usage.CPU,
+			MemoryBytes:      instanceStats.Stats.Usage.Mem,
+			MemoryQuotaBytes: instanceStats.Stats.MemQuota,
+			DiskBytes:        instanceStats.Stats.Usage.Disk,
+			DiskQuotaBytes:   instanceStats.Stats.DiskQuota,
+		}
+		usage.Instances[index] = instanceUsage
+		usage.add(UsageTotals(instanceUsage))
+	}
+
+	return &usage
+}
+
+// BuildUsageReport aggregates the resource usage of apps per org and per space.
+// Apps without resource usage are left out.
+func BuildUsageReport(apps []App) UsageReport {
+	orgsMap := map[[2]string]*OrgUsage{}
+	spacesMap := map[[3]string]*SpaceUsage{}
+
+	for _, app := range apps {
+		if app.Usage == nil {
+			continue
+		}
+
+		orgKey := [2]string{app.Foundation, app.Org}
+		orgUsage, ok := orgsMap[orgKey]
+		if !ok {
+			orgUsage = &OrgUsage{Foundation: app.Foundation, Org: app.Org}
+			orgsMap[orgKey] = orgUsage
+		}
+		orgUsage.Apps++
+		orgUsage.add(app.Usage.UsageTotals)
+
+		spaceKey := [3]string{app.Foundation, app.Org, app.Space}
+		spaceUsage, ok := spacesMap[spaceKey]
+		if !ok {
+			spaceUsage = &SpaceUsage{Foundation: app.Foundation, Org: app.Org, Space: app.Space}
+			spacesMap[spaceKey] = spaceUsage
+		}
+		spaceUsage.Apps++
+		spaceUsage.add(app.Usage.UsageTotals)
+	}
+
+	report := UsageReport{
+		Orgs:   []OrgUsage{},
+		Spaces: []SpaceUsage{},
+	}
+	for _, orgUsage := range orgsMap {
+		report.Orgs = append(report.Orgs, *orgUsage)
+	}
+	for _, spaceUsage := range spacesMap {
+		report.Spaces = append(report.Spaces, *spaceUsage)
+	}
+
+	sort.Slice(report.Orgs, func(i, j int) bool {
+		a, b := report.Orgs[i], report.Orgs[j]
+		if a.Foundation != b.Foundation {
+			return a.Foundation < b.Foundation
+		}
+		return a.Org < b.Org
+	})
+	sort.Slice(report.Spaces, func(i, j int) bool {
+		a, b := report.Spaces[i], report.Spaces[j]
+		if a.Foundation != b.Foundation {
+			return a.Foundation < b.Foundation
+		}
+		if a.Org != b.Org {
+			return a.Org < b.Org
+		}
+		return a.Space < b.Space
+	})
+
+	return report
+}
+
+// BuildRightSizingReport returns the apps using less than thresholdPercent of
+// their memory quota, least used first
+func BuildRightSizingReport(apps []App, thresholdPercent float64) []RightSizingCandidate {
+	candidates := []RightSizingCandidate{}
+
+	for _, app := range apps {
+		if app.Usage == nil || app.Usage.MemoryQuotaBytes == 0 {
+			continue
+		}
+
+		memoryPercent := app.Usage.MemoryPercent()
+		if memoryPercent >= thresholdPercent {
+			continue
+		}
+
+		candidates = append(candidates, RightSizingCandidate{
+			Name:          app.Name,
+			Foundation:    app.Foundation,
+			Org:           app.Org,
+			Space:         app.Space,
+			Instances:     app.Instances,
+			MemoryMB:      app.MemoryMB,
+			MemoryPercent: memoryPercent,
+		})
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].MemoryPercent < candidates[j].MemoryPercent
+	})
+
+	return candidates
+}
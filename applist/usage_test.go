@@ -0,0 +1,115 @@
+package applist_test
+
+import (
+	"time"
+
+	. "github.com/FidelityInternational/cf-loupe/applist"
+	gocf "github.com/cloudfoundry-community/go-cfclient"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func appStats(cpu float64, mem, memQuota, disk, diskQuota int) gocf.AppStats {
+	var stats gocf.AppStats
+	stats.State = "RUNNING"
+	stats.Stats.Usage.CPU = cpu
+	stats.Stats.Usage.Mem = mem
+	stats.Stats.MemQuota = memQuota
+	stats.Stats.Usage.Disk = disk
+	stats.Stats.DiskQuota = diskQuota
+	return stats
+}
+
+var _ = Describe("Usage", func() {
+	var apps []App
+
+	BeforeEach(func() {
+		foundation := Foundation{
+			GoCFApps: []gocf.App{
+				{Guid: "app1-guid", Name: "app1", UpdatedAt: "2017-08-12T16:41:45Z", DetectedBuildpackGuid: "def456", SpaceGuid: "space1", Instances: 2, Memory: 1024, State: "STARTED"},
+				{Guid: "app2-guid", Name: "app2", UpdatedAt: "2017-08-12T16:41:45Z", DetectedBuildpackGuid: "def456", SpaceGuid: "space1", Instances: 1, Memory: 1024, State: "STARTED"},
+				{Guid: "app3-guid", Name: "app3", UpdatedAt: "2017-08-12T16:41:45Z", DetectedBuildpackGuid: "def456", SpaceGuid: "space2", Instances: 1, Memory: 1024, State: "STARTED"},
+				{Guid: "app4-guid", Name: "app4", UpdatedAt: "2017-08-12T16:41:45Z", DetectedBuildpackGuid: "def456", SpaceGuid: "space2", Instances: 1, Memory: 1024, State: "STOPPED"},
+			},
+			GoCFBuildpacks: map[string]gocf.Buildpack{
+				"def456": {
+					Name:     "java_buildpack",
+					Filename: "java-buildpack-v1_19-fidelity-abc1234.zip",
+				},
+			},
+			GoCFOrgs: map[string]gocf.Org{
+				"abc123": {
+					Name: "APP1234-project-x",
+				},
+			},
+			GoCFSpaces: map[string]gocf.Space{
+				"space1": {
+					Name:             "DEV",
+					OrganizationGuid: "abc123",
+				},
+				"space2": {
+					Name:             "TEST",
+					OrganizationGuid: "abc123",
+				},
+			},
+			GoCFAppStats: map[string]map[string]gocf.AppStats{
+				"app1-guid": {
+					"0": appStats(0.5, 100, 1000, 10, 100),
+					"1": appStats(0.25, 100, 1000, 20, 100),
+				},
+				"app2-guid": {
+					"0": appStats(0.1, 900, 1000, 50, 100),
+				},
+				"app3-guid": {
+					"0": appStats(0.1, 300, 1000, 50, 100),
+				},
+			},
+		}
+
+		currentTime, _ := time.Parse(time.RFC3339, "2017-08-24T12:00:00Z")
+		var err error
+		apps, err = BuildAppList(foundation, currentTime, "dev")
+		Expect(err).To(Succeed())
+	})
+
+	It("sums the usage of each app across its instances", func() {
+		Expect(apps[0].Usage.Instances).To(HaveLen(2))
+		Expect(apps[0].Usage.CPU).To(Equal(0.75))
+		Expect(apps[0].Usage.MemoryBytes).To(Equal(200))
+		Expect(apps[0].Usage.MemoryQuotaBytes).To(Equal(2000))
+		Expect(apps[0].Usage.DiskBytes).To(Equal(30))
+		Expect(apps[0].Usage.DiskQuotaBytes).To(Equal(200))
+		Expect(apps[0].Usage.MemoryPercent()).To(Equal(10.0))
+		Expect(apps[0].Usage.DiskPercent()).To(Equal(15.0))
+		Expect(apps[3].Usage).To(BeNil())
+	})
+
+	It("aggregates usage per org and per space", func() {
+		report := BuildUsageReport(apps)
+
+		Expect(report.Orgs).To(HaveLen(1))
+		Expect(report.Orgs[0].Org).To(Equal("APP1234-project-x"))
+		Expect(report.Orgs[0].Apps).To(Equal(3))
+		Expect(report.Orgs[0].MemoryBytes).To(Equal(1400))
+		Expect(report.Orgs[0].MemoryQuotaBytes).To(Equal(4000))
+
+		Expect(report.Spaces).To(HaveLen(2))
+		Expect(report.Spaces[0].Space).To(Equal("DEV"))
+		Expect(report.Spaces[0].Apps).To(Equal(2))
+		Expect(report.Spaces[0].MemoryBytes).To(Equal(1100))
+		Expect(report.Spaces[1].Space).To(Equal("TEST"))
+		Expect(report.Spaces[1].Apps).To(Equal(1))
+		Expect(report.Spaces[1].MemoryBytes).To(Equal(300))
+	})
+
+	It("lists the apps using less than the threshold of their memory quota", func() {
+		candidates := BuildRightSizingReport(apps, 50)
+
+		Expect(candidates).To(HaveLen(2))
+		Expect(candidates[0].Name).To(Equal("app1"))
+		Expect(candidates[0].MemoryPercent).To(Equal(10.0))
+		Expect(candidates[1].Name).To(Equal("app3"))
+		Expect(candidates[1].MemoryPercent).To(Equal(30.0))
+	})
+})
@@ -0,0 +1,170 @@
+package applist
+
+import (
+	"strings"
+)
+
+// Visibility is the set of orgs and spaces a viewer is allowed to see
+type Visibility struct {
+	// All is true for admins, who see every foundation
+	All bool
+	// Orgs contains "foundation/org" keys of orgs whose spaces are all visible
+	Orgs map[string]bool
+	// Spaces contains "foundation/org/space" keys of individually visible spaces
+	Spaces map[string]bool
+	// Foundations, if not nil, limits everything above to these foundations
+	Foundations map[string]bool
+}
+
+// FullVisibility lets the viewer see everything
+func FullVisibility() Visibility {
+	return Visibility{All: true}
+}
+
+// NewVisibility returns an empty visibility that orgs and spaces can be added to
+func NewVisibility() Visibility {
+	return Visibility{
+		Orgs:   map[string]bool{},
+		Spaces: map[string]bool{},
+	}
+}
+
+// LimitToFoundations returns a copy of the visibility that only sees the given foundations
+func (visibility Visibility) LimitToFoundations(foundations []string) Visibility {
+	visibility.Foundations = map[string]bool{}
+	for _, foundation := range foundations {
+		visibility.Foundations[foundation] = true
+	}
+	return visibility
+}
+
+// IsEverything returns true if nothing is hidden
+func (visibility Visibility) IsEverything() bool {
+	return visibility.All && visibility.Foundations == nil
+}
+
+func (visibility Visibility) inFoundations(foundation string) bool {
+	return visibility.Foundations == nil || visibility.Foundations[foundation]
+}
+
+// AddOrg makes every space of an org visible
+func (visibility Visibility) AddOrg(foundation, org string) {
+	visibility.Orgs[foundation+"/"+org] = true
+}
+
+// AddSpace makes a single space visible
+func (visibility Visibility) AddSpace(foundation, org, space string) {
+	visibility.Spaces[foundation+"/"+org+"/"+space] = true
+}
+
+// CanSeeOrg returns true if the whole of an org is visible
+func (visibility Visibility) CanSeeOrg(foundation, org string) bool {
+	if !visibility.inFoundations(foundation) {
+		return false
+	}
+	return visibility.All || visibility.Orgs[foundation+"/"+org]
+}
+
+// CanSeeSpace returns true if a space is visible, either on its own or as part of its org
+func (visibility Visibility) CanSeeSpace(foundation, org, space string) bool {
+	if !visibility.inFoundations(foundation) {
+		return false
+	}
+	return visibility.CanSeeOrg(foundation, org) || visibility.Spaces[foundation+"/"+org+"/"+space]
+}
+
+// CanSeeFoundation returns true if anything in a foundation is visible
+func (visibility Visibility) CanSeeFoundation(foundation string) bool {
+	if !visibility.inFoundations(foundation) {
+		return false
+	}
+	if visibility.All {
+		return true
+	}
+	for _, keys := range []map[string]bool{visibility.Orgs, visibility.Spaces} {
+		for key := range keys {
+			if strings.HasPrefix(key, foundation+"/") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// FilterApps returns the apps in visible spaces
+func (visibility Visibility) FilterApps(apps []App) []App {
+	if visibility.IsEverything() {
+		return apps
+	}
+
+	filtered := []App{}
+	for _, app := range apps {
+		if visibility.CanSeeSpace(app.Foundation, app.Org, app.Space) {
+			filtered = append(filtered, app)
+		}
+	}
+	return filtered
+}
+
+// Filter returns the part of the app data a viewer can see. The summary is
+// rebuilt from the visible apps and org capacity is only shown to viewers of
+// the whole org. Service plan usage is counted across a foundation, so it is
+// kept for every foundation the viewer can see something in.
+func (visibility Visibility) Filter(appData AppData) AppData {
+	if visibility.IsEverything() {
+		return appData
+	}
+
+	apps := visibility.FilterApps(appData.Apps)
+	filtered := AppData{
+		Apps:    apps,
+		Summary: BuildSummary(apps),
+	}
+
+	if appData.Capacity != nil {
+		capacity := &CapacityReport{Orgs: []OrgCapacity{}, Spaces: []SpaceCapacity{}}
+		for _, org := range appData.Capacity.Orgs {
+			if visibility.CanSeeOrg(org.Foundation, org.Org) {
+				capacity.Orgs = append(capacity.Orgs, org)
+			}
+		}
+		for _, space := range appData.Capacity.Spaces {
+			if visibility.CanSeeSpace(space.Foundation, space.Org, space.Space) {
+				capacity.Spaces = append(capacity.Spaces, space)
+			}
+		}
+		filtered.Capacity = capacity
+	}
+
+	if appData.Routes != nil {
+		routes := &RouteReport{OrphanedRoutes: []OrphanedRoute{}, UnroutedApps: []UnroutedApp{}}
+		for _, route := range appData.Routes.OrphanedRoutes {
+			if visibility.CanSeeSpace(route.Foundation, route.Org, route.Space) {
+				routes.OrphanedRoutes = append(routes.OrphanedRoutes, route)
+			}
+		}
+		for _, app := range appData.Routes.UnroutedApps {
+			if visibility.CanSeeSpace(app.Foundation, app.Org, app.Space) {
+				routes.UnroutedApps = append(routes.UnroutedApps, app)
+			}
+		}
+		filtered.Routes = routes
+	}
+
+	if appData.Services != nil {
+		services := &ServicesReport{Plans: []ServicePlanUsage{}, UnboundInstances: []UnboundServiceInstance{}}
+		for _, plan := range appData.Services.Plans {
+			if visibility.CanSeeFoundation(plan.Foundation) {
+				services.Plans = append(services.Plans, plan)
+			}
+		}
+		for _, instance := range appData.Services.UnboundInstances {
+			if visibility.CanSeeSpace(instance.Foundation, instance.Org, instance.Space) {
+				services.UnboundInstances = append(services.UnboundInstances, instance)
+			}
+		}
+		filtered.Services = services
+	}
+
+	return filtered
+}
@@ -0,0 +1,125 @@
+package applist_test
+
+import (
+	. "github.com/FidelityInternational/cf-loupe/applist"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Visibility", func() {
+	var appData AppData
+	var visibility Visibility
+
+	BeforeEach(func() {
+		apps := []App{
+			{Name: "app1", Foundation: "cf1", Org: "team-a", Space: "dev", IsStale: true},
+			{Name: "app2", Foundation: "cf1", Org: "team-a", Space: "prod"},
+			{Name: "app3", Foundation: "cf1", Org: "team-b", Space: "dev"},
+			{Name: "app4", Foundation: "cf2", Org: "team-a", Space: "dev"},
+		}
+		appData = AppData{
+			Apps:    apps,
+			Summary: BuildSummary(apps),
+			Capacity: &CapacityReport{
+				Orgs: []OrgCapacity{
+					{Foundation: "cf1", Org: "team-a"},
+					{Foundation: "cf1", Org: "team-b"},
+				},
+				Spaces: []SpaceCapacity{
+					{Foundation: "cf1", Org: "team-a", Space: "dev"},
+					{Foundation: "cf1", Org: "team-b", Space: "dev"},
+				},
+			},
+			Routes: &RouteReport{
+				OrphanedRoutes: []OrphanedRoute{
+					{URL: "a.example.com", Foundation: "cf1", Org: "team-a", Space: "prod"},
+					{URL: "b.example.com", Foundation: "cf1", Org: "team-b", Space: "dev"},
+				},
+				UnroutedApps: []UnroutedApp{},
+			},
+			Services: &ServicesReport{
+				Plans: []ServicePlanUsage{
+					{Foundation: "cf1", Service: "mysql", Plan: "small"},
+					{Foundation: "cf2", Service: "mysql", Plan: "small"},
+				},
+				UnboundInstances: []UnboundServiceInstance{
+					{Name: "db-a", Foundation: "cf1", Org: "team-a", Space: "dev"},
+					{Name: "db-b", Foundation: "cf1", Org: "team-b", Space: "dev"},
+				},
+			},
+		}
+	})
+
+	Context("when the viewer is an admin", func() {
+		BeforeEach(func() {
+			visibility = FullVisibility()
+		})
+
+		It("returns everything", func() {
+			Expect(visibility.Filter(appData)).To(Equal(appData))
+		})
+	})
+
+	Context("when the viewer is limited to a foundation", func() {
+		BeforeEach(func() {
+			visibility = FullVisibility().LimitToFoundations([]string{"cf2"})
+		})
+
+		It("only returns what is in that foundation", func() {
+			filtered := visibility.Filter(appData)
+
+			Expect(filtered.Apps).To(HaveLen(1))
+			Expect(filtered.Apps[0].Name).To(Equal("app4"))
+			Expect(filtered.Capacity.Orgs).To(BeEmpty())
+			Expect(filtered.Services.Plans).To(Equal([]ServicePlanUsage{{Foundation: "cf2", Service: "mysql", Plan: "small"}}))
+		})
+	})
+
+	Context("when the viewer can see an org and a space of another org", func() {
+		BeforeEach(func() {
+			visibility = NewVisibility()
+			visibility.AddOrg("cf1", "team-a")
+			visibility.AddSpace("cf2", "team-a", "dev")
+		})
+
+		It("only returns apps in visible spaces and rebuilds the summary", func() {
+			filtered := visibility.Filter(appData)
+
+			Expect(filtered.Apps).To(HaveLen(3))
+			Expect(filtered.Apps[0].Name).To(Equal("app1"))
+			Expect(filtered.Apps[1].Name).To(Equal("app2"))
+			Expect(filtered.Apps[2].Name).To(Equal("app4"))
+			Expect(filtered.Summary.TotalApps).To(Equal(3))
+			Expect(filtered.Summary.StaleApps).To(Equal(1))
+		})
+
+		It("only returns the capacity of visible orgs and spaces", func() {
+			filtered := visibility.Filter(appData)
+
+			Expect(filtered.Capacity.Orgs).To(Equal([]OrgCapacity{{Foundation: "cf1", Org: "team-a"}}))
+			Expect(filtered.Capacity.Spaces).To(Equal([]SpaceCapacity{{Foundation: "cf1", Org: "team-a", Space: "dev"}}))
+		})
+
+		It("only returns routes and service instances in visible spaces", func() {
+			filtered := visibility.Filter(appData)
+
+			Expect(filtered.Routes.OrphanedRoutes).To(HaveLen(1))
+			Expect(filtered.Routes.OrphanedRoutes[0].URL).To(Equal("a.example.com"))
+			Expect(filtered.Services.UnboundInstances).To(HaveLen(1))
+			Expect(filtered.Services.UnboundInstances[0].Name).To(Equal("db-a"))
+			Expect(filtered.Services.Plans).To(HaveLen(2))
+		})
+
+		It("does not show org capacity to viewers of a single space", func() {
+			visibility = NewVisibility()
+			visibility.AddSpace("cf1", "team-b", "dev")
+
+			filtered := visibility.Filter(appData)
+
+			Expect(filtered.Capacity.Orgs).To(BeEmpty())
+			Expect(filtered.Capacity.Spaces).To(HaveLen(1))
+			Expect(filtered.Services.Plans).To(Equal([]ServicePlanUsage{{Foundation: "cf1", Service: "mysql", Plan: "small"}}))
+		})
+	})
+})
@@ -0,0 +1,193 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Authentication modes
+const (
+	ModeBasic = "basic" // static users
+	ModeOIDC  = "oidc"  // any OpenID Connect issuer, including the UAA of a foundation
+)
+
+const defaultSessionTTL = 8 * time.Hour
+
+type contextKey struct{}
+
+// Options configures who can see the dashboard
+type Options struct {
+	// Mode is basic or oidc. Anyone can see the dashboard if it is empty,
+	// unless there are API tokens.
+	Mode string
+
+	// Users maps username to password in basic mode
+	Users map[string]string
+
+	// Issuer is the OpenID Connect issuer whose discovery document is at
+	// <Issuer>/.well-known/openid-configuration
+	Issuer string
+	// CFAPI is a Cloud Foundry API whose UAA is used as the issuer if Issuer is empty
+	CFAPI        string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	// ExternalURL is the URL the dashboard is reached at, used to build the
+	// login callback URL
+	ExternalURL string
+
+	// SessionSecret signs the session cookies. A random one is used if it is
+	// empty, so sessions do not survive a restart.
+	SessionSecret string
+	SessionTTL    time.Duration
+
+	// Tokens can call the dashboard with a bearer token in any mode
+	Tokens []Token
+	// ReadOnlyPaths are POST endpoints that only read, so tokens may call them
+	ReadOnlyPaths []string
+	// PublicPaths are served to anyone, such as health checks
+	PublicPaths []string
+}
+
+// Enabled returns true if the dashboard requires authentication
+func (options Options) Enabled() bool {
+	return options.Mode != "" || len(options.Tokens) > 0
+}
+
+// Authenticator protects a handler with basic or OpenID Connect authentication
+type Authenticator struct {
+	options Options
+	secret  []byte
+	timeNow func() time.Time
+	oidc    *oidcClient
+}
+
+// NewAuthenticator returns an authenticator for the configured mode
+func NewAuthenticator(options Options, timeNow func() time.Time) *Authenticator {
+	secret := []byte(options.SessionSecret)
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		rand.Read(secret)
+	}
+	if options.SessionTTL <= 0 {
+		options.SessionTTL = defaultSessionTTL
+	}
+
+	authenticator := &Authenticator{
+		options: options,
+		secret:  secret,
+		timeNow: timeNow,
+	}
+	if options.Mode == ModeOIDC {
+		authenticator.oidc = newOIDCClient(options)
+	}
+	return authenticator
+}
+
+// UserFromContext returns the authenticated user of a request
+func UserFromContext(ctx context.Context) (User, bool) {
+	user, ok := ctx.Value(contextKey{}).(User)
+	return user, ok
+}
+
+// WithUser returns a copy of a context carrying a user
+func WithUser(ctx context.Context, user User) context.Context {
+	return context.WithValue(ctx, contextKey{}, user)
+}
+
+// Wrap returns a handler that only lets authenticated requests through to the
+// dashboard. The login pages, static assets and public paths are always
+// reachable.
+func (authenticator *Authenticator) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/assets/") || authenticator.publicPath(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if authenticator.oidc != nil {
+			switch r.URL.Path {
+			case "/login":
+				authenticator.login(w, r)
+				return
+			case "/callback":
+				authenticator.callback(w, r)
+				return
+			case "/logout":
+				clearCookie(w, sessionCookie)
+				http.Redirect(w, r, "/", http.StatusFound)
+				return
+			}
+		}
+
+		user, ok, err := authenticator.authenticateToken(r)
+		if err == errReadOnlyToken {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if !ok {
+			user, ok = authenticator.authenticate(r)
+		}
+		if !ok {
+			authenticator.challenge(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(WithUser(r.Context(), user)))
+	})
+}
+
+func (authenticator *Authenticator) authenticate(r *http.Request) (User, bool) {
+	switch authenticator.options.Mode {
+	case "":
+		return User{}, false
+	case ModeBasic:
+		username, password, ok := r.BasicAuth()
+		if !ok {
+			return User{}, false
+		}
+		expected, ok := authenticator.options.Users[username]
+		if !ok || subtle.ConstantTimeCompare([]byte(expected), []byte(password)) != 1 {
+			return User{}, false
+		}
+		return User{Subject: username, Name: username}, true
+	}
+
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return User{}, false
+	}
+	s, err := decodeSession(authenticator.secret, cookie.Value, authenticator.timeNow())
+	if err != nil {
+		return User{}, false
+	}
+	return s.User, true
+}
+
+// challenge asks browsers to log in and rejects other clients
+func (authenticator *Authenticator) challenge(w http.ResponseWriter, r *http.Request) {
+	if authenticator.options.Mode == ModeBasic {
+		w.Header().Set("WWW-Authenticate", `Basic realm="CF Loupe"`)
+		http.Error(w, "authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	if authenticator.oidc != nil && r.Method == "GET" && strings.Contains(r.Header.Get("Accept"), "text/html") {
+		http.Redirect(w, r, "/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+		return
+	}
+	http.Error(w, "authentication required", http.StatusUnauthorized)
+}
+
+func (authenticator *Authenticator) secureCookies() bool {
+	return strings.HasPrefix(authenticator.options.ExternalURL, "https://")
+}
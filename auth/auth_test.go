@@ -0,0 +1,203 @@
+package auth_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"time"
+
+	. "github.com/FidelityInternational/cf-loupe/auth"
+	"github.com/FidelityInternational/cf-loupe/helpers"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Authenticator", func() {
+	var now time.Time
+	var timeNow func() time.Time
+	var dashboard http.Handler
+
+	BeforeEach(func() {
+		now, _ = time.Parse(time.RFC3339, "2017-08-15T15:00:06Z")
+		timeNow = func() time.Time { return now }
+		dashboard = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, _ := UserFromContext(r.Context())
+			w.Write([]byte("hello " + user.Name))
+		})
+	})
+
+	get := func(client *http.Client, url string, accept string) (*http.Response, string) {
+		req, err := http.NewRequest("GET", url, nil)
+		Expect(err).To(Succeed())
+		req.Header.Set("Accept", accept)
+		resp, err := client.Do(req)
+		Expect(err).To(Succeed())
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		Expect(err).To(Succeed())
+		return resp, string(body)
+	}
+
+	Context("In basic mode", func() {
+		var server *httptest.Server
+
+		BeforeEach(func() {
+			authenticator := NewAuthenticator(Options{
+				Mode:        ModeBasic,
+				Users:       map[string]string{"alice": "s3cret"},
+				PublicPaths: []string{"/healthz"},
+			}, timeNow)
+			server = httptest.NewServer(authenticator.Wrap(dashboard))
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("asks for credentials", func() {
+			resp, _ := get(http.DefaultClient, server.URL+"/listapps", "application/json")
+			Expect(resp.StatusCode).To(Equal(http.StatusUnauthorized))
+			Expect(resp.Header.Get("WWW-Authenticate")).To(Equal(`Basic realm="CF Loupe"`))
+		})
+
+		It("lets known users through", func() {
+			req, _ := http.NewRequest("GET", server.URL+"/listapps", nil)
+			req.SetBasicAuth("alice", "s3cret")
+			resp, err := http.DefaultClient.Do(req)
+			Expect(err).To(Succeed())
+			body, _ := ioutil.ReadAll(resp.Body)
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(string(body)).To(Equal("hello alice"))
+		})
+
+		It("rejects a wrong password", func() {
+			req, _ := http.NewRequest("GET", server.URL+"/listapps", nil)
+			req.SetBasicAuth("alice", "guess")
+			resp, err := http.DefaultClient.Do(req)
+			Expect(err).To(Succeed())
+			Expect(resp.StatusCode).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("always serves the static assets", func() {
+			resp, _ := get(http.DefaultClient, server.URL+"/assets/loupe.jpg", "image/jpeg")
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		})
+
+		It("serves the public paths to anyone", func() {
+			resp, body := get(http.DefaultClient, server.URL+"/healthz", "application/json")
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(body).To(Equal("hello "))
+
+			resp, _ = get(http.DefaultClient, server.URL+"/healthz/more", "application/json")
+			Expect(resp.StatusCode).To(Equal(http.StatusUnauthorized))
+		})
+	})
+
+	Context("In oidc mode", func() {
+		var provider *helpers.FakeOIDCProvider
+		var server *httptest.Server
+		var options Options
+		var client *http.Client
+
+		BeforeEach(func() {
+			provider = helpers.NewFakeOIDCProvider(map[string]interface{}{
+				"sub":       "user-guid",
+				"user_name": "bob",
+				"email":     "bob@example.com",
+			})
+			options = Options{
+				Mode:          ModeOIDC,
+				Issuer:        provider.Server.URL,
+				ClientID:      "loupe",
+				ClientSecret:  "loupe-secret",
+				SessionSecret: "session-secret",
+				SessionTTL:    time.Hour,
+			}
+			jar, _ := cookiejar.New(nil)
+			client = &http.Client{Jar: jar}
+		})
+
+		JustBeforeEach(func() {
+			server = httptest.NewServer(NewAuthenticator(options, timeNow).Wrap(dashboard))
+		})
+
+		AfterEach(func() {
+			server.Close()
+			provider.Close()
+		})
+
+		It("logs browsers in through the issuer and back to the page they asked for", func() {
+			resp, body := get(client, server.URL+"/listapps?status=crashed", "text/html")
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(resp.Request.URL.RequestURI()).To(Equal("/listapps?status=crashed"))
+			Expect(body).To(Equal("hello bob"))
+
+			resp, body = get(client, server.URL+"/", "application/json")
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(body).To(Equal("hello bob"))
+		})
+
+		It("only goes back to pages on the dashboard", func() {
+			for _, next := range []string{"//evil.com", "/\\evil.com", "https://evil.com", "evil.com"} {
+				resp, body := get(client, server.URL+"/login?next="+url.QueryEscape(next), "text/html")
+				Expect(resp.StatusCode).To(Equal(http.StatusOK))
+				Expect(resp.Request.URL.Host).To(Equal(strings.TrimPrefix(server.URL, "http://")), next)
+				Expect(resp.Request.URL.Path).To(Equal("/"), next)
+				Expect(body).To(Equal("hello bob"))
+			}
+		})
+
+		It("rejects API clients without a session", func() {
+			resp, _ := get(client, server.URL+"/listapps", "application/json")
+			Expect(resp.StatusCode).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("expires sessions", func() {
+			get(client, server.URL+"/", "text/html")
+			now = now.Add(2 * time.Hour)
+
+			resp, _ := get(client, server.URL+"/", "application/json")
+			Expect(resp.StatusCode).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("rejects tampered sessions", func() {
+			req, _ := http.NewRequest("GET", server.URL+"/", nil)
+			req.AddCookie(&http.Cookie{Name: "loupe_session", Value: "eyJVc2VyIjp7Ik5hbWUiOiJhZG1pbiJ9fQ.forged"})
+			resp, err := http.DefaultClient.Do(req)
+			Expect(err).To(Succeed())
+			Expect(resp.StatusCode).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("logs users out", func() {
+			get(client, server.URL+"/", "text/html")
+			noRedirects := &http.Client{
+				Jar: client.Jar,
+				CheckRedirect: func(req *http.Request, via []*http.Request) error {
+					return http.ErrUseLastResponse
+				},
+			}
+			resp, _ := get(noRedirects, server.URL+"/logout", "text/html")
+			Expect(resp.StatusCode).To(Equal(http.StatusFound))
+
+			resp, _ = get(client, server.URL+"/", "application/json")
+			Expect(resp.StatusCode).To(Equal(http.StatusUnauthorized))
+		})
+
+		Context("When using the UAA of a foundation", func() {
+			BeforeEach(func() {
+				options.Issuer = ""
+				options.CFAPI = provider.Server.URL
+			})
+
+			It("finds the UAA through the Cloud Foundry API", func() {
+				resp, body := get(client, server.URL+"/", "text/html")
+				Expect(resp.StatusCode).To(Equal(http.StatusOK))
+				Expect(body).To(Equal("hello bob"))
+			})
+		})
+	})
+})
@@ -0,0 +1,242 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+const stateCookie = "loupe_oauth_state"
+
+var defaultScopes = []string{"openid", "email", "profile"}
+
+// discovery is the part of an OpenID Connect discovery document Loupe uses
+type discovery struct {
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+}
+
+// userinfo contains the claims of the userinfo endpoint. UAA returns the
+// username as user_name rather than preferred_username.
+type userinfo struct {
+	Subject           string   `json:"sub"`
+	Name              string   `json:"name"`
+	PreferredUsername string   `json:"preferred_username"`
+	UserName          string   `json:"user_name"`
+	Email             string   `json:"email"`
+	Groups            []string `json:"groups"`
+}
+
+type oidcClient struct {
+	options    Options
+	httpClient *http.Client
+
+	mutex     sync.Mutex
+	discovery *discovery
+}
+
+func newOIDCClient(options Options) *oidcClient {
+	return &oidcClient{
+		options:    options,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// discover fetches the issuer's endpoints once
+func (client *oidcClient) discover() (discovery, error) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if client.discovery != nil {
+		return *client.discovery, nil
+	}
+
+	issuer := client.options.Issuer
+	if issuer == "" {
+		var err error
+		if issuer, err = client.uaaIssuer(client.options.CFAPI); err != nil {
+			return discovery{}, fmt.Errorf("could not find the UAA of %s: %s", client.options.CFAPI, err)
+		}
+	}
+
+	var d discovery
+	discoveryURL := strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+	if err := client.getJSON(discoveryURL, "", &d); err != nil {
+		return discovery{}, fmt.Errorf("could not discover %s: %s", issuer, err)
+	}
+	client.discovery = &d
+	return d, nil
+}
+
+func (client *oidcClient) oauth2Config(d discovery, redirectURL string) *oauth2.Config {
+	scopes := client.options.Scopes
+	if len(scopes) == 0 {
+		scopes = defaultScopes
+	}
+
+	return &oauth2.Config{
+		ClientID:     client.options.ClientID,
+		ClientSecret: client.options.ClientSecret,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  d.AuthorizationEndpoint,
+			TokenURL: d.TokenEndpoint,
+		},
+		RedirectURL: redirectURL,
+		Scopes:      scopes,
+	}
+}
+
+func (client *oidcClient) getJSON(url, accessToken string, v interface{}) error {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+
+	resp, err := client.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// login redirects to the issuer, remembering where to go back to
+func (authenticator *Authenticator) login(w http.ResponseWriter, r *http.Request) {
+	d, err := authenticator.oidc.discover()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	stateBytes := make([]byte, 16)
+	rand.Read(stateBytes)
+	state := hex.EncodeToString(stateBytes)
+
+	next := r.URL.Query().Get("next")
+	if !isLocalPath(next) {
+		next = "/"
+	}
+
+	setCookie(w, stateCookie, state+"|"+next, 10*time.Minute, authenticator.secureCookies())
+	config := authenticator.oidc.oauth2Config(d, authenticator.callbackURL(r))
+	http.Redirect(w, r, config.AuthCodeURL(state), http.StatusFound)
+}
+
+// isLocalPath tells whether next is a path on this server, so that logging in
+// cannot redirect to another site. Browsers treat backslashes as slashes, so
+// "/\evil.com" is rejected as well as "//evil.com".
+func isLocalPath(next string) bool {
+	if !strings.HasPrefix(next, "/") || strings.ContainsRune(next, '\\') {
+		return false
+	}
+	parsed, err := url.Parse(next)
+	return err == nil && parsed.Scheme == "" && parsed.Host == ""
+}
+
+// callback exchanges the authorization code, looks the user up and starts a session
+func (authenticator *Authenticator) callback(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie(stateCookie)
+	if err != nil {
+		http.Error(w, "login expired, please try again", http.StatusBadRequest)
+		return
+	}
+	parts := strings.SplitN(cookie.Value, "|", 2)
+	if len(parts) != 2 || parts[0] != r.URL.Query().Get("state") {
+		http.Error(w, "invalid login state", http.StatusBadRequest)
+		return
+	}
+	clearCookie(w, stateCookie)
+
+	if errorCode := r.URL.Query().Get("error"); errorCode != "" {
+		http.Error(w, "login failed: "+errorCode, http.StatusForbidden)
+		return
+	}
+
+	d, err := authenticator.oidc.discover()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	config := authenticator.oidc.oauth2Config(d, authenticator.callbackURL(r))
+	token, err := config.Exchange(r.Context(), r.URL.Query().Get("code"))
+	if err != nil {
+		http.Error(w, "login failed: "+err.Error(), http.StatusForbidden)
+		return
+	}
+
+	var info userinfo
+	if err = authenticator.oidc.getJSON(d.UserinfoEndpoint, token.AccessToken, &info); err != nil {
+		http.Error(w, "could not look up user: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	user := User{
+		Subject: info.Subject,
+		Name:    firstNonEmpty(info.PreferredUsername, info.UserName, info.Name, info.Email, info.Subject),
+		Email:   info.Email,
+		Groups:  info.Groups,
+	}
+	expires := authenticator.timeNow().Add(authenticator.options.SessionTTL)
+	value, err := encodeSession(authenticator.secret, session{User: user, Expires: expires})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	setCookie(w, sessionCookie, value, authenticator.options.SessionTTL, authenticator.secureCookies())
+	http.Redirect(w, r, parts[1], http.StatusFound)
+}
+
+// callbackURL is the external URL of the login callback, derived from the
+// request if no external URL is configured
+func (authenticator *Authenticator) callbackURL(r *http.Request) string {
+	if authenticator.options.ExternalURL != "" {
+		return strings.TrimSuffix(authenticator.options.ExternalURL, "/") + "/callback"
+	}
+
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + "/callback"
+}
+
+// uaaIssuer returns the issuer of the UAA behind a Cloud Foundry API
+func (client *oidcClient) uaaIssuer(apiURL string) (string, error) {
+	var info struct {
+		TokenEndpoint string `json:"token_endpoint"`
+	}
+	if err := client.getJSON(strings.TrimSuffix(apiURL, "/")+"/v2/info", "", &info); err != nil {
+		return "", err
+	}
+	if info.TokenEndpoint == "" {
+		return "", fmt.Errorf("%s does not advertise a token endpoint", apiURL)
+	}
+	return info.TokenEndpoint, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const sessionCookie = "loupe_session"
+
+// User is the person or machine making a request
+type User struct {
+	Subject string
+	Name    string
+	Email   string   `json:",omitempty"`
+	Groups  []string `json:",omitempty"`
+
+	// Foundations limits the foundations an API token can see
+	Foundations []string `json:",omitempty"`
+	// Token is true if the user is an API token rather than a person
+	Token bool `json:",omitempty"`
+}
+
+type session struct {
+	User    User
+	Expires time.Time
+}
+
+var errInvalidSession = errors.New("invalid session")
+
+// encodeSession signs a session so it can be kept in a cookie
+func encodeSession(secret []byte, s session) (string, error) {
+	payload, err := json.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + sign(secret, encoded), nil
+}
+
+// decodeSession checks the signature and expiry of a session cookie
+func decodeSession(secret []byte, value string, now time.Time) (session, error) {
+	parts := strings.SplitN(value, ".", 2)
+	if len(parts) != 2 || !hmac.Equal([]byte(sign(secret, parts[0])), []byte(parts[1])) {
+		return session{}, errInvalidSession
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return session{}, errInvalidSession
+	}
+	var s session
+	if err = json.Unmarshal(payload, &s); err != nil {
+		return session{}, errInvalidSession
+	}
+	if !now.Before(s.Expires) {
+		return session{}, errInvalidSession
+	}
+
+	return s, nil
+}
+
+func sign(secret []byte, value string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func setCookie(w http.ResponseWriter, name, value string, maxAge time.Duration, secure bool) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   int(maxAge.Seconds()),
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func clearCookie(w http.ResponseWriter, name string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+}
@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Token is an API token for machines, such as deploy pipelines, to call the
+// JSON endpoints with an "Authorization: Bearer <token>" header
+type Token struct {
+	Name string `json:"name"`
+	// Token is the token itself. Use SHA256 instead to keep it out of the file.
+	Token string `json:"token,omitempty"`
+	// SHA256 is the hex encoded SHA-256 hash of the token
+	SHA256 string `json:"sha256,omitempty"`
+	// Foundations limits what the token can see. It sees every foundation if empty.
+	Foundations []string `json:"foundations,omitempty"`
+}
+
+// LoadTokens reads a JSON list of tokens from a file
+func LoadTokens(path string) ([]Token, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var tokens []Token
+	if err = json.Unmarshal(contents, &tokens); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %s", path, err)
+	}
+
+	names := map[string]bool{}
+	for i, token := range tokens {
+		if token.Name == "" {
+			return nil, fmt.Errorf("token %d in %s has no name", i+1, path)
+		}
+		if names[token.Name] {
+			return nil, fmt.Errorf("token %s is listed more than once in %s", token.Name, path)
+		}
+		names[token.Name] = true
+
+		if token.Token != "" {
+			tokens[i].SHA256 = hashToken(token.Token)
+			tokens[i].Token = ""
+		}
+		if _, err := hex.DecodeString(tokens[i].SHA256); err != nil || len(tokens[i].SHA256) != sha256.Size*2 {
+			return nil, fmt.Errorf("token %s in %s needs a token or the sha256 of one", token.Name, path)
+		}
+		tokens[i].SHA256 = strings.ToLower(tokens[i].SHA256)
+	}
+
+	return tokens, nil
+}
+
+// GenerateToken returns a new random token and the hash to put in the tokens file
+func GenerateToken() (token string, hash string) {
+	tokenBytes := make([]byte, 32)
+	rand.Read(tokenBytes)
+	token = hex.EncodeToString(tokenBytes)
+	return token, hashToken(token)
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+var (
+	errInvalidToken  = errors.New("invalid API token")
+	errReadOnlyToken = errors.New("API tokens are read-only")
+)
+
+// authenticateToken looks up the bearer token of a request. ok is false if
+// the request has no bearer token and err is set if it is not allowed.
+func (authenticator *Authenticator) authenticateToken(r *http.Request) (user User, ok bool, err error) {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return User{}, false, nil
+	}
+	hash := hashToken(strings.TrimPrefix(header, "Bearer "))
+
+	for _, token := range authenticator.options.Tokens {
+		if subtle.ConstantTimeCompare([]byte(token.SHA256), []byte(hash)) != 1 {
+			continue
+		}
+
+		if r.Method != "GET" && r.Method != "HEAD" && !authenticator.readOnlyPath(r) {
+			log.Printf("api token %s refused: %s %s\n", token.Name, r.Method, r.URL.Path)
+			return User{}, true, errReadOnlyToken
+		}
+
+		log.Printf("api token %s: %s %s\n", token.Name, r.Method, r.URL.RequestURI())
+		return User{
+			Subject:     "token:" + token.Name,
+			Name:        token.Name,
+			Foundations: token.Foundations,
+			Token:       true,
+		}, true, nil
+	}
+
+	log.Printf("unknown api token: %s %s\n", r.Method, r.URL.Path)
+	return User{}, true, errInvalidToken
+}
+
+func (authenticator *Authenticator) readOnlyPath(r *http.Request) bool {
+	for _, path := range authenticator.options.ReadOnlyPaths {
+		if r.Method == "POST" && r.URL.Path == path {
+			return true
+		}
+	}
+	return false
+}
+
+func (authenticator *Authenticator) publicPath(r *http.Request) bool {
+	for _, path := range authenticator.options.PublicPaths {
+		if r.URL.Path == path {
+			return true
+		}
+	}
+	return false
+}
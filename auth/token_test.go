@@ -0,0 +1,130 @@
+package auth_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/FidelityInternational/cf-loupe/auth"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("API tokens", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "loupe-tokens")
+		Expect(err).To(Succeed())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	writeTokens := func(contents string) string {
+		path := filepath.Join(dir, "tokens.json")
+		Expect(ioutil.WriteFile(path, []byte(contents), 0600)).To(Succeed())
+		return path
+	}
+
+	Describe("LoadTokens", func() {
+		It("hashes plain tokens and keeps hashed ones", func() {
+			_, hash := GenerateToken()
+			tokens, err := LoadTokens(writeTokens(`[
+				{"name": "ci", "token": "s3cret", "foundations": ["dev"]},
+				{"name": "deploy", "sha256": "` + hash + `"}
+			]`))
+			Expect(err).To(Succeed())
+
+			sum := sha256.Sum256([]byte("s3cret"))
+			Expect(tokens).To(Equal([]Token{
+				{Name: "ci", SHA256: hex.EncodeToString(sum[:]), Foundations: []string{"dev"}},
+				{Name: "deploy", SHA256: hash},
+			}))
+		})
+
+		It("requires a token or a hash", func() {
+			_, err := LoadTokens(writeTokens(`[{"name": "ci"}]`))
+			Expect(err).To(MatchError(ContainSubstring("token ci in")))
+		})
+
+		It("rejects duplicate names", func() {
+			_, err := LoadTokens(writeTokens(`[{"name": "ci", "token": "a"}, {"name": "ci", "token": "b"}]`))
+			Expect(err).To(MatchError(ContainSubstring("token ci is listed more than once")))
+		})
+	})
+
+	Describe("Authenticating with a token", func() {
+		var server *httptest.Server
+		var token string
+
+		BeforeEach(func() {
+			var hash string
+			token, hash = GenerateToken()
+
+			dashboard := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				user, _ := UserFromContext(r.Context())
+				w.Write([]byte("hello " + user.Name))
+			})
+			authenticator := NewAuthenticator(Options{
+				Tokens:        []Token{{Name: "ci", SHA256: hash, Foundations: []string{"dev"}}},
+				ReadOnlyPaths: []string{"/api/check"},
+			}, time.Now)
+			server = httptest.NewServer(authenticator.Wrap(dashboard))
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		call := func(method, path, bearer string) (*http.Response, string) {
+			req, err := http.NewRequest(method, server.URL+path, nil)
+			Expect(err).To(Succeed())
+			if bearer != "" {
+				req.Header.Set("Authorization", "Bearer "+bearer)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			Expect(err).To(Succeed())
+			defer resp.Body.Close()
+			body, err := ioutil.ReadAll(resp.Body)
+			Expect(err).To(Succeed())
+			return resp, string(body)
+		}
+
+		It("lets known tokens read", func() {
+			resp, body := call("GET", "/listapps", token)
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(body).To(Equal("hello ci"))
+		})
+
+		It("rejects unknown tokens", func() {
+			resp, _ := call("GET", "/listapps", "guess")
+			Expect(resp.StatusCode).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("requires a token when no login mode is set", func() {
+			resp, _ := call("GET", "/listapps", "")
+			Expect(resp.StatusCode).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("only allows tokens to read", func() {
+			resp, body := call("POST", "/listapps", token)
+			Expect(resp.StatusCode).To(Equal(http.StatusForbidden))
+			Expect(body).To(ContainSubstring("API tokens are read-only"))
+		})
+
+		It("allows tokens to post to read-only paths", func() {
+			resp, body := call("POST", "/api/check", token)
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(body).To(Equal("hello ci"))
+		})
+	})
+})
@@ -3,8 +3,12 @@ package cf
 import (
 	"errors"
 	"fmt"
+	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	gocf "github.com/cloudfoundry-community/go-cfclient"
 )
@@ -16,11 +20,88 @@ type IClient interface {
 	GetBuildpacks() (map[string]gocf.Buildpack, error)
 	GetOrgs() (map[string]gocf.Org, error)
 	GetSpaces() (map[string]gocf.Space, error)
+	GetOrgQuotas() (map[string]gocf.OrgQuota, error)
+	GetSpaceQuotas() (map[string]gocf.SpaceQuota, error)
+	GetAppInstances(appGUID string) (map[string]gocf.AppInstance, error)
+	GetAppStats(appGUID string) (map[string]gocf.AppStats, error)
+	GetRoutes() (map[string]gocf.Route, error)
+	GetDomains() (map[string]gocf.Domain, error)
+	GetAppRoutes(appGUID string) ([]gocf.Route, error)
+	GetServiceInstances() (map[string]gocf.ServiceInstance, error)
+	GetUserProvidedServiceInstances() (map[string]gocf.UserProvidedServiceInstance, error)
+	GetServiceBindings() (map[string]gocf.ServiceBinding, error)
+	GetServices() (map[string]gocf.Service, error)
+	GetServicePlans() (map[string]gocf.ServicePlan, error)
+	GetAppMetadata() (map[string]Metadata, error)
+	GetSpaceMetadata() (map[string]Metadata, error)
+	GetOrgMetadata() (map[string]Metadata, error)
+	GetUserSpaces(userGUID string) (map[string]gocf.Space, error)
+	GetUserOrgs(userGUID string) (map[string]gocf.Org, error)
 }
 
 // Client is the concrete implemnetation of Client
 type Client struct {
+	// gocfClient is replaced by ReAuth while requests may be using it
+	gocfMutex  sync.RWMutex
 	gocfClient *gocf.Client
+	options    ClientOptions
+	throttle   *throttle
+
+	statsMutex     sync.Mutex
+	stats          []ListStats
+	accessToken    string
+	tokenRefreshes int
+}
+
+// ClientOptions tunes how a client calls the Cloud Controller of a foundation
+type ClientOptions struct {
+	// PageWorkers bounds the pages of a list fetched at once
+	PageWorkers int
+	// RateLimit is the most requests started per second, or zero for no limit
+	RateLimit float64
+	// MaxConcurrency bounds the requests in flight, or zero for no limit
+	MaxConcurrency int
+	// MaxRetries is how many times a request failing with a server error,
+	// 429 Too Many Requests or a network error is retried
+	MaxRetries int
+	// RetryBackoff is the wait before the first retry, doubled for each retry
+	// after it unless the Cloud Controller sends Retry-After
+	RetryBackoff time.Duration
+}
+
+var defaultClientOptions = ClientOptions{
+	MaxRetries:   defaultMaxRetries,
+	RetryBackoff: defaultRetryBackoff,
+}
+
+// newClient returns a client whose requests go through a throttle
+func newClient(gocfClient *gocf.Client, options ClientOptions) *Client {
+	client := &Client{options: options, throttle: newThrottle(options)}
+	client.useGocfClient(gocfClient)
+	return client
+}
+
+// useGocfClient sends the requests of a go-cfclient client through the
+// client's throttle and makes it the one the client uses
+func (client *Client) useGocfClient(gocfClient *gocf.Client) {
+	httpClient := *gocfClient.Config.HttpClient
+	transport := httpClient.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	httpClient.Transport = client.throttle.wrap(transport)
+	gocfClient.Config.HttpClient = &httpClient
+
+	client.gocfMutex.Lock()
+	client.gocfClient = gocfClient
+	client.gocfMutex.Unlock()
+}
+
+// currentGocfClient returns the go-cfclient client requests are made with
+func (client *Client) currentGocfClient() *gocf.Client {
+	client.gocfMutex.RLock()
+	defer client.gocfMutex.RUnlock()
+	return client.gocfClient
 }
 
 // BuildClientsFromEnvironment looks at environment variables then instantiates
@@ -31,6 +112,11 @@ func BuildClientsFromEnvironment(env []string) (map[string]IClient, error) {
 		return nil, err
 	}
 
+	clientOptions, err := clientOptionsFromEnvironment(env)
+	if err != nil {
+		return nil, err
+	}
+
 	cfClients := map[string]IClient{}
 
 	for foundation, config := range foundationConfigs {
@@ -38,23 +124,38 @@ func BuildClientsFromEnvironment(env []string) (map[string]IClient, error) {
 		if err != nil {
 			return nil, err
 		}
-		cfClients[foundation] = &Client{gocfClient: client}
+		cfClients[foundation] = newClient(client, clientOptions[foundation])
+	}
+
+	for foundation, dir := range offlineDirsFromEnvironment(env) {
+		cfClients[foundation] = NewOfflineClient(dir)
 	}
 
 	return cfClients, nil
 }
 
-var query url.Values = url.Values{
-	"results-per-page": []string{
-		"100",
-	},
+// NewClientFromToken returns a client that calls a Cloud Foundry API with an
+// existing access token, such as the one of the cf CLI. The token is not
+// refreshed, so ReAuth fails once it expires.
+func NewClientFromToken(api, accessToken string, skipSSLValidation bool) (*Client, error) {
+	client, err := gocf.NewClient(&gocf.Config{
+		ApiAddress:        api,
+		Token:             strings.TrimPrefix(strings.TrimPrefix(accessToken, "bearer "), "Bearer "),
+		SkipSslValidation: skipSSLValidation,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newClient(client, defaultClientOptions), nil
 }
 
 // BuildClientConfigFromEnvironment looks at environment variables then creates
-// a client configuration for each foundation and returns a map, mapping the foundation name to the config
+// a client configuration for each foundation and returns a map, mapping the foundation name to the config.
+// Foundations read from a directory with CF_OFFLINE_DIR_<n> have no configuration.
 func BuildClientConfigFromEnvironment(env []string) (map[string]gocf.Config, error) {
 	foundationConfigs := map[string]gocf.Config{}
 	envMap := mapifyEnv(env)
+	offlineDirs := offlineDirsFromEnvironment(env)
 
 	for i := 1; ; i++ {
 		usernameKey := fmt.Sprintf("CF_USERNAME_%d", i)
@@ -65,6 +166,9 @@ func BuildClientConfigFromEnvironment(env []string) (map[string]gocf.Config, err
 		if !hasFoundationKey {
 			break
 		}
+		if _, offline := envMap[fmt.Sprintf("CF_OFFLINE_DIR_%d", i)]; offline {
+			continue
+		}
 
 		username, hasUsernameKey := envMap[usernameKey]
 		if !hasUsernameKey {
@@ -87,13 +191,92 @@ func BuildClientConfigFromEnvironment(env []string) (map[string]gocf.Config, err
 		foundationConfigs[foundation] = configFoundation
 	}
 
-	if len(foundationConfigs) == 0 {
+	if len(foundationConfigs) == 0 && len(offlineDirs) == 0 {
 		return nil, errors.New("no foundation environment variables found. CF_USERNAME_1, CF_PASSWORD_1, CF_API_1 and CF_FOUNDATION_1 must be set")
 	}
 
 	return foundationConfigs, nil
 }
 
+// clientOptionsFromEnvironment returns a map of foundation name to the
+// options set with CF_PAGE_WORKERS_<n>, CF_RATE_LIMIT_<n>,
+// CF_MAX_CONCURRENCY_<n>, CF_MAX_RETRIES_<n> and CF_RETRY_BACKOFF_<n>
+func clientOptionsFromEnvironment(env []string) (map[string]ClientOptions, error) {
+	clientOptions := map[string]ClientOptions{}
+	envMap := mapifyEnv(env)
+
+	for i := 1; ; i++ {
+		foundation, hasFoundationKey := envMap[fmt.Sprintf("CF_FOUNDATION_%d", i)]
+		if !hasFoundationKey {
+			break
+		}
+
+		options := defaultClientOptions
+		pageWorkersKey := fmt.Sprintf("CF_PAGE_WORKERS_%d", i)
+		if value, ok := envMap[pageWorkersKey]; ok {
+			pageWorkers, err := strconv.Atoi(value)
+			if err != nil || pageWorkers < 1 {
+				return nil, fmt.Errorf("%s must be a positive number, got %q", pageWorkersKey, value)
+			}
+			options.PageWorkers = pageWorkers
+		}
+		rateLimitKey := fmt.Sprintf("CF_RATE_LIMIT_%d", i)
+		if value, ok := envMap[rateLimitKey]; ok {
+			rateLimit, err := strconv.ParseFloat(value, 64)
+			if err != nil || rateLimit <= 0 {
+				return nil, fmt.Errorf("%s must be a positive number, got %q", rateLimitKey, value)
+			}
+			options.RateLimit = rateLimit
+		}
+		maxConcurrencyKey := fmt.Sprintf("CF_MAX_CONCURRENCY_%d", i)
+		if value, ok := envMap[maxConcurrencyKey]; ok {
+			maxConcurrency, err := strconv.Atoi(value)
+			if err != nil || maxConcurrency < 1 {
+				return nil, fmt.Errorf("%s must be a positive number, got %q", maxConcurrencyKey, value)
+			}
+			options.MaxConcurrency = maxConcurrency
+		}
+		maxRetriesKey := fmt.Sprintf("CF_MAX_RETRIES_%d", i)
+		if value, ok := envMap[maxRetriesKey]; ok {
+			maxRetries, err := strconv.Atoi(value)
+			if err != nil || maxRetries < 0 {
+				return nil, fmt.Errorf("%s must be zero or a positive number, got %q", maxRetriesKey, value)
+			}
+			options.MaxRetries = maxRetries
+		}
+		retryBackoffKey := fmt.Sprintf("CF_RETRY_BACKOFF_%d", i)
+		if value, ok := envMap[retryBackoffKey]; ok {
+			retryBackoff, err := time.ParseDuration(value)
+			if err != nil || retryBackoff <= 0 {
+				return nil, fmt.Errorf("%s must be a positive duration, got %q", retryBackoffKey, value)
+			}
+			options.RetryBackoff = retryBackoff
+		}
+		clientOptions[foundation] = options
+	}
+
+	return clientOptions, nil
+}
+
+// offlineDirsFromEnvironment returns a map of foundation name to the directory
+// its saved responses are read from
+func offlineDirsFromEnvironment(env []string) map[string]string {
+	offlineDirs := map[string]string{}
+	envMap := mapifyEnv(env)
+
+	for i := 1; ; i++ {
+		foundation, hasFoundationKey := envMap[fmt.Sprintf("CF_FOUNDATION_%d", i)]
+		if !hasFoundationKey {
+			break
+		}
+		if dir, offline := envMap[fmt.Sprintf("CF_OFFLINE_DIR_%d", i)]; offline {
+			offlineDirs[foundation] = dir
+		}
+	}
+
+	return offlineDirs
+}
+
 func mapifyEnv(envArray []string) map[string]string {
 	envMap := map[string]string{}
 	for _, envVar := range envArray {
@@ -107,14 +290,23 @@ func mapifyEnv(envArray []string) map[string]string {
 
 // Reauthenticates the client with the api
 func (client *Client) ReAuth() error {
-	token, err := client.gocfClient.Config.TokenSource.Token()
+	gocfClient := client.currentGocfClient()
+	token, err := gocfClient.Config.TokenSource.Token()
 
 	if err == nil && token.Valid() {
-		return nil // We are authenticated and the token is valid
+		// We are authenticated and the token is valid, though it may have
+		// just been refreshed
+		client.statsMutex.Lock()
+		if client.accessToken != "" && client.accessToken != token.AccessToken {
+			client.tokenRefreshes++
+		}
+		client.accessToken = token.AccessToken
+		client.statsMutex.Unlock()
+		return nil
 	}
 
 	// Try to reauthenticate
-	cleanConfig := client.gocfClient.Config
+	cleanConfig := gocfClient.Config
 	cleanConfig.HttpClient = nil
 	cleanConfig.Token = ""
 	cleanConfig.ClientID = ""
@@ -124,56 +316,100 @@ func (client *Client) ReAuth() error {
 		return err
 	}
 
-	client.gocfClient = newClient
+	client.useGocfClient(newClient)
+
+	client.statsMutex.Lock()
+	client.tokenRefreshes++
+	client.accessToken = ""
+	client.statsMutex.Unlock()
 	return nil
 }
 
 // ListApps returns the currently deployed apps
 func (client *Client) ListApps() ([]gocf.App, error) {
-	return client.gocfClient.ListAppsByQuery(query)
+	return listApps(client.eachResource)
+}
+
+// ListSpaceApps returns the apps deployed to a space
+func (client *Client) ListSpaceApps(spaceGUID string) ([]gocf.App, error) {
+	return client.currentGocfClient().ListAppsByQuery(url.Values{
+		"results-per-page": []string{"100"},
+		"q":                []string{"space_guid:" + spaceGUID},
+	})
 }
 
 // GetBuildpacks returns a map of buildpack GUID to buildpack details
 func (client *Client) GetBuildpacks() (map[string]gocf.Buildpack, error) {
-	buildpacksList, err := client.gocfClient.ListBuildpacks()
-	if err != nil {
-		return nil, err
-	}
-
-	buildpacksMap := map[string]gocf.Buildpack{}
-	for _, buildpack := range buildpacksList {
-		buildpacksMap[buildpack.Guid] = buildpack
-	}
-
-	return buildpacksMap, nil
+	return listBuildpacks(client.eachResource)
 }
 
 // GetOrgs returns a map of org GUID to org details
 func (client *Client) GetOrgs() (map[string]gocf.Org, error) {
-	orgList, err := client.gocfClient.ListOrgsByQuery(query)
-	if err != nil {
-		return nil, err
-	}
-
-	orgMap := map[string]gocf.Org{}
-	for _, org := range orgList {
-		orgMap[org.Guid] = org
-	}
-
-	return orgMap, nil
+	return listOrgs(client.eachResource)
 }
 
 // GetSpaces returns a map of space GUID to space details
 func (client *Client) GetSpaces() (map[string]gocf.Space, error) {
-	spaceList, err := client.gocfClient.ListSpacesByQuery(query)
-	if err != nil {
-		return nil, err
-	}
+	return listSpaces(client.eachResource)
+}
 
-	spaceMap := map[string]gocf.Space{}
-	for _, space := range spaceList {
-		spaceMap[space.Guid] = space
-	}
+// GetOrgQuotas returns a map of org quota definition GUID to quota details
+func (client *Client) GetOrgQuotas() (map[string]gocf.OrgQuota, error) {
+	return listOrgQuotas(client.eachResource)
+}
+
+// GetSpaceQuotas returns a map of space quota definition GUID to quota details
+func (client *Client) GetSpaceQuotas() (map[string]gocf.SpaceQuota, error) {
+	return listSpaceQuotas(client.eachResource)
+}
+
+// GetAppInstances returns a map of instance index to instance state for an app
+func (client *Client) GetAppInstances(appGUID string) (map[string]gocf.AppInstance, error) {
+	return client.currentGocfClient().GetAppInstances(appGUID)
+}
+
+// GetAppStats returns a map of instance index to resource usage for an app
+func (client *Client) GetAppStats(appGUID string) (map[string]gocf.AppStats, error) {
+	return client.currentGocfClient().GetAppStats(appGUID)
+}
+
+// GetRoutes returns a map of route GUID to route details
+func (client *Client) GetRoutes() (map[string]gocf.Route, error) {
+	return listRoutes(client.eachResource)
+}
+
+// GetDomains returns a map of domain GUID to domain details, for both private
+// and shared domains
+func (client *Client) GetDomains() (map[string]gocf.Domain, error) {
+	return listDomains(client.eachResource)
+}
+
+// GetAppRoutes returns the routes mapped to an app
+func (client *Client) GetAppRoutes(appGUID string) ([]gocf.Route, error) {
+	return client.currentGocfClient().GetAppRoutes(appGUID)
+}
+
+// GetServiceInstances returns a map of service instance GUID to service instance details
+func (client *Client) GetServiceInstances() (map[string]gocf.ServiceInstance, error) {
+	return listServiceInstances(client.eachResource)
+}
+
+// GetUserProvidedServiceInstances returns a map of user provided service instance GUID to its details
+func (client *Client) GetUserProvidedServiceInstances() (map[string]gocf.UserProvidedServiceInstance, error) {
+	return listUserProvidedServiceInstances(client.eachResource)
+}
+
+// GetServiceBindings returns a map of service binding GUID to service binding details
+func (client *Client) GetServiceBindings() (map[string]gocf.ServiceBinding, error) {
+	return listServiceBindings(client.eachResource)
+}
+
+// GetServices returns a map of service GUID to service offering details
+func (client *Client) GetServices() (map[string]gocf.Service, error) {
+	return listServices(client.eachResource)
+}
 
-	return spaceMap, nil
+// GetServicePlans returns a map of service plan GUID to service plan details
+func (client *Client) GetServicePlans() (map[string]gocf.ServicePlan, error) {
+	return listServicePlans(client.eachResource)
 }
@@ -120,4 +120,55 @@ var _ = Describe("BuildClientConfigFromEnvironment", func() {
 			Expect(clients).To(HaveKey("prod"))
 		})
 	})
+
+	Context("When the page workers are not a positive number", func() {
+		BeforeEach(func() {
+			fakeEnv = []string{
+				"CF_USERNAME_1=admin",
+				"CF_PASSWORD_1=1234",
+				"CF_FOUNDATION_1=dev",
+				fmt.Sprintf("CF_API_1=%s", fapi1.Server.URL),
+				"CF_PAGE_WORKERS_1=0",
+			}
+		})
+
+		It("returns a meaningful error", func() {
+			_, err := BuildClientsFromEnvironment(fakeEnv)
+			Expect(err).To(MatchError(`CF_PAGE_WORKERS_1 must be a positive number, got "0"`))
+		})
+	})
+
+	Context("When the rate limit is invalid", func() {
+		BeforeEach(func() {
+			fakeEnv = []string{
+				"CF_USERNAME_1=admin",
+				"CF_PASSWORD_1=1234",
+				"CF_FOUNDATION_1=dev",
+				fmt.Sprintf("CF_API_1=%s", fapi1.Server.URL),
+				"CF_RATE_LIMIT_1=fast",
+			}
+		})
+
+		It("returns a meaningful error", func() {
+			_, err := BuildClientsFromEnvironment(fakeEnv)
+			Expect(err).To(MatchError(`CF_RATE_LIMIT_1 must be a positive number, got "fast"`))
+		})
+	})
+
+	Context("When the max retries are invalid", func() {
+		BeforeEach(func() {
+			fakeEnv = []string{
+				"CF_USERNAME_1=admin",
+				"CF_PASSWORD_1=1234",
+				"CF_FOUNDATION_1=dev",
+				fmt.Sprintf("CF_API_1=%s", fapi1.Server.URL),
+				"CF_MAX_RETRIES_1=-1",
+			}
+		})
+
+		It("returns a meaningful error", func() {
+			_, err := BuildClientsFromEnvironment(fakeEnv)
+			Expect(err).To(MatchError(`CF_MAX_RETRIES_1 must be zero or a positive number, got "-1"`))
+		})
+	})
 })
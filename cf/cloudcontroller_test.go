@@ -0,0 +1,214 @@
+package cf_test
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/FidelityInternational/cf-loupe/helpers"
+
+	. "github.com/FidelityInternational/cf-loupe/cf"
+)
+
+var _ = Describe("Client against a fake Cloud Controller", func() {
+	var cc *helpers.FakeCloudController
+	var client IClient
+	var env []string
+
+	BeforeEach(func() {
+		cc = helpers.NewFakeCloudController()
+		cc.PageSize = 2
+		for i := 1; i <= 9; i++ {
+			cc.AddV2("/v2/apps", helpers.V2Resource{
+				Metadata: map[string]interface{}{"guid": fmt.Sprintf("app-%d", i), "updated_at": "2017-08-12T16:41:45Z"},
+				Entity:   map[string]interface{}{"name": fmt.Sprintf("app%d", i), "state": "STARTED", "instances": 2},
+			})
+			cc.AddV3("/v3/apps", map[string]interface{}{
+				"guid":     fmt.Sprintf("app-%d", i),
+				"metadata": map[string]interface{}{"labels": map[string]string{"team": "alpha"}},
+			})
+		}
+
+		env = []string{
+			"CF_USERNAME_1=admin",
+			"CF_PASSWORD_1=1234",
+			"CF_FOUNDATION_1=dev",
+			fmt.Sprintf("CF_API_1=%s", cc.Server.URL),
+			"CF_RETRY_BACKOFF_1=1ms",
+		}
+	})
+
+	JustBeforeEach(func() {
+		clients, err := BuildClientsFromEnvironment(env)
+		Expect(err).To(Succeed())
+		client = clients["dev"]
+	})
+
+	AfterEach(func() {
+		cc.Close()
+	})
+
+	It("fetches every v2 page in order", func() {
+		apps, err := client.ListApps()
+		Expect(err).To(Succeed())
+		Expect(apps).To(HaveLen(9))
+		for i, app := range apps {
+			Expect(app.Guid).To(Equal(fmt.Sprintf("app-%d", i+1)))
+		}
+		Expect(apps[0].Name).To(Equal("app1"))
+		Expect(apps[0].UpdatedAt).To(Equal("2017-08-12T16:41:45Z"))
+
+		Expect(cc.Requests()).To(HaveLen(5))
+		Expect(cc.Requests()[0]).To(ContainSubstring("results-per-page=100"))
+	})
+
+	It("fetches every v3 page", func() {
+		metadata, err := client.GetAppMetadata()
+		Expect(err).To(Succeed())
+		Expect(metadata).To(HaveLen(9))
+		Expect(metadata["app-9"].Labels).To(HaveKeyWithValue("team", "alpha"))
+		Expect(cc.Requests()[0]).To(ContainSubstring("per_page=5000"))
+	})
+
+	It("fetches the pages after the first at once", func() {
+		cc.SetLatency(20 * time.Millisecond)
+		_, err := client.ListApps()
+		Expect(err).To(Succeed())
+		Expect(cc.MaxConcurrentRequests()).To(Equal(4))
+	})
+
+	Context("When the page workers are set", func() {
+		BeforeEach(func() {
+			env = append(env, "CF_PAGE_WORKERS_1=2")
+		})
+
+		It("fetches that many pages at once", func() {
+			cc.SetLatency(20 * time.Millisecond)
+			_, err := client.ListApps()
+			Expect(err).To(Succeed())
+			Expect(cc.MaxConcurrentRequests()).To(Equal(2))
+		})
+	})
+
+	It("fails if any page fails", func() {
+		cc.Fail("/v2/apps", http.StatusBadGateway)
+		_, err := client.ListApps()
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("records how each list was fetched", func() {
+		_, err := client.ListApps()
+		Expect(err).To(Succeed())
+		_, err = client.GetAppMetadata()
+		Expect(err).To(Succeed())
+
+		stats := client.(*Client).TakeStats()
+		Expect(stats).To(HaveLen(2))
+		Expect(stats[0].Resource).To(Equal("apps"))
+		Expect(stats[0].Pages).To(Equal(5))
+		Expect(stats[1].Resource).To(Equal("v3/apps"))
+		Expect(stats[1].Pages).To(Equal(5))
+		Expect(client.(*Client).TakeStats()).To(BeEmpty())
+	})
+
+	It("reports every instance of a started app as running", func() {
+		instances, err := client.GetAppInstances("app-1")
+		Expect(err).To(Succeed())
+		Expect(instances).To(HaveLen(2))
+		Expect(instances["1"].State).To(Equal("RUNNING"))
+	})
+
+	It("fails requests while told to", func() {
+		cc.Fail("/v2/apps", http.StatusServiceUnavailable)
+		_, err := client.ListApps()
+		Expect(err).To(HaveOccurred())
+
+		cc.Recover()
+		_, err = client.ListApps()
+		Expect(err).To(Succeed())
+	})
+
+	It("delays responses while told to", func() {
+		cc.SetLatency(50 * time.Millisecond)
+		start := time.Now()
+		_, err := client.GetBuildpacks()
+		Expect(err).To(Succeed())
+		Expect(time.Since(start)).To(BeNumerically(">=", 50*time.Millisecond))
+	})
+
+	Context("When requests fail", func() {
+		It("retries server errors", func() {
+			cc.FailTimes("/v2/buildpacks", http.StatusServiceUnavailable, 2)
+			_, err := client.GetBuildpacks()
+			Expect(err).To(Succeed())
+			Expect(cc.Requests()).To(HaveLen(3))
+		})
+
+		It("waits as long as Retry-After says before retrying", func() {
+			cc.FailTimes("/v2/buildpacks", http.StatusTooManyRequests, 1)
+			cc.SetRetryAfter("1")
+			start := time.Now()
+			_, err := client.GetBuildpacks()
+			Expect(err).To(Succeed())
+			Expect(time.Since(start)).To(BeNumerically(">=", time.Second))
+			Expect(cc.Requests()).To(HaveLen(2))
+		})
+
+		It("gives up after three retries", func() {
+			cc.Fail("/v2/buildpacks", http.StatusBadGateway)
+			_, err := client.GetBuildpacks()
+			Expect(err).To(HaveOccurred())
+			Expect(cc.Requests()).To(HaveLen(4))
+		})
+
+		It("does not retry client errors", func() {
+			cc.Fail("/v2/buildpacks", http.StatusNotFound)
+			_, err := client.GetBuildpacks()
+			Expect(err).To(HaveOccurred())
+			Expect(cc.Requests()).To(HaveLen(1))
+		})
+
+		Context("and the retries are set", func() {
+			BeforeEach(func() {
+				env = append(env, "CF_MAX_RETRIES_1=0")
+			})
+
+			It("retries that many times", func() {
+				cc.FailTimes("/v2/buildpacks", http.StatusServiceUnavailable, 1)
+				_, err := client.GetBuildpacks()
+				Expect(err).To(HaveOccurred())
+				Expect(cc.Requests()).To(HaveLen(1))
+			})
+		})
+	})
+
+	Context("When the max concurrency is set", func() {
+		BeforeEach(func() {
+			env = append(env, "CF_MAX_CONCURRENCY_1=1")
+		})
+
+		It("makes no more requests at once, whatever the page workers", func() {
+			cc.SetLatency(20 * time.Millisecond)
+			_, err := client.ListApps()
+			Expect(err).To(Succeed())
+			Expect(cc.Requests()).To(HaveLen(5))
+			Expect(cc.MaxConcurrentRequests()).To(Equal(1))
+		})
+	})
+
+	Context("When the rate limit is set", func() {
+		BeforeEach(func() {
+			env = append(env, "CF_RATE_LIMIT_1=20")
+		})
+
+		It("spreads the requests out", func() {
+			start := time.Now()
+			_, err := client.ListApps()
+			Expect(err).To(Succeed())
+			Expect(time.Since(start)).To(BeNumerically(">=", 4*50*time.Millisecond))
+		})
+	})
+})
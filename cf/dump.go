@@ -0,0 +1,158 @@
+package cf
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// dumpedResources are the v2 lists the offline client reads, by file name
+var dumpedResources = []string{
+	"apps",
+	"buildpacks",
+	"organizations",
+	"spaces",
+	"quota_definitions",
+	"space_quota_definitions",
+	"routes",
+	"route_mappings",
+	"private_domains",
+	"shared_domains",
+	"service_instances",
+	"user_provided_service_instances",
+	"service_bindings",
+	"services",
+	"service_plans",
+}
+
+// dumpedMetadata are the v3 lists the offline client reads labels and annotations from
+var dumpedMetadata = []string{"apps", "spaces", "organizations"}
+
+// Dump saves the responses the offline client reads to a directory, one file
+// per page. Credentials are removed from service instances and bindings, and
+// environment variables and docker credentials from apps, so the directory
+// can be shared.
+func (client *Client) Dump(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	for _, resource := range dumpedResources {
+		err := client.dumpPages(dir, resource, "/v2/"+resource+"?results-per-page=100", func(page map[string]interface{}) string {
+			next, _ := page["next_url"].(string)
+			return next
+		})
+		if err != nil {
+			return fmt.Errorf("could not dump %s: %s", resource, err)
+		}
+	}
+
+	for _, resource := range dumpedMetadata {
+		err := client.dumpPages(dir, "v3_"+resource, "/v3/"+resource+"?per_page=5000", func(page map[string]interface{}) string {
+			var next string
+			if pagination, ok := page["pagination"].(map[string]interface{}); ok {
+				if nextLink, ok := pagination["next"].(map[string]interface{}); ok {
+					next, _ = nextLink["href"].(string)
+				}
+			}
+			return strings.TrimPrefix(next, client.currentGocfClient().Config.ApiAddress)
+		})
+		if err != nil {
+			return fmt.Errorf("could not dump v3 %s: %s", resource, err)
+		}
+	}
+
+	return nil
+}
+
+// dumpPages writes every page of a list, following the next page link. The
+// pages of an earlier dump are removed first, so that a list that got shorter
+// is not read back with its old last pages.
+func (client *Client) dumpPages(dir, name, requestURL string, nextURL func(map[string]interface{}) string) error {
+	if err := removePages(dir, name); err != nil {
+		return err
+	}
+
+	for pageNumber := 1; requestURL != ""; pageNumber++ {
+		gocfClient := client.currentGocfClient()
+		resp, err := gocfClient.DoRequest(gocfClient.NewRequest("GET", requestURL))
+		if err != nil {
+			return err
+		}
+
+		var page map[string]interface{}
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		removeSecrets(page)
+
+		contents, err := json.MarshalIndent(page, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		fileName := name + ".json"
+		if pageNumber > 1 {
+			fileName = fmt.Sprintf("%s-%d.json", name, pageNumber)
+		}
+		if err = ioutil.WriteFile(filepath.Join(dir, fileName), contents, 0644); err != nil {
+			return err
+		}
+
+		requestURL = nextURL(page)
+	}
+
+	return nil
+}
+
+// removePages removes the <name>.json and <name>-<page>.json files of a list
+func removePages(dir, name string) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		pageName := strings.TrimSuffix(file.Name(), ".json")
+		if pageName == file.Name() {
+			continue
+		}
+		if pageName != name {
+			pageNumber := strings.TrimPrefix(pageName, name+"-")
+			if pageNumber == pageName {
+				continue
+			}
+			if _, err := strconv.Atoi(pageNumber); err != nil {
+				continue
+			}
+		}
+		if err := os.Remove(filepath.Join(dir, file.Name())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// secretFields are the entity fields that may hold secrets: the credentials
+// of service instances and bindings, and the environment variables and docker
+// credentials of apps
+var secretFields = []string{"credentials", "environment_json", "docker_credentials"}
+
+func removeSecrets(page map[string]interface{}) {
+	resources, _ := page["resources"].([]interface{})
+	for _, resource := range resources {
+		resourceMap, _ := resource.(map[string]interface{})
+		if entity, ok := resourceMap["entity"].(map[string]interface{}); ok {
+			for _, field := range secretFields {
+				delete(entity, field)
+			}
+		}
+	}
+}
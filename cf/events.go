@@ -0,0 +1,133 @@
+package cf
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	gocf "github.com/cloudfoundry-community/go-cfclient"
+)
+
+// appChangeEvents are the audit events of an app being created, changed or deleted
+var appChangeEvents = []string{
+	"audit.app.create",
+	"audit.app.update",
+	"audit.app.delete-request",
+	"audit.app.start",
+	"audit.app.stop",
+	"audit.app.restage",
+	"audit.app.droplet.mapped",
+	"audit.app.map-route",
+	"audit.app.unmap-route",
+}
+
+// ListAppChanges returns the events of apps being created, changed or
+// deleted since a time, one per app in the order they were first changed.
+// Event timestamps only have second precision, so the events stamped with the
+// same second as since are included. Apps updated without an event being
+// recorded, as listed by the v3 API, are added at the end as updates.
+func (client *Client) ListAppChanges(since time.Time) ([]gocf.AppEventEntity, error) {
+	events := []gocf.AppEventEntity{}
+	changed := map[string]bool{}
+	add := func(event gocf.AppEventEntity) {
+		if !changed[event.Actee] {
+			changed[event.Actee] = true
+			events = append(events, event)
+		}
+	}
+
+	filters := []string{
+		"type IN " + strings.Join(appChangeEvents, ","),
+		"timestamp>=" + since.UTC().Format(time.RFC3339),
+	}
+	err := client.eachResourceWhere("events", filters, func(decode func(interface{}) error) error {
+		var event gocf.AppEventEntity
+		if err := decode(&event); err != nil {
+			return err
+		}
+		add(event)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	updatedApps, err := client.listAppsUpdatedSince(since)
+	if err != nil {
+		return nil, err
+	}
+	for _, app := range updatedApps {
+		add(gocf.AppEventEntity{Actee: app.GUID, ActeeType: "app", EventType: "audit.app.update", Timestamp: app.UpdatedAt})
+	}
+
+	return events, nil
+}
+
+type v3UpdatedApp struct {
+	GUID      string    `json:"guid"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type v3UpdatedAppsResponse struct {
+	Pagination struct {
+		TotalPages int `json:"total_pages"`
+	} `json:"pagination"`
+	Resources []v3UpdatedApp `json:"resources"`
+}
+
+// listAppsUpdatedSince returns the apps updated at or after a time from the
+// v3 API, the pages after the first at once
+func (client *Client) listAppsUpdatedSince(since time.Time) ([]v3UpdatedApp, error) {
+	start := time.Now()
+	pageURL := func(page int) string {
+		query := url.Values{
+			"updated_ats[gte]": []string{since.UTC().Format(time.RFC3339)},
+			"page":             []string{strconv.Itoa(page)},
+			"per_page":         []string{strconv.Itoa(maxPerPage)},
+		}
+		return "/v3/apps?" + query.Encode()
+	}
+
+	var first v3UpdatedAppsResponse
+	if err := client.getJSON(pageURL(1), &first); err != nil {
+		return nil, err
+	}
+
+	pages := make([]v3UpdatedAppsResponse, first.Pagination.TotalPages)
+	if len(pages) == 0 {
+		pages = make([]v3UpdatedAppsResponse, 1)
+	}
+	pages[0] = first
+	err := client.fetchPages(len(pages), func(page int) error {
+		return client.getJSON(pageURL(page), &pages[page-1])
+	})
+	if err != nil {
+		return nil, err
+	}
+	client.recordStats(ListStats{Resource: "v3/apps", Pages: len(pages), Duration: time.Since(start)})
+
+	apps := []v3UpdatedApp{}
+	for _, page := range pages {
+		apps = append(apps, page.Resources...)
+	}
+	return apps, nil
+}
+
+// GetApp returns an app, or false if it does not exist
+func (client *Client) GetApp(appGUID string) (gocf.App, bool, error) {
+	var resource v2Resource
+	err := client.getJSON("/v2/apps/"+appGUID, &resource)
+	if cfErr, ok := err.(gocf.CloudFoundryError); ok && cfErr.ErrorCode == "CF-AppNotFound" {
+		return gocf.App{}, false, nil
+	}
+	if err != nil {
+		return gocf.App{}, false, err
+	}
+
+	var app gocf.App
+	if err = resource.decode(&app); err != nil {
+		return gocf.App{}, false, err
+	}
+	return app, true, nil
+}
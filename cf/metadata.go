@@ -0,0 +1,75 @@
+package cf
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Metadata contains the labels and annotations of a v3 resource
+type Metadata struct {
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+type v3MetadataResponse struct {
+	Pagination struct {
+		TotalPages int `json:"total_pages"`
+	} `json:"pagination"`
+	Resources []struct {
+		GUID     string   `json:"guid"`
+		Metadata Metadata `json:"metadata"`
+	} `json:"resources"`
+}
+
+// GetAppMetadata returns a map of app GUID to its labels and annotations
+func (client *Client) GetAppMetadata() (map[string]Metadata, error) {
+	return client.listMetadata("/v3/apps")
+}
+
+// GetSpaceMetadata returns a map of space GUID to its labels and annotations
+func (client *Client) GetSpaceMetadata() (map[string]Metadata, error) {
+	return client.listMetadata("/v3/spaces")
+}
+
+// GetOrgMetadata returns a map of org GUID to its labels and annotations
+func (client *Client) GetOrgMetadata() (map[string]Metadata, error) {
+	return client.listMetadata("/v3/organizations")
+}
+
+// listMetadata fetches every page of a v3 resource list, the pages after the
+// first at once. The v2 client does not know about v3, so the requests are
+// made with its raw request helpers.
+func (client *Client) listMetadata(path string) (map[string]Metadata, error) {
+	start := time.Now()
+	pageURL := func(page int) string {
+		return fmt.Sprintf("%s?page=%d&per_page=%d", path, page, maxPerPage)
+	}
+
+	var first v3MetadataResponse
+	if err := client.getJSON(pageURL(1), &first); err != nil {
+		return nil, err
+	}
+
+	pages := make([]v3MetadataResponse, first.Pagination.TotalPages)
+	if len(pages) == 0 {
+		pages = make([]v3MetadataResponse, 1)
+	}
+	pages[0] = first
+	err := client.fetchPages(len(pages), func(page int) error {
+		return client.getJSON(pageURL(page), &pages[page-1])
+	})
+	if err != nil {
+		return nil, err
+	}
+	client.recordStats(ListStats{Resource: strings.TrimPrefix(path, "/"), Pages: len(pages), Duration: time.Since(start)})
+
+	metadataMap := map[string]Metadata{}
+	for _, page := range pages {
+		for _, resource := range page.Resources {
+			metadataMap[resource.GUID] = resource.Metadata
+		}
+	}
+
+	return metadataMap, nil
+}
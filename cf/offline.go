@@ -0,0 +1,287 @@
+package cf
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	gocf "github.com/cloudfoundry-community/go-cfclient"
+)
+
+var errOffline = errors.New("not available offline")
+
+// OfflineClient reads a foundation from a directory of saved Cloud Controller
+// responses, as written by Dump. Each resource is read from <resource>.json
+// and any further pages from <resource>-2.json, <resource>-3.json and so on,
+// eg apps.json for /v2/apps. Apps, buildpacks, organizations and spaces are
+// required; every other resource is empty if it was not saved. Live instance
+// states and stats cannot be saved, so they are always empty.
+type OfflineClient struct {
+	dir string
+
+	mutex sync.Mutex
+	// appRoutes maps app GUID to its saved routes. It is read from the
+	// directory once per scrape, on the first call to GetAppRoutes.
+	appRoutes map[string][]gocf.Route
+}
+
+// NewOfflineClient returns a client reading the responses saved in a directory
+func NewOfflineClient(dir string) *OfflineClient {
+	return &OfflineClient{dir: dir}
+}
+
+// pages returns the files of a saved resource in page order
+func (client *OfflineClient) pages(resource string) ([]string, error) {
+	first := filepath.Join(client.dir, resource+".json")
+	if _, err := os.Stat(first); err != nil {
+		return nil, err
+	}
+
+	more, err := filepath.Glob(filepath.Join(client.dir, resource+"-*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(more, func(i, j int) bool {
+		return pageNumber(more[i]) < pageNumber(more[j])
+	})
+
+	return append([]string{first}, more...), nil
+}
+
+func pageNumber(path string) int {
+	base := strings.TrimSuffix(filepath.Base(path), ".json")
+	n, _ := strconv.Atoi(base[strings.LastIndex(base, "-")+1:])
+	return n
+}
+
+// requiredResources are the lists the dashboard cannot do without
+var requiredResources = map[string]bool{
+	"apps":          true,
+	"buildpacks":    true,
+	"organizations": true,
+	"spaces":        true,
+}
+
+// eachResource calls each with a decoder for every resource of a saved list.
+// A missing optional list has no resources.
+func (client *OfflineClient) eachResource(resource string, each func(decode func(v interface{}) error) error) error {
+	pages, err := client.pages(resource)
+	if os.IsNotExist(err) && !requiredResources[resource] {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, path := range pages {
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var page v2Page
+		if err = json.Unmarshal(contents, &page); err != nil {
+			return fmt.Errorf("could not parse %s: %s", path, err)
+		}
+
+		for _, res := range page.Resources {
+			decode := func(v interface{}) error {
+				if err := res.decode(v); err != nil {
+					return fmt.Errorf("could not parse %s: %s", path, err)
+				}
+				return nil
+			}
+			if err = each(decode); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// ReAuth forgets the routes read by the last scrape, so that the next one
+// reads them again. There is no API to authenticate with.
+func (client *OfflineClient) ReAuth() error {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.appRoutes = nil
+	return nil
+}
+
+// ListApps returns the saved apps
+func (client *OfflineClient) ListApps() ([]gocf.App, error) {
+	return listApps(client.eachResource)
+}
+
+// GetBuildpacks returns a map of buildpack GUID to the saved buildpack
+func (client *OfflineClient) GetBuildpacks() (map[string]gocf.Buildpack, error) {
+	return listBuildpacks(client.eachResource)
+}
+
+// GetOrgs returns a map of org GUID to the saved org
+func (client *OfflineClient) GetOrgs() (map[string]gocf.Org, error) {
+	return listOrgs(client.eachResource)
+}
+
+// GetSpaces returns a map of space GUID to the saved space
+func (client *OfflineClient) GetSpaces() (map[string]gocf.Space, error) {
+	return listSpaces(client.eachResource)
+}
+
+// GetOrgQuotas returns a map of org quota definition GUID to the saved quota
+func (client *OfflineClient) GetOrgQuotas() (map[string]gocf.OrgQuota, error) {
+	return listOrgQuotas(client.eachResource)
+}
+
+// GetSpaceQuotas returns a map of space quota definition GUID to the saved quota
+func (client *OfflineClient) GetSpaceQuotas() (map[string]gocf.SpaceQuota, error) {
+	return listSpaceQuotas(client.eachResource)
+}
+
+// GetAppInstances returns no instances, as instance states are live
+func (client *OfflineClient) GetAppInstances(appGUID string) (map[string]gocf.AppInstance, error) {
+	return map[string]gocf.AppInstance{}, nil
+}
+
+// GetAppStats returns no stats, as resource usage is live
+func (client *OfflineClient) GetAppStats(appGUID string) (map[string]gocf.AppStats, error) {
+	return map[string]gocf.AppStats{}, nil
+}
+
+// GetRoutes returns a map of route GUID to the saved route
+func (client *OfflineClient) GetRoutes() (map[string]gocf.Route, error) {
+	return listRoutes(client.eachResource)
+}
+
+// GetDomains returns a map of domain GUID to the saved private and shared domains
+func (client *OfflineClient) GetDomains() (map[string]gocf.Domain, error) {
+	return listDomains(client.eachResource)
+}
+
+// GetAppRoutes returns the saved routes mapped to an app
+func (client *OfflineClient) GetAppRoutes(appGUID string) ([]gocf.Route, error) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if client.appRoutes == nil {
+		appRoutes, err := client.readAppRoutes()
+		if err != nil {
+			return nil, err
+		}
+		client.appRoutes = appRoutes
+	}
+
+	return append([]gocf.Route{}, client.appRoutes[appGUID]...), nil
+}
+
+// readAppRoutes returns a map of app GUID to the saved routes mapped to it
+func (client *OfflineClient) readAppRoutes() (map[string][]gocf.Route, error) {
+	routeMap, err := client.GetRoutes()
+	if err != nil {
+		return nil, err
+	}
+
+	appRoutes := map[string][]gocf.Route{}
+	err = client.eachResource("route_mappings", func(decode func(interface{}) error) error {
+		var mapping struct {
+			AppGUID   string `json:"app_guid"`
+			RouteGUID string `json:"route_guid"`
+		}
+		if err := decode(&mapping); err != nil {
+			return err
+		}
+		if route, ok := routeMap[mapping.RouteGUID]; ok {
+			appRoutes[mapping.AppGUID] = append(appRoutes[mapping.AppGUID], route)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return appRoutes, nil
+}
+
+// GetServiceInstances returns a map of service instance GUID to the saved instance
+func (client *OfflineClient) GetServiceInstances() (map[string]gocf.ServiceInstance, error) {
+	return listServiceInstances(client.eachResource)
+}
+
+// GetUserProvidedServiceInstances returns a map of user provided service instance GUID to the saved instance
+func (client *OfflineClient) GetUserProvidedServiceInstances() (map[string]gocf.UserProvidedServiceInstance, error) {
+	return listUserProvidedServiceInstances(client.eachResource)
+}
+
+// GetServiceBindings returns a map of service binding GUID to the saved binding
+func (client *OfflineClient) GetServiceBindings() (map[string]gocf.ServiceBinding, error) {
+	return listServiceBindings(client.eachResource)
+}
+
+// GetServices returns a map of service GUID to the saved service offering
+func (client *OfflineClient) GetServices() (map[string]gocf.Service, error) {
+	return listServices(client.eachResource)
+}
+
+// GetServicePlans returns a map of service plan GUID to the saved plan
+func (client *OfflineClient) GetServicePlans() (map[string]gocf.ServicePlan, error) {
+	return listServicePlans(client.eachResource)
+}
+
+// GetAppMetadata returns a map of app GUID to its saved labels and annotations
+func (client *OfflineClient) GetAppMetadata() (map[string]Metadata, error) {
+	return client.readMetadata("v3_apps")
+}
+
+// GetSpaceMetadata returns a map of space GUID to its saved labels and annotations
+func (client *OfflineClient) GetSpaceMetadata() (map[string]Metadata, error) {
+	return client.readMetadata("v3_spaces")
+}
+
+// GetOrgMetadata returns a map of org GUID to its saved labels and annotations
+func (client *OfflineClient) GetOrgMetadata() (map[string]Metadata, error) {
+	return client.readMetadata("v3_organizations")
+}
+
+func (client *OfflineClient) readMetadata(resource string) (map[string]Metadata, error) {
+	metadataMap := map[string]Metadata{}
+	pages, err := client.pages(resource)
+	if os.IsNotExist(err) {
+		return metadataMap, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range pages {
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var metadataResp v3MetadataResponse
+		if err = json.Unmarshal(contents, &metadataResp); err != nil {
+			return nil, fmt.Errorf("could not parse %s: %s", path, err)
+		}
+		for _, resource := range metadataResp.Resources {
+			metadataMap[resource.GUID] = resource.Metadata
+		}
+	}
+
+	return metadataMap, nil
+}
+
+// GetUserSpaces fails as user roles are not saved
+func (client *OfflineClient) GetUserSpaces(userGUID string) (map[string]gocf.Space, error) {
+	return nil, errOffline
+}
+
+// GetUserOrgs fails as user roles are not saved
+func (client *OfflineClient) GetUserOrgs(userGUID string) (map[string]gocf.Org, error) {
+	return nil, errOffline
+}
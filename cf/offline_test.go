@@ -0,0 +1,254 @@
+package cf_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/FidelityInternational/cf-loupe/helpers"
+
+	. "github.com/FidelityInternational/cf-loupe/cf"
+)
+
+var _ = Describe("Offline mode", func() {
+	var fakeAPI *helpers.FakeApi
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "cf-loupe-offline")
+		Expect(err).To(Succeed())
+
+		fakeAPI = helpers.NewFakeApi()
+		pages := map[string]string{
+			"/v2/apps": `{"total_results": 2, "total_pages": 2, "next_url": "/v2/apps?page=2&results-per-page=100", "resources": [
+				{"metadata": {"guid": "app-1", "updated_at": "2017-08-12T16:41:45Z"},
+				 "entity": {"name": "app1", "space_guid": "space-1", "detected_buildpack_guid": "buildpack-1", "state": "STARTED",
+				            "environment_json": {"DATABASE_PASSWORD": "correct-horse"},
+				            "docker_credentials": {"username": "deployer", "password": "battery-staple"}}}
+			]}`,
+			"/v2/buildpacks": `{"resources": [
+				{"metadata": {"guid": "buildpack-1"}, "entity": {"name": "ruby_buildpack", "filename": "ruby_buildpack-cached-v2.0.2.zip"}}
+			]}`,
+			"/v2/organizations": `{"resources": [{"metadata": {"guid": "org-1"}, "entity": {"name": "project-x"}}]}`,
+			"/v2/spaces":        `{"resources": [{"metadata": {"guid": "space-1"}, "entity": {"name": "dev", "organization_guid": "org-1"}}]}`,
+			"/v2/routes":        `{"resources": [{"metadata": {"guid": "route-1"}, "entity": {"host": "app1", "domain_guid": "domain-1"}}]}`,
+			"/v2/route_mappings": `{"resources": [
+				{"metadata": {"guid": "mapping-1"}, "entity": {"app_guid": "app-1", "route_guid": "route-1"}}
+			]}`,
+			"/v2/shared_domains": `{"resources": [{"metadata": {"guid": "domain-1"}, "entity": {"name": "example.com"}}]}`,
+			"/v2/user_provided_service_instances": `{"resources": [
+				{"metadata": {"guid": "ups-1"}, "entity": {"name": "secrets", "credentials": {"password": "hunter2"}}}
+			]}`,
+			"/v3/apps": `{"pagination": {"next": null}, "resources": [
+				{"guid": "app-1", "metadata": {"labels": {"team": "alpha"}, "annotations": {}}}
+			]}`,
+		}
+		secondPage := `{"total_results": 2, "total_pages": 2, "next_url": null, "resources": [
+			{"metadata": {"guid": "app-2", "updated_at": "2017-08-13T16:41:45Z"},
+			 "entity": {"name": "app2", "space_guid": "space-1", "detected_buildpack_guid": "buildpack-1", "state": "STOPPED"}}
+		]}`
+		for _, path := range []string{
+			"/v2/apps", "/v2/buildpacks", "/v2/organizations", "/v2/spaces", "/v2/quota_definitions",
+			"/v2/space_quota_definitions", "/v2/routes", "/v2/route_mappings", "/v2/private_domains",
+			"/v2/shared_domains", "/v2/service_instances", "/v2/user_provided_service_instances",
+			"/v2/service_bindings", "/v2/services", "/v2/service_plans",
+			"/v3/apps", "/v3/spaces", "/v3/organizations",
+		} {
+			path := path
+			fakeAPI.Mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+				page, ok := pages[path]
+				if !ok {
+					page = `{"resources": []}`
+				}
+				if r.URL.Query().Get("page") == "2" {
+					page = secondPage
+				}
+				fmt.Fprint(w, page)
+			})
+		}
+	})
+
+	AfterEach(func() {
+		fakeAPI.TeardownFakeApi()
+		os.RemoveAll(dir)
+	})
+
+	dump := func() {
+		clients, err := BuildClientsFromEnvironment([]string{
+			"CF_USERNAME_1=admin",
+			"CF_PASSWORD_1=1234",
+			"CF_FOUNDATION_1=dev",
+			fmt.Sprintf("CF_API_1=%s", fakeAPI.Server.URL),
+		})
+		Expect(err).To(Succeed())
+		Expect(clients["dev"].(*Client).Dump(dir)).To(Succeed())
+	}
+
+	It("saves every page of every resource", func() {
+		dump()
+
+		Expect(filepath.Join(dir, "apps.json")).To(BeAnExistingFile())
+		Expect(filepath.Join(dir, "apps-2.json")).To(BeAnExistingFile())
+		Expect(filepath.Join(dir, "service_plans.json")).To(BeAnExistingFile())
+		Expect(filepath.Join(dir, "v3_apps.json")).To(BeAnExistingFile())
+	})
+
+	It("removes the pages of an earlier dump", func() {
+		Expect(ioutil.WriteFile(filepath.Join(dir, "apps-3.json"), []byte(`{"resources": []}`), 0644)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(dir, "notes.json"), []byte(`{}`), 0644)).To(Succeed())
+		dump()
+
+		Expect(filepath.Join(dir, "apps-2.json")).To(BeAnExistingFile())
+		Expect(filepath.Join(dir, "apps-3.json")).NotTo(BeAnExistingFile())
+		Expect(filepath.Join(dir, "notes.json")).To(BeAnExistingFile())
+	})
+
+	It("does not save credentials", func() {
+		dump()
+
+		contents, err := ioutil.ReadFile(filepath.Join(dir, "user_provided_service_instances.json"))
+		Expect(err).To(Succeed())
+		Expect(string(contents)).To(ContainSubstring("secrets"))
+		Expect(string(contents)).NotTo(ContainSubstring("hunter2"))
+	})
+
+	It("does not save the environment variables or docker credentials of apps", func() {
+		dump()
+
+		contents, err := ioutil.ReadFile(filepath.Join(dir, "apps.json"))
+		Expect(err).To(Succeed())
+		Expect(string(contents)).To(ContainSubstring("app1"))
+		Expect(string(contents)).NotTo(ContainSubstring("DATABASE_PASSWORD"))
+		Expect(string(contents)).NotTo(ContainSubstring("correct-horse"))
+		Expect(string(contents)).NotTo(ContainSubstring("battery-staple"))
+	})
+
+	It("reads back what was saved", func() {
+		dump()
+		client := NewOfflineClient(dir)
+
+		apps, err := client.ListApps()
+		Expect(err).To(Succeed())
+		Expect(apps).To(HaveLen(2))
+		Expect(apps[0].Guid).To(Equal("app-1"))
+		Expect(apps[0].Name).To(Equal("app1"))
+		Expect(apps[0].UpdatedAt).To(Equal("2017-08-12T16:41:45Z"))
+		Expect(apps[1].Guid).To(Equal("app-2"))
+
+		buildpacks, err := client.GetBuildpacks()
+		Expect(err).To(Succeed())
+		Expect(buildpacks["buildpack-1"].Filename).To(Equal("ruby_buildpack-cached-v2.0.2.zip"))
+
+		spaces, err := client.GetSpaces()
+		Expect(err).To(Succeed())
+		Expect(spaces["space-1"].OrganizationGuid).To(Equal("org-1"))
+
+		routes, err := client.GetAppRoutes("app-1")
+		Expect(err).To(Succeed())
+		Expect(routes).To(HaveLen(1))
+		Expect(routes[0].Host).To(Equal("app1"))
+		routes, err = client.GetAppRoutes("app-2")
+		Expect(err).To(Succeed())
+		Expect(routes).To(BeEmpty())
+
+		domains, err := client.GetDomains()
+		Expect(err).To(Succeed())
+		Expect(domains["domain-1"].Name).To(Equal("example.com"))
+
+		metadata, err := client.GetAppMetadata()
+		Expect(err).To(Succeed())
+		Expect(metadata["app-1"].Labels).To(HaveKeyWithValue("team", "alpha"))
+
+		instances, err := client.GetAppInstances("app-1")
+		Expect(err).To(Succeed())
+		Expect(instances).To(BeEmpty())
+	})
+
+	It("treats missing optional resources as empty", func() {
+		for _, resource := range []string{"apps", "buildpacks", "organizations", "spaces"} {
+			Expect(ioutil.WriteFile(filepath.Join(dir, resource+".json"), []byte(`{"resources": []}`), 0644)).To(Succeed())
+		}
+		client := NewOfflineClient(dir)
+
+		serviceInstances, err := client.GetServiceInstances()
+		Expect(err).To(Succeed())
+		Expect(serviceInstances).To(BeEmpty())
+
+		metadata, err := client.GetOrgMetadata()
+		Expect(err).To(Succeed())
+		Expect(metadata).To(BeEmpty())
+	})
+
+	It("fails if apps, buildpacks, orgs or spaces were not saved", func() {
+		client := NewOfflineClient(dir)
+
+		_, err := client.ListApps()
+		Expect(err).To(HaveOccurred())
+		_, err = client.GetOrgs()
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("reads the routes once per scrape", func() {
+		dump()
+		client := NewOfflineClient(dir)
+		Expect(client.ReAuth()).To(Succeed())
+
+		_, err := client.GetAppRoutes("app-1")
+		Expect(err).To(Succeed())
+		Expect(os.Remove(filepath.Join(dir, "route_mappings.json"))).To(Succeed())
+		routes, err := client.GetAppRoutes("app-1")
+		Expect(err).To(Succeed())
+		Expect(routes).To(HaveLen(1))
+
+		Expect(client.ReAuth()).To(Succeed())
+		routes, err = client.GetAppRoutes("app-1")
+		Expect(err).To(Succeed())
+		Expect(routes).To(BeEmpty())
+	})
+
+	It("does not know about user roles", func() {
+		_, err := NewOfflineClient(dir).GetUserSpaces("user-1")
+		Expect(err).To(MatchError("not available offline"))
+	})
+
+	Context("When a foundation is configured with CF_OFFLINE_DIR", func() {
+		var env []string
+
+		BeforeEach(func() {
+			env = []string{
+				"CF_FOUNDATION_1=airgapped",
+				"CF_OFFLINE_DIR_1=" + dir,
+				"CF_USERNAME_2=admin",
+				"CF_PASSWORD_2=1234",
+				"CF_FOUNDATION_2=dev",
+				fmt.Sprintf("CF_API_2=%s", fakeAPI.Server.URL),
+			}
+		})
+
+		It("does not need credentials for it", func() {
+			foundationConfigs, err := BuildClientConfigFromEnvironment(env)
+			Expect(err).To(Succeed())
+			Expect(foundationConfigs).NotTo(HaveKey("airgapped"))
+			Expect(foundationConfigs).To(HaveKey("dev"))
+		})
+
+		It("reads it from the directory", func() {
+			clients, err := BuildClientsFromEnvironment(env)
+			Expect(err).To(Succeed())
+			Expect(clients["airgapped"]).To(BeAssignableToTypeOf(&OfflineClient{}))
+			Expect(clients["dev"]).To(BeAssignableToTypeOf(&Client{}))
+		})
+
+		It("can be the only foundation", func() {
+			clients, err := BuildClientsFromEnvironment(env[:2])
+			Expect(err).To(Succeed())
+			Expect(clients).To(HaveLen(1))
+		})
+	})
+})
@@ -0,0 +1,179 @@
+package cf
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// maxResultsPerPage is the largest page the v2 API returns
+	maxResultsPerPage = 100
+	// maxPerPage is the largest page the v3 API returns
+	maxPerPage = 5000
+
+	defaultPageWorkers = 4
+)
+
+// ListStats describes how a list was fetched
+type ListStats struct {
+	Resource string
+	Pages    int
+	Duration time.Duration
+}
+
+type v2Page struct {
+	TotalPages int          `json:"total_pages"`
+	Resources  []v2Resource `json:"resources"`
+}
+
+type v2Resource struct {
+	Metadata json.RawMessage `json:"metadata"`
+	Entity   json.RawMessage `json:"entity"`
+}
+
+// decode fills in a go-cfclient struct from the entity, then its GUID and
+// timestamps from the metadata, as go-cfclient does
+func (resource v2Resource) decode(v interface{}) error {
+	if err := json.Unmarshal(resource.Entity, v); err != nil {
+		return err
+	}
+	if len(resource.Metadata) > 0 {
+		return json.Unmarshal(resource.Metadata, v)
+	}
+	return nil
+}
+
+// eachResource calls each with a decoder for every resource of a v2 list, eg
+// apps for /v2/apps. The first page says how many pages there are, then the
+// rest are fetched at once, up to the client's page workers at a time.
+func (client *Client) eachResource(resource string, each func(decode func(v interface{}) error) error) error {
+	return client.eachResourceWhere(resource, nil, each)
+}
+
+// eachResourceWhere is eachResource for the resources matching every v2
+// filter, eg timestamp>2017-08-15T15:00:06Z
+func (client *Client) eachResourceWhere(resource string, filters []string, each func(decode func(v interface{}) error) error) error {
+	start := time.Now()
+	path := "/v2/" + resource
+
+	var first v2Page
+	if err := client.getJSON(v2PageURL(path, 1, filters), &first); err != nil {
+		return err
+	}
+
+	pages := make([]v2Page, first.TotalPages)
+	if len(pages) == 0 {
+		pages = make([]v2Page, 1)
+	}
+	pages[0] = first
+	err := client.fetchPages(len(pages), func(page int) error {
+		return client.getJSON(v2PageURL(path, page, filters), &pages[page-1])
+	})
+	if err != nil {
+		return err
+	}
+	client.recordStats(ListStats{Resource: resource, Pages: len(pages), Duration: time.Since(start)})
+
+	for _, page := range pages {
+		for _, res := range page.Resources {
+			decode := func(v interface{}) error {
+				if err := res.decode(v); err != nil {
+					return fmt.Errorf("could not parse %s: %s", path, err)
+				}
+				return nil
+			}
+			if err := each(decode); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func v2PageURL(path string, page int, filters []string) string {
+	query := url.Values{
+		"page":             []string{strconv.Itoa(page)},
+		"results-per-page": []string{strconv.Itoa(maxResultsPerPage)},
+	}
+	for _, filter := range filters {
+		query.Add("q", filter)
+	}
+	return path + "?" + query.Encode()
+}
+
+// fetchPages calls fetch for pages 2 to totalPages, up to the client's page
+// workers at a time, returning the first error
+func (client *Client) fetchPages(totalPages int, fetch func(page int) error) error {
+	workers := client.options.PageWorkers
+	if workers <= 0 {
+		workers = defaultPageWorkers
+	}
+
+	pageNumbers := make(chan int)
+	errs := make(chan error, totalPages)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for page := range pageNumbers {
+				if err := fetch(page); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+
+	for page := 2; page <= totalPages; page++ {
+		pageNumbers <- page
+	}
+	close(pageNumbers)
+	wg.Wait()
+	close(errs)
+
+	return <-errs
+}
+
+func (client *Client) getJSON(requestURL string, v interface{}) error {
+	gocfClient := client.currentGocfClient()
+	resp, err := gocfClient.DoRequest(gocfClient.NewRequest("GET", requestURL))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (client *Client) recordStats(stats ListStats) {
+	client.statsMutex.Lock()
+	defer client.statsMutex.Unlock()
+
+	client.stats = append(client.stats, stats)
+}
+
+// TakeStats returns how each list was fetched since the last call
+func (client *Client) TakeStats() []ListStats {
+	client.statsMutex.Lock()
+	defer client.statsMutex.Unlock()
+
+	stats := client.stats
+	client.stats = nil
+	return stats
+}
+
+// TakeTokenRefreshes returns how many times the access token was refreshed
+// since the last call
+func (client *Client) TakeTokenRefreshes() int {
+	client.statsMutex.Lock()
+	defer client.statsMutex.Unlock()
+
+	tokenRefreshes := client.tokenRefreshes
+	client.tokenRefreshes = 0
+	return tokenRefreshes
+}
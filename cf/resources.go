@@ -0,0 +1,197 @@
+package cf
+
+import (
+	gocf "github.com/cloudfoundry-community/go-cfclient"
+)
+
+// resourceLister calls each with a decoder for every resource of a v2 list,
+// eg apps for /v2/apps. The live and offline clients both list with these
+// functions, so they return the same shapes.
+type resourceLister func(resource string, each func(decode func(v interface{}) error) error) error
+
+// listApps returns the apps
+func listApps(list resourceLister) ([]gocf.App, error) {
+	apps := []gocf.App{}
+	err := list("apps", func(decode func(interface{}) error) error {
+		var app gocf.App
+		if err := decode(&app); err != nil {
+			return err
+		}
+		apps = append(apps, app)
+		return nil
+	})
+	return apps, err
+}
+
+// listBuildpacks returns a map of buildpack GUID to buildpack
+func listBuildpacks(list resourceLister) (map[string]gocf.Buildpack, error) {
+	buildpackMap := map[string]gocf.Buildpack{}
+	err := list("buildpacks", func(decode func(interface{}) error) error {
+		var buildpack gocf.Buildpack
+		if err := decode(&buildpack); err != nil {
+			return err
+		}
+		buildpackMap[buildpack.Guid] = buildpack
+		return nil
+	})
+	return buildpackMap, err
+}
+
+// listOrgs returns a map of org GUID to org
+func listOrgs(list resourceLister) (map[string]gocf.Org, error) {
+	orgMap := map[string]gocf.Org{}
+	err := list("organizations", func(decode func(interface{}) error) error {
+		var org gocf.Org
+		if err := decode(&org); err != nil {
+			return err
+		}
+		orgMap[org.Guid] = org
+		return nil
+	})
+	return orgMap, err
+}
+
+// listSpaces returns a map of space GUID to space
+func listSpaces(list resourceLister) (map[string]gocf.Space, error) {
+	spaceMap := map[string]gocf.Space{}
+	err := list("spaces", func(decode func(interface{}) error) error {
+		var space gocf.Space
+		if err := decode(&space); err != nil {
+			return err
+		}
+		spaceMap[space.Guid] = space
+		return nil
+	})
+	return spaceMap, err
+}
+
+// listOrgQuotas returns a map of org quota definition GUID to quota
+func listOrgQuotas(list resourceLister) (map[string]gocf.OrgQuota, error) {
+	orgQuotaMap := map[string]gocf.OrgQuota{}
+	err := list("quota_definitions", func(decode func(interface{}) error) error {
+		var orgQuota gocf.OrgQuota
+		if err := decode(&orgQuota); err != nil {
+			return err
+		}
+		orgQuotaMap[orgQuota.Guid] = orgQuota
+		return nil
+	})
+	return orgQuotaMap, err
+}
+
+// listSpaceQuotas returns a map of space quota definition GUID to quota
+func listSpaceQuotas(list resourceLister) (map[string]gocf.SpaceQuota, error) {
+	spaceQuotaMap := map[string]gocf.SpaceQuota{}
+	err := list("space_quota_definitions", func(decode func(interface{}) error) error {
+		var spaceQuota gocf.SpaceQuota
+		if err := decode(&spaceQuota); err != nil {
+			return err
+		}
+		spaceQuotaMap[spaceQuota.Guid] = spaceQuota
+		return nil
+	})
+	return spaceQuotaMap, err
+}
+
+// listRoutes returns a map of route GUID to route
+func listRoutes(list resourceLister) (map[string]gocf.Route, error) {
+	routeMap := map[string]gocf.Route{}
+	err := list("routes", func(decode func(interface{}) error) error {
+		var route gocf.Route
+		if err := decode(&route); err != nil {
+			return err
+		}
+		routeMap[route.Guid] = route
+		return nil
+	})
+	return routeMap, err
+}
+
+// listDomains returns a map of domain GUID to private or shared domain
+func listDomains(list resourceLister) (map[string]gocf.Domain, error) {
+	domainMap := map[string]gocf.Domain{}
+	for _, resource := range []string{"private_domains", "shared_domains"} {
+		err := list(resource, func(decode func(interface{}) error) error {
+			var domain gocf.Domain
+			if err := decode(&domain); err != nil {
+				return err
+			}
+			domainMap[domain.Guid] = domain
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return domainMap, nil
+}
+
+// listServiceInstances returns a map of service instance GUID to instance
+func listServiceInstances(list resourceLister) (map[string]gocf.ServiceInstance, error) {
+	serviceInstanceMap := map[string]gocf.ServiceInstance{}
+	err := list("service_instances", func(decode func(interface{}) error) error {
+		var serviceInstance gocf.ServiceInstance
+		if err := decode(&serviceInstance); err != nil {
+			return err
+		}
+		serviceInstanceMap[serviceInstance.Guid] = serviceInstance
+		return nil
+	})
+	return serviceInstanceMap, err
+}
+
+// listUserProvidedServiceInstances returns a map of user provided service instance GUID to instance
+func listUserProvidedServiceInstances(list resourceLister) (map[string]gocf.UserProvidedServiceInstance, error) {
+	userProvidedServiceInstanceMap := map[string]gocf.UserProvidedServiceInstance{}
+	err := list("user_provided_service_instances", func(decode func(interface{}) error) error {
+		var userProvidedServiceInstance gocf.UserProvidedServiceInstance
+		if err := decode(&userProvidedServiceInstance); err != nil {
+			return err
+		}
+		userProvidedServiceInstanceMap[userProvidedServiceInstance.Guid] = userProvidedServiceInstance
+		return nil
+	})
+	return userProvidedServiceInstanceMap, err
+}
+
+// listServiceBindings returns a map of service binding GUID to binding
+func listServiceBindings(list resourceLister) (map[string]gocf.ServiceBinding, error) {
+	serviceBindingMap := map[string]gocf.ServiceBinding{}
+	err := list("service_bindings", func(decode func(interface{}) error) error {
+		var serviceBinding gocf.ServiceBinding
+		if err := decode(&serviceBinding); err != nil {
+			return err
+		}
+		serviceBindingMap[serviceBinding.Guid] = serviceBinding
+		return nil
+	})
+	return serviceBindingMap, err
+}
+
+// listServices returns a map of service GUID to service offering
+func listServices(list resourceLister) (map[string]gocf.Service, error) {
+	serviceMap := map[string]gocf.Service{}
+	err := list("services", func(decode func(interface{}) error) error {
+		var service gocf.Service
+		if err := decode(&service); err != nil {
+			return err
+		}
+		serviceMap[service.Guid] = service
+		return nil
+	})
+	return serviceMap, err
+}
+
+// listServicePlans returns a map of service plan GUID to plan
+func listServicePlans(list resourceLister) (map[string]gocf.ServicePlan, error) {
+	servicePlanMap := map[string]gocf.ServicePlan{}
+	err := list("service_plans", func(decode func(interface{}) error) error {
+		var servicePlan gocf.ServicePlan
+		if err := decode(&servicePlan); err != nil {
+			return err
+		}
+		servicePlanMap[servicePlan.Guid] = servicePlan
+		return nil
+	})
+	return servicePlanMap, err
+}
@@ -0,0 +1,187 @@
+package cf
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxRetries   = 3
+	defaultRetryBackoff = 250 * time.Millisecond
+	// maxRetryBackoff caps the backoff between retries, but not Retry-After
+	maxRetryBackoff = 30 * time.Second
+)
+
+// throttle limits the rate and concurrency of the requests made to the Cloud
+// Controller of a foundation, and retries those that fail with a server
+// error, 429 Too Many Requests or a network error. It is shared by every
+// go-cfclient client a Client makes, so the limits hold across ReAuth.
+type throttle struct {
+	// interval is the least time between the start of two requests, or zero
+	interval time.Duration
+	// slots holds a value for every request in flight. It is nil when
+	// concurrency is not limited.
+	slots        chan struct{}
+	maxRetries   int
+	retryBackoff time.Duration
+
+	mutex sync.Mutex
+	next  time.Time
+}
+
+func newThrottle(options ClientOptions) *throttle {
+	t := &throttle{
+		maxRetries:   options.MaxRetries,
+		retryBackoff: options.RetryBackoff,
+	}
+	if options.RateLimit > 0 {
+		t.interval = time.Duration(float64(time.Second) / options.RateLimit)
+	}
+	if options.MaxConcurrency > 0 {
+		t.slots = make(chan struct{}, options.MaxConcurrency)
+	}
+	if t.retryBackoff <= 0 {
+		t.retryBackoff = defaultRetryBackoff
+	}
+	return t
+}
+
+// wrap returns a transport that sends requests through the throttle
+func (t *throttle) wrap(base http.RoundTripper) http.RoundTripper {
+	return &throttledTransport{base: base, throttle: t}
+}
+
+// waitTurn blocks until a request may start without exceeding the rate limit
+func (t *throttle) waitTurn() {
+	if t.interval == 0 {
+		return
+	}
+
+	t.mutex.Lock()
+	now := time.Now()
+	start := t.next
+	if start.Before(now) {
+		start = now
+	}
+	t.next = start.Add(t.interval)
+	t.mutex.Unlock()
+
+	time.Sleep(start.Sub(now))
+}
+
+func (t *throttle) acquire() {
+	if t.slots != nil {
+		t.slots <- struct{}{}
+	}
+}
+
+func (t *throttle) release() {
+	if t.slots != nil {
+		<-t.slots
+	}
+}
+
+// backoff returns how long to wait before retrying a request for the nth
+// time, starting at 0. It is the response's Retry-After if it has one, or
+// an exponential backoff with jitter.
+func (t *throttle) backoff(retry int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if delay, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+			return delay
+		}
+	}
+
+	delay := t.retryBackoff << uint(retry)
+	if delay <= 0 || delay > maxRetryBackoff {
+		delay = maxRetryBackoff
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// retryAfter parses a Retry-After header, either seconds or an HTTP date
+func retryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		delay := time.Until(date)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+	return 0, false
+}
+
+// retryable says if a request that failed may be sent again. Only requests
+// that don't change anything are retried.
+func retryable(req *http.Request, resp *http.Response, err error) bool {
+	if req.Method != "GET" && req.Method != "HEAD" {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError
+}
+
+type throttledTransport struct {
+	base     http.RoundTripper
+	throttle *throttle
+}
+
+func (transport *throttledTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t := transport.throttle
+	for retry := 0; ; retry++ {
+		t.waitTurn()
+		t.acquire()
+		resp, err := transport.base.RoundTrip(req)
+		if retry >= t.maxRetries || !retryable(req, resp, err) {
+			if err != nil {
+				t.release()
+				return nil, err
+			}
+			// The request is in flight until its body has been read
+			resp.Body = &releasingBody{ReadCloser: resp.Body, release: t.release}
+			return resp, nil
+		}
+
+		delay := t.backoff(retry, resp)
+		if err == nil {
+			err = errors.New(resp.Status)
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		t.release()
+
+		log.Printf("retrying %s %s in %s: %s\n", req.Method, req.URL.Path, delay.Round(time.Millisecond), err)
+		select {
+		case <-time.After(delay):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+// releasingBody releases a throttle slot once the response body is closed
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+func (body *releasingBody) Close() error {
+	err := body.ReadCloser.Close()
+	body.once.Do(body.release)
+	return err
+}
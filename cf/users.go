@@ -0,0 +1,47 @@
+package cf
+
+import (
+	gocf "github.com/cloudfoundry-community/go-cfclient"
+)
+
+// GetUserSpaces returns a map of space GUID to space details for every space
+// a user is a developer, auditor or manager of
+func (client *Client) GetUserSpaces(userGUID string) (map[string]gocf.Space, error) {
+	spaceMap := map[string]gocf.Space{}
+	for _, list := range []func(string) ([]gocf.Space, error){
+		client.currentGocfClient().ListUserSpaces,
+		client.currentGocfClient().ListUserAuditedSpaces,
+		client.currentGocfClient().ListUserManagedSpaces,
+	} {
+		spaceList, err := list(userGUID)
+		if err != nil {
+			return nil, err
+		}
+		for _, space := range spaceList {
+			spaceMap[space.Guid] = space
+		}
+	}
+
+	return spaceMap, nil
+}
+
+// GetUserOrgs returns a map of org GUID to org details for every org a user is
+// a manager or auditor of. Plain org users are left out as they can only see
+// the spaces they have a role in.
+func (client *Client) GetUserOrgs(userGUID string) (map[string]gocf.Org, error) {
+	orgMap := map[string]gocf.Org{}
+	for _, list := range []func(string) ([]gocf.Org, error){
+		client.currentGocfClient().ListUserManagedOrgs,
+		client.currentGocfClient().ListUserAuditedOrgs,
+	} {
+		orgList, err := list(userGUID)
+		if err != nil {
+			return nil, err
+		}
+		for _, org := range orgList {
+			orgMap[org.Guid] = org
+		}
+	}
+
+	return orgMap, nil
+}
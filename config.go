@@ -0,0 +1,404 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FidelityInternational/cf-loupe/alert"
+	"github.com/FidelityInternational/cf-loupe/applist"
+	"github.com/FidelityInternational/cf-loupe/auth"
+	"github.com/FidelityInternational/cf-loupe/cf"
+	"github.com/FidelityInternational/cf-loupe/notify"
+	"github.com/FidelityInternational/cf-loupe/publish"
+)
+
+const (
+	defaultRightSizingThreshold = 25.0
+	defaultFullSyncInterval     = time.Hour
+	defaultStatusScrapes        = 20
+)
+
+// Config contains the optional settings of the dashboard
+type Config struct {
+	AppList applist.Options
+
+	// RightSizingThreshold is the percentage of its memory quota under which
+	// an app is reported as over-provisioned
+	RightSizingThreshold float64
+
+	// RefreshInterval is how often to scrape in the background, starting at
+	// start up. Scrapes are only made when the data is requested if it is zero.
+	RefreshInterval time.Duration
+
+	// IncrementalRefresh only fetches the apps that changed since the last
+	// scrape, and everything else every FullSyncInterval
+	IncrementalRefresh bool
+	FullSyncInterval   time.Duration
+
+	// StatusScrapes is how many of the last scrapes /status shows
+	StatusScrapes int
+
+	// ReadyMaxAge is the age of the last successful scrape above which
+	// /readyz reports Loupe as not ready
+	ReadyMaxAge time.Duration
+
+	Digest  notify.Options
+	Alerts  alert.Options
+	Publish publish.Options
+	Auth    auth.Options
+
+	// SecondaryInstance is true on every Cloud Foundry instance but the
+	// first. They do not send digests, alerts or events, so that those are
+	// only sent once.
+	SecondaryInstance bool
+
+	Visibility VisibilityOptions
+}
+
+// readyMaxAge is the configured max age or, with background refresh, three
+// refreshes. Scrapes are cached for a minute, so refreshes are at least a
+// minute apart. Without background refresh, snapshots may be of any age.
+func (config Config) readyMaxAge() time.Duration {
+	if config.ReadyMaxAge > 0 {
+		return config.ReadyMaxAge
+	}
+	if config.RefreshInterval <= 0 {
+		return 0
+	}
+	if config.RefreshInterval < time.Minute {
+		return 3 * time.Minute
+	}
+	return 3 * config.RefreshInterval
+}
+
+func (config Config) statusScrapes() int {
+	if config.StatusScrapes <= 0 {
+		return defaultStatusScrapes
+	}
+	return config.StatusScrapes
+}
+
+// BuildConfigFromEnvironment looks at environment variables and returns the
+// dashboard configuration. Every setting is optional.
+func BuildConfigFromEnvironment(env []string) (Config, error) {
+	config := Config{
+		RightSizingThreshold: defaultRightSizingThreshold,
+		FullSyncInterval:     defaultFullSyncInterval,
+		StatusScrapes:        defaultStatusScrapes,
+	}
+	envMap := map[string]string{}
+	for _, envVar := range env {
+		parts := strings.SplitN(envVar, "=", 2)
+		if len(parts) == 2 {
+			envMap[parts[0]] = parts[1]
+		}
+	}
+
+	var err error
+	if config.AppList.InstanceHealth, err = boolFromEnv(envMap, "LOUPE_INSTANCE_HEALTH", false); err != nil {
+		return Config{}, err
+	}
+	if config.AppList.ResourceUsage, err = boolFromEnv(envMap, "LOUPE_RESOURCE_USAGE", false); err != nil {
+		return Config{}, err
+	}
+	if config.AppList.Routes, err = boolFromEnv(envMap, "LOUPE_ROUTES", false); err != nil {
+		return Config{}, err
+	}
+	if config.AppList.Services, err = boolFromEnv(envMap, "LOUPE_SERVICES", false); err != nil {
+		return Config{}, err
+	}
+	if config.AppList.Metadata, err = boolFromEnv(envMap, "LOUPE_METADATA", false); err != nil {
+		return Config{}, err
+	}
+	if config.AppList.Capacity, err = boolFromEnv(envMap, "LOUPE_CAPACITY", false); err != nil {
+		return Config{}, err
+	}
+	if value, ok := envMap["LOUPE_OWNER_KEYS"]; ok {
+		config.AppList.OwnerKeys = strings.Split(value, ",")
+	}
+	if config.AppList.InstanceWorkers, err = positiveIntFromEnv(envMap, "LOUPE_INSTANCE_WORKERS", 0); err != nil {
+		return Config{}, err
+	}
+	if config.AppList.CapacityWarningPercent, err = percentFromEnv(envMap, "LOUPE_CAPACITY_WARNING_THRESHOLD", 0); err != nil {
+		return Config{}, err
+	}
+	if config.RightSizingThreshold, err = percentFromEnv(envMap, "LOUPE_RIGHT_SIZING_THRESHOLD", defaultRightSizingThreshold); err != nil {
+		return Config{}, err
+	}
+
+	if value, ok := envMap["LOUPE_REFRESH_INTERVAL"]; ok {
+		if config.RefreshInterval, err = time.ParseDuration(value); err != nil || config.RefreshInterval <= 0 {
+			return Config{}, fmt.Errorf("LOUPE_REFRESH_INTERVAL must be a positive duration, got %q", value)
+		}
+	}
+	if config.IncrementalRefresh, err = boolFromEnv(envMap, "LOUPE_INCREMENTAL_REFRESH", false); err != nil {
+		return Config{}, err
+	}
+	if value, ok := envMap["LOUPE_FULL_SYNC_INTERVAL"]; ok {
+		if config.FullSyncInterval, err = time.ParseDuration(value); err != nil || config.FullSyncInterval <= 0 {
+			return Config{}, fmt.Errorf("LOUPE_FULL_SYNC_INTERVAL must be a positive duration, got %q", value)
+		}
+	}
+	if config.StatusScrapes, err = positiveIntFromEnv(envMap, "LOUPE_STATUS_SCRAPES", defaultStatusScrapes); err != nil {
+		return Config{}, err
+	}
+	if value, ok := envMap["LOUPE_READY_MAX_AGE"]; ok {
+		if config.ReadyMaxAge, err = time.ParseDuration(value); err != nil || config.ReadyMaxAge <= 0 {
+			return Config{}, fmt.Errorf("LOUPE_READY_MAX_AGE must be a positive duration, got %q", value)
+		}
+	}
+	if config.Digest, err = digestOptionsFromEnv(envMap); err != nil {
+		return Config{}, err
+	}
+	if value, ok := envMap["LOUPE_ALERT_CHANNELS"]; ok {
+		if config.Alerts.Channels, err = alert.ParseChannels(value); err != nil {
+			return Config{}, fmt.Errorf("LOUPE_ALERT_CHANNELS is invalid: %s", err)
+		}
+	}
+	if value, ok := envMap["LOUPE_ALERT_DEDUP_WINDOW"]; ok {
+		window, err := time.ParseDuration(value)
+		if err != nil || window <= 0 {
+			return Config{}, fmt.Errorf("LOUPE_ALERT_DEDUP_WINDOW must be a positive duration, got %q", value)
+		}
+		config.Alerts.DedupWindow = window
+	}
+
+	if config.Publish, err = publishOptionsFromEnv(envMap); err != nil {
+		return Config{}, err
+	}
+	if value, ok := envMap["CF_INSTANCE_INDEX"]; ok {
+		config.SecondaryInstance = value != "0"
+	}
+	if config.Auth, err = authOptionsFromEnv(env, envMap); err != nil {
+		return Config{}, err
+	}
+	if value, ok := envMap["LOUPE_API_TOKENS_FILE"]; ok {
+		if config.Auth.Tokens, err = auth.LoadTokens(value); err != nil {
+			return Config{}, fmt.Errorf("LOUPE_API_TOKENS_FILE is invalid: %s", err)
+		}
+	}
+	if config.Visibility, err = visibilityOptionsFromEnv(envMap, config.Auth); err != nil {
+		return Config{}, err
+	}
+
+	return config, nil
+}
+
+func publishOptionsFromEnv(envMap map[string]string) (publish.Options, error) {
+	options := publish.Options{
+		Sink:   envMap["LOUPE_PUBLISH_SINK"],
+		URL:    envMap["LOUPE_PUBLISH_URL"],
+		Secret: envMap["LOUPE_PUBLISH_SECRET"],
+		File:   envMap["LOUPE_PUBLISH_FILE"],
+	}
+
+	var err error
+	if options.Retries, err = positiveIntFromEnv(envMap, "LOUPE_PUBLISH_RETRIES", 0); err != nil {
+		return publish.Options{}, err
+	}
+	if value, ok := envMap["LOUPE_PUBLISH_BACKOFF"]; ok {
+		if options.Backoff, err = time.ParseDuration(value); err != nil || options.Backoff <= 0 {
+			return publish.Options{}, fmt.Errorf("LOUPE_PUBLISH_BACKOFF must be a positive duration, got %q", value)
+		}
+	}
+
+	if options.Enabled() {
+		if _, err = options.NewSink(); err != nil {
+			return publish.Options{}, fmt.Errorf("LOUPE_PUBLISH_SINK is invalid: %s", err)
+		}
+	}
+
+	return options, nil
+}
+
+func digestOptionsFromEnv(envMap map[string]string) (notify.Options, error) {
+	options := notify.Options{
+		From: envMap["LOUPE_DIGEST_FROM"],
+		Recipients: notify.Recipients{
+			Default: envMap["LOUPE_DIGEST_DEFAULT_RECIPIENT"],
+		},
+		SMTP: notify.SMTPSender{
+			Addr:     envMap["LOUPE_SMTP_ADDR"],
+			Username: envMap["LOUPE_SMTP_USERNAME"],
+			Password: envMap["LOUPE_SMTP_PASSWORD"],
+		},
+		DryRunDir: envMap["LOUPE_DIGEST_DRY_RUN_DIR"],
+	}
+
+	if value, ok := envMap["LOUPE_DIGEST_INTERVAL"]; ok {
+		interval, err := time.ParseDuration(value)
+		if err != nil || interval <= 0 {
+			return notify.Options{}, fmt.Errorf("LOUPE_DIGEST_INTERVAL must be a positive duration, got %q", value)
+		}
+		options.Interval = interval
+	}
+
+	if value, ok := envMap["LOUPE_DIGEST_RECIPIENTS"]; ok {
+		options.Recipients.Addresses = map[string]string{}
+		for _, recipient := range strings.Split(value, ",") {
+			parts := strings.SplitN(recipient, "=", 2)
+			if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+				return notify.Options{}, fmt.Errorf("LOUPE_DIGEST_RECIPIENTS must be a list of key=address, got %q", value)
+			}
+			options.Recipients.Addresses[parts[0]] = parts[1]
+		}
+	}
+
+	if options.Enabled() {
+		if options.From == "" {
+			return notify.Options{}, errors.New("LOUPE_DIGEST_FROM must be set to send digests")
+		}
+		if options.DryRunDir == "" && options.SMTP.Addr == "" {
+			return notify.Options{}, errors.New("LOUPE_SMTP_ADDR or LOUPE_DIGEST_DRY_RUN_DIR must be set to send digests")
+		}
+	}
+
+	return options, nil
+}
+
+func boolFromEnv(envMap map[string]string, key string, defaultValue bool) (bool, error) {
+	value, ok := envMap[key]
+	if !ok {
+		return defaultValue, nil
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%s must be true or false, got %q", key, value)
+	}
+	return b, nil
+}
+
+func positiveIntFromEnv(envMap map[string]string, key string, defaultValue int) (int, error) {
+	value, ok := envMap[key]
+	if !ok {
+		return defaultValue, nil
+	}
+
+	i, err := strconv.Atoi(value)
+	if err != nil || i < 1 {
+		return 0, fmt.Errorf("%s must be a positive number, got %q", key, value)
+	}
+	return i, nil
+}
+
+func percentFromEnv(envMap map[string]string, key string, defaultValue float64) (float64, error) {
+	value, ok := envMap[key]
+	if !ok {
+		return defaultValue, nil
+	}
+
+	percent, err := strconv.ParseFloat(value, 64)
+	if err != nil || percent <= 0 || percent > 100 {
+		return 0, fmt.Errorf("%s must be a percentage, got %q", key, value)
+	}
+	return percent, nil
+}
+
+func authOptionsFromEnv(env []string, envMap map[string]string) (auth.Options, error) {
+	options := auth.Options{
+		Issuer:        envMap["LOUPE_AUTH_ISSUER"],
+		ClientID:      envMap["LOUPE_AUTH_CLIENT_ID"],
+		ClientSecret:  envMap["LOUPE_AUTH_CLIENT_SECRET"],
+		ExternalURL:   envMap["LOUPE_AUTH_EXTERNAL_URL"],
+		SessionSecret: envMap["LOUPE_AUTH_SESSION_SECRET"],
+	}
+	if value, ok := envMap["LOUPE_AUTH_SCOPES"]; ok {
+		options.Scopes = strings.Split(value, ",")
+	}
+	if value, ok := envMap["LOUPE_AUTH_SESSION_TTL"]; ok {
+		ttl, err := time.ParseDuration(value)
+		if err != nil || ttl <= 0 {
+			return auth.Options{}, fmt.Errorf("LOUPE_AUTH_SESSION_TTL must be a positive duration, got %q", value)
+		}
+		options.SessionTTL = ttl
+	}
+
+	mode := envMap["LOUPE_AUTH_MODE"]
+	switch mode {
+	case "":
+		return auth.Options{}, nil
+	case auth.ModeBasic:
+		options.Mode = auth.ModeBasic
+		options.Users = map[string]string{}
+		for _, user := range strings.Split(envMap["LOUPE_AUTH_USERS"], ",") {
+			parts := strings.SplitN(user, ":", 2)
+			if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+				return auth.Options{}, errors.New("LOUPE_AUTH_USERS must be a list of username:password")
+			}
+			options.Users[parts[0]] = parts[1]
+		}
+		return options, nil
+	case auth.ModeOIDC:
+		if options.Issuer == "" {
+			return auth.Options{}, errors.New("LOUPE_AUTH_ISSUER must be set for oidc authentication")
+		}
+	case "uaa":
+		foundation := envMap["LOUPE_AUTH_FOUNDATION"]
+		foundationConfigs, err := cf.BuildClientConfigFromEnvironment(env)
+		if err != nil {
+			return auth.Options{}, err
+		}
+		foundationConfig, ok := foundationConfigs[foundation]
+		if !ok {
+			return auth.Options{}, fmt.Errorf("LOUPE_AUTH_FOUNDATION must name a foundation, got %q", foundation)
+		}
+		options.CFAPI = foundationConfig.ApiAddress
+		if options.Scopes == nil {
+			options.Scopes = []string{"openid"}
+		}
+	default:
+		return auth.Options{}, fmt.Errorf("LOUPE_AUTH_MODE must be basic, oidc or uaa, got %q", mode)
+	}
+
+	options.Mode = auth.ModeOIDC
+	if options.ClientID == "" {
+		return auth.Options{}, errors.New("LOUPE_AUTH_CLIENT_ID must be set for oidc and uaa authentication")
+	}
+	return options, nil
+}
+
+func visibilityOptionsFromEnv(envMap map[string]string, authOptions auth.Options) (VisibilityOptions, error) {
+	options := VisibilityOptions{
+		Mode: envMap["LOUPE_VISIBILITY"],
+	}
+	if value, ok := envMap["LOUPE_VISIBILITY_ADMIN_USERS"]; ok {
+		options.AdminUsers = strings.Split(value, ",")
+	}
+	if value, ok := envMap["LOUPE_VISIBILITY_ADMIN_GROUPS"]; ok {
+		options.AdminGroups = strings.Split(value, ",")
+	}
+	if value, ok := envMap["LOUPE_VISIBILITY_GROUPS"]; ok {
+		options.Groups = map[string][]string{}
+		for _, mapping := range strings.Split(value, ",") {
+			parts := strings.SplitN(mapping, "=", 2)
+			if len(parts) != 2 || parts[0] == "" || strings.Count(parts[1], "/") < 1 || strings.Count(parts[1], "/") > 2 {
+				return VisibilityOptions{}, fmt.Errorf("LOUPE_VISIBILITY_GROUPS must be a list of group=foundation/org[/space], got %q", value)
+			}
+			options.Groups[parts[0]] = append(options.Groups[parts[0]], parts[1])
+		}
+	}
+
+	switch options.Mode {
+	case "":
+		return VisibilityOptions{}, nil
+	case VisibilityRoles:
+		if authOptions.Mode != auth.ModeOIDC {
+			return VisibilityOptions{}, errors.New("LOUPE_VISIBILITY=roles needs LOUPE_AUTH_MODE=uaa or oidc to know the user")
+		}
+	case VisibilityGroups:
+		if !authOptions.Enabled() {
+			return VisibilityOptions{}, errors.New("LOUPE_VISIBILITY=groups needs LOUPE_AUTH_MODE to know the user")
+		}
+		if len(options.Groups) == 0 {
+			return VisibilityOptions{}, errors.New("LOUPE_VISIBILITY_GROUPS must be set for groups visibility")
+		}
+	default:
+		return VisibilityOptions{}, fmt.Errorf("LOUPE_VISIBILITY must be roles or groups, got %q", options.Mode)
+	}
+
+	return options, nil
+}
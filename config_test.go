@@ -0,0 +1,262 @@
+package main_test
+
+import (
+	"time"
+
+	. "github.com/FidelityInternational/cf-loupe"
+	"github.com/FidelityInternational/cf-loupe/auth"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("BuildConfigFromEnvironment", func() {
+	Context("When no settings are given", func() {
+		It("returns the default configuration", func() {
+			config, err := BuildConfigFromEnvironment([]string{"SHELL=/bin/zsh"})
+			Expect(err).To(Succeed())
+			Expect(config).To(Equal(Config{RightSizingThreshold: 25, FullSyncInterval: time.Hour, StatusScrapes: 20}))
+		})
+	})
+
+	Context("When instance health is enabled", func() {
+		It("returns the instance health settings", func() {
+			config, err := BuildConfigFromEnvironment([]string{
+				"LOUPE_INSTANCE_HEALTH=true",
+				"LOUPE_INSTANCE_WORKERS=4",
+			})
+			Expect(err).To(Succeed())
+			Expect(config.AppList.InstanceHealth).To(BeTrue())
+			Expect(config.AppList.InstanceWorkers).To(Equal(4))
+		})
+	})
+
+	Context("When resource usage is enabled", func() {
+		It("returns the resource usage settings", func() {
+			config, err := BuildConfigFromEnvironment([]string{
+				"LOUPE_RESOURCE_USAGE=true",
+				"LOUPE_RIGHT_SIZING_THRESHOLD=40",
+			})
+			Expect(err).To(Succeed())
+			Expect(config.AppList.ResourceUsage).To(BeTrue())
+			Expect(config.RightSizingThreshold).To(Equal(40.0))
+		})
+	})
+
+	Context("When background refresh is enabled", func() {
+		It("returns the refresh interval", func() {
+			config, err := BuildConfigFromEnvironment([]string{"LOUPE_REFRESH_INTERVAL=5m"})
+			Expect(err).To(Succeed())
+			Expect(config.RefreshInterval).To(Equal(5 * time.Minute))
+		})
+	})
+
+	Context("When the readiness max age is set", func() {
+		It("returns the max age", func() {
+			config, err := BuildConfigFromEnvironment([]string{"LOUPE_READY_MAX_AGE=10m"})
+			Expect(err).To(Succeed())
+			Expect(config.ReadyMaxAge).To(Equal(10 * time.Minute))
+		})
+
+		It("returns an error when it is invalid", func() {
+			_, err := BuildConfigFromEnvironment([]string{"LOUPE_READY_MAX_AGE=soon"})
+			Expect(err).To(MatchError(`LOUPE_READY_MAX_AGE must be a positive duration, got "soon"`))
+		})
+	})
+
+	Context("When incremental refresh is enabled", func() {
+		It("returns the full sync interval", func() {
+			config, err := BuildConfigFromEnvironment([]string{
+				"LOUPE_INCREMENTAL_REFRESH=true",
+				"LOUPE_FULL_SYNC_INTERVAL=6h",
+			})
+			Expect(err).To(Succeed())
+			Expect(config.IncrementalRefresh).To(BeTrue())
+			Expect(config.FullSyncInterval).To(Equal(6 * time.Hour))
+		})
+
+		It("fully syncs every hour by default", func() {
+			config, err := BuildConfigFromEnvironment([]string{"LOUPE_INCREMENTAL_REFRESH=true"})
+			Expect(err).To(Succeed())
+			Expect(config.FullSyncInterval).To(Equal(time.Hour))
+		})
+
+		It("returns an error when the full sync interval is invalid", func() {
+			_, err := BuildConfigFromEnvironment([]string{"LOUPE_FULL_SYNC_INTERVAL=0s"})
+			Expect(err).To(MatchError(`LOUPE_FULL_SYNC_INTERVAL must be a positive duration, got "0s"`))
+		})
+	})
+
+	Context("When capacity is enabled", func() {
+		It("returns the capacity settings", func() {
+			config, err := BuildConfigFromEnvironment([]string{
+				"LOUPE_CAPACITY=true",
+				"LOUPE_CAPACITY_WARNING_THRESHOLD=90",
+			})
+			Expect(err).To(Succeed())
+			Expect(config.AppList.Capacity).To(BeTrue())
+			Expect(config.AppList.CapacityWarningPercent).To(Equal(90.0))
+		})
+	})
+
+	Context("When metadata is enabled", func() {
+		It("returns the metadata settings", func() {
+			config, err := BuildConfigFromEnvironment([]string{
+				"LOUPE_METADATA=true",
+				"LOUPE_OWNER_KEYS=squad,team",
+			})
+			Expect(err).To(Succeed())
+			Expect(config.AppList.Metadata).To(BeTrue())
+			Expect(config.AppList.OwnerKeys).To(Equal([]string{"squad", "team"}))
+		})
+	})
+
+	Context("When digests are enabled", func() {
+		It("returns the digest settings", func() {
+			config, err := BuildConfigFromEnvironment([]string{
+				"LOUPE_DIGEST_INTERVAL=24h",
+				"LOUPE_DIGEST_FROM=loupe@example.com",
+				"LOUPE_DIGEST_RECIPIENTS=payments=payments@example.com,project-x/dev=dev@example.com",
+				"LOUPE_SMTP_ADDR=smtp.example.com:25",
+			})
+			Expect(err).To(Succeed())
+			Expect(config.Digest.Enabled()).To(BeTrue())
+			Expect(config.Digest.Interval).To(Equal(24 * time.Hour))
+			Expect(config.Digest.Recipients.Addresses).To(Equal(map[string]string{
+				"payments":      "payments@example.com",
+				"project-x/dev": "dev@example.com",
+			}))
+			Expect(config.Digest.SMTP.Addr).To(Equal("smtp.example.com:25"))
+		})
+
+		It("requires somewhere to send them", func() {
+			_, err := BuildConfigFromEnvironment([]string{
+				"LOUPE_DIGEST_INTERVAL=24h",
+				"LOUPE_DIGEST_FROM=loupe@example.com",
+			})
+			Expect(err).To(MatchError("LOUPE_SMTP_ADDR or LOUPE_DIGEST_DRY_RUN_DIR must be set to send digests"))
+		})
+	})
+
+	Context("When alerts are enabled", func() {
+		It("returns the alert channels", func() {
+			config, err := BuildConfigFromEnvironment([]string{
+				`LOUPE_ALERT_CHANNELS=[{"name": "platform", "type": "slack", "url": "https://hooks.example.com/abc", "foundations": ["prod"]}]`,
+				"LOUPE_ALERT_DEDUP_WINDOW=6h",
+			})
+			Expect(err).To(Succeed())
+			Expect(config.Alerts.Enabled()).To(BeTrue())
+			Expect(config.Alerts.Channels[0].Foundations).To(Equal([]string{"prod"}))
+			Expect(config.Alerts.DedupWindow).To(Equal(6 * time.Hour))
+		})
+	})
+
+	Context("When events are published", func() {
+		It("returns the publish settings", func() {
+			config, err := BuildConfigFromEnvironment([]string{
+				"LOUPE_PUBLISH_SINK=webhook",
+				"LOUPE_PUBLISH_URL=https://events.example.com",
+				"LOUPE_PUBLISH_SECRET=s3cret",
+				"LOUPE_PUBLISH_RETRIES=5",
+			})
+			Expect(err).To(Succeed())
+			Expect(config.Publish.Enabled()).To(BeTrue())
+			Expect(config.Publish.Retries).To(Equal(5))
+		})
+
+		It("rejects an incomplete sink", func() {
+			_, err := BuildConfigFromEnvironment([]string{"LOUPE_PUBLISH_SINK=file"})
+			Expect(err).To(MatchError("LOUPE_PUBLISH_SINK is invalid: the file sink needs a file"))
+		})
+	})
+
+	Context("When running on Cloud Foundry", func() {
+		It("only sends notifications from the first instance", func() {
+			config, err := BuildConfigFromEnvironment([]string{"CF_INSTANCE_INDEX=0"})
+			Expect(err).To(Succeed())
+			Expect(config.SecondaryInstance).To(BeFalse())
+
+			config, err = BuildConfigFromEnvironment([]string{"CF_INSTANCE_INDEX=1"})
+			Expect(err).To(Succeed())
+			Expect(config.SecondaryInstance).To(BeTrue())
+		})
+	})
+
+	Context("When authentication is enabled", func() {
+		It("returns the basic auth users", func() {
+			config, err := BuildConfigFromEnvironment([]string{
+				"LOUPE_AUTH_MODE=basic",
+				"LOUPE_AUTH_USERS=alice:s3cret,bob:hunter2",
+			})
+			Expect(err).To(Succeed())
+			Expect(config.Auth.Mode).To(Equal(auth.ModeBasic))
+			Expect(config.Auth.Users).To(Equal(map[string]string{"alice": "s3cret", "bob": "hunter2"}))
+		})
+
+		It("uses the UAA of the chosen foundation", func() {
+			config, err := BuildConfigFromEnvironment([]string{
+				"CF_USERNAME_1=admin",
+				"CF_PASSWORD_1=1234",
+				"CF_FOUNDATION_1=dev",
+				"CF_API_1=https://api.dev.example.com",
+				"LOUPE_AUTH_MODE=uaa",
+				"LOUPE_AUTH_FOUNDATION=dev",
+				"LOUPE_AUTH_CLIENT_ID=loupe",
+			})
+			Expect(err).To(Succeed())
+			Expect(config.Auth.Mode).To(Equal(auth.ModeOIDC))
+			Expect(config.Auth.CFAPI).To(Equal("https://api.dev.example.com"))
+			Expect(config.Auth.Scopes).To(Equal([]string{"openid"}))
+		})
+
+		It("requires an issuer in oidc mode", func() {
+			_, err := BuildConfigFromEnvironment([]string{"LOUPE_AUTH_MODE=oidc"})
+			Expect(err).To(MatchError("LOUPE_AUTH_ISSUER must be set for oidc authentication"))
+		})
+	})
+
+	Context("When per-user visibility is enabled", func() {
+		It("returns the group mapping and admins", func() {
+			config, err := BuildConfigFromEnvironment([]string{
+				"LOUPE_AUTH_MODE=basic",
+				"LOUPE_AUTH_USERS=alice:s3cret",
+				"LOUPE_VISIBILITY=groups",
+				"LOUPE_VISIBILITY_GROUPS=team-a=dev/project-x,team-a=prod/project-x/live,team-b=dev/project-y",
+				"LOUPE_VISIBILITY_ADMIN_USERS=alice",
+				"LOUPE_VISIBILITY_ADMIN_GROUPS=platform",
+			})
+			Expect(err).To(Succeed())
+			Expect(config.Visibility).To(Equal(VisibilityOptions{
+				Mode: VisibilityGroups,
+				Groups: map[string][]string{
+					"team-a": {"dev/project-x", "prod/project-x/live"},
+					"team-b": {"dev/project-y"},
+				},
+				AdminUsers:  []string{"alice"},
+				AdminGroups: []string{"platform"},
+			}))
+		})
+
+		It("requires a login to know the user's roles", func() {
+			_, err := BuildConfigFromEnvironment([]string{"LOUPE_VISIBILITY=roles"})
+			Expect(err).To(MatchError("LOUPE_VISIBILITY=roles needs LOUPE_AUTH_MODE=uaa or oidc to know the user"))
+		})
+
+		It("rejects an invalid group mapping", func() {
+			_, err := BuildConfigFromEnvironment([]string{
+				"LOUPE_AUTH_MODE=basic",
+				"LOUPE_AUTH_USERS=alice:s3cret",
+				"LOUPE_VISIBILITY=groups",
+				"LOUPE_VISIBILITY_GROUPS=team-a",
+			})
+			Expect(err).To(MatchError(`LOUPE_VISIBILITY_GROUPS must be a list of group=foundation/org[/space], got "team-a"`))
+		})
+	})
+
+	Context("When a setting is invalid", func() {
+		It("returns a meaningful error", func() {
+			_, err := BuildConfigFromEnvironment([]string{"LOUPE_INSTANCE_WORKERS=none"})
+			Expect(err).To(MatchError(`LOUPE_INSTANCE_WORKERS must be a positive number, got "none"`))
+		})
+	})
+})
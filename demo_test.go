@@ -0,0 +1,67 @@
+package main_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/FidelityInternational/cf-loupe/applist"
+	"github.com/FidelityInternational/cf-loupe/cf"
+	"github.com/FidelityInternational/cf-loupe/helpers"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Demo fixtures", func() {
+	var ccs []*helpers.FakeCloudController
+	var cfClients map[string]cf.IClient
+
+	BeforeEach(func() {
+		foundations, err := helpers.FixtureFoundations("demo")
+		Expect(err).To(Succeed())
+
+		env := []string{}
+		for i, foundation := range foundations {
+			cc := helpers.NewFakeCloudController()
+			ccs = append(ccs, cc)
+			Expect(cc.LoadFixtures(filepath.Join("demo", foundation))).To(Succeed())
+			cc.ShiftTimestamps(time.Now())
+
+			env = append(env,
+				fmt.Sprintf("CF_FOUNDATION_%d=%s", i+1, foundation),
+				fmt.Sprintf("CF_API_%d=%s", i+1, cc.Server.URL),
+				fmt.Sprintf("CF_USERNAME_%d=demo", i+1),
+				fmt.Sprintf("CF_PASSWORD_%d=demo", i+1),
+			)
+		}
+
+		cfClients, err = cf.BuildClientsFromEnvironment(env)
+		Expect(err).To(Succeed())
+	})
+
+	AfterEach(func() {
+		for _, cc := range ccs {
+			cc.Close()
+		}
+		ccs = nil
+	})
+
+	It("show apps that need attention in every foundation", func() {
+		appData, err := applist.BuildAppData(cfClients, time.Now(), applist.Options{
+			InstanceHealth: true,
+			Routes:         true,
+			Services:       true,
+			Metadata:       true,
+		})
+		Expect(err).To(Succeed())
+
+		Expect(cfClients).To(HaveLen(2))
+		Expect(appData.Summary.TotalApps).To(BeNumerically(">", 30))
+		Expect(appData.Summary.StaleApps).To(BeNumerically(">", 0))
+		Expect(appData.Summary.DeprecatedApps).To(BeNumerically(">", 0))
+		Expect(appData.Summary.CrashedApps).To(BeNumerically(">", 0))
+		Expect(appData.Routes).NotTo(BeNil())
+		Expect(appData.Services).NotTo(BeNil())
+	})
+})
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/FidelityInternational/cf-loupe/applist"
+	"github.com/FidelityInternational/cf-loupe/publish"
+)
+
+const sseHeartbeatInterval = 30 * time.Second
+
+// snapshotNotification is pushed to the dashboard after every successful scrape
+type snapshotNotification struct {
+	SnapshotID  int
+	Time        time.Time
+	Summary     applist.Summary
+	ChangedApps []string // keys of the apps added, changed or removed since the previous snapshot
+}
+
+// snapshot is a successful scrape, rendered for each client according to what
+// its user can see
+type snapshot struct {
+	id          int
+	time        time.Time
+	apps        []applist.App
+	summary     applist.Summary
+	changedApps []applist.App
+}
+
+// notification returns what a user with the given visibility is told about a snapshot
+func (s *snapshot) notification(visibility applist.Visibility) ([]byte, error) {
+	summary := s.summary
+	if !visibility.IsEverything() {
+		summary = applist.BuildSummary(visibility.FilterApps(s.apps))
+	}
+
+	changedApps := []string{}
+	for _, app := range visibility.FilterApps(s.changedApps) {
+		changedApps = append(changedApps, app.Key())
+	}
+
+	return json.Marshal(snapshotNotification{
+		SnapshotID:  s.id,
+		Time:        s.time,
+		Summary:     summary,
+		ChangedApps: changedApps,
+	})
+}
+
+// eventBroker pushes snapshot notifications to the connected dashboards
+type eventBroker struct {
+	timeNow    func() time.Time
+	visibility func(*http.Request) applist.Visibility
+
+	mutex   sync.Mutex
+	clients map[chan *snapshot]bool
+	latest  *snapshot
+}
+
+func newEventBroker(timeNow func() time.Time, visibility func(*http.Request) applist.Visibility) *eventBroker {
+	return &eventBroker{
+		timeNow:    timeNow,
+		visibility: visibility,
+		clients:    map[chan *snapshot]bool{},
+	}
+}
+
+// observe notifies every client of a successful scrape
+func (broker *eventBroker) observe(appData applist.AppData, err error) {
+	if err != nil {
+		return
+	}
+
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+
+	now := broker.timeNow()
+	latest := &snapshot{
+		id:          1,
+		time:        now,
+		apps:        appData.Apps,
+		summary:     appData.Summary,
+		changedApps: []applist.App{},
+	}
+	if broker.latest != nil {
+		latest.id = broker.latest.id + 1
+		for _, event := range publish.Changes(broker.latest.apps, appData.Apps, now) {
+			latest.changedApps = append(latest.changedApps, *event.App)
+		}
+	}
+	broker.latest = latest
+
+	for client := range broker.clients {
+		select {
+		case client <- latest:
+		default:
+			// the client is not keeping up, it will catch up on the next snapshot
+		}
+	}
+}
+
+func (broker *eventBroker) subscribe() (chan *snapshot, *snapshot) {
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+
+	client := make(chan *snapshot, 1)
+	broker.clients[client] = true
+	return client, broker.latest
+}
+
+func (broker *eventBroker) unsubscribe(client chan *snapshot) {
+	broker.mutex.Lock()
+	defer broker.mutex.Unlock()
+
+	delete(broker.clients, client)
+}
+
+// ServeHTTP streams snapshot notifications as server-sent events, starting
+// with the latest snapshot if there is one
+func (broker *eventBroker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		renderInternalServerError(w, fmt.Errorf("streaming is not supported"))
+		return
+	}
+	// the stream outlives the server's write timeout
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	visibility := broker.visibility(r)
+	send := func(s *snapshot) {
+		data, err := s.notification(visibility)
+		if err != nil {
+			return
+		}
+		fmt.Fprintf(w, "event: snapshot\ndata: %s\n\n", data)
+	}
+
+	client, latest := broker.subscribe()
+	defer broker.unsubscribe(client)
+
+	if latest != nil {
+		send(latest)
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case s := <-client:
+			send(s)
+			flusher.Flush()
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/FidelityInternational/cf-loupe/applist"
+)
+
+// healthPaths are served without authentication, so platform health checks
+// and monitoring can call them
+var healthPaths = []string{"/healthz", "/readyz"}
+
+// Health is the state /healthz reports. The process is alive if it answers.
+type Health struct {
+	Status string
+	Uptime string
+}
+
+// Readiness is the state /readyz reports. Loupe is ready once a scrape has
+// succeeded, as long as the last successful one is not older than the max
+// snapshot age.
+type Readiness struct {
+	Ready  bool
+	Reason string `json:",omitempty"`
+
+	// LastSnapshot is when the last successful scrape finished
+	LastSnapshot *time.Time `json:",omitempty"`
+	// SnapshotAge and MaxSnapshotAge are durations, eg 1m30s. MaxSnapshotAge
+	// is empty when snapshots may be of any age.
+	SnapshotAge    string `json:",omitempty"`
+	MaxSnapshotAge string `json:",omitempty"`
+
+	Foundations []FoundationReadiness
+}
+
+// FoundationReadiness is how a foundation was last scraped. /readyz is
+// public, so the error of the scrape is only logged.
+type FoundationReadiness struct {
+	Foundation    string
+	Scraped       bool
+	Authenticated bool
+}
+
+// buildReadiness says if the last successful scrape is recent enough, and
+// how each foundation was last scraped
+func buildReadiness(telemetry *applist.Telemetry, foundations []string, maxAge time.Duration, now time.Time) Readiness {
+	readiness := Readiness{Foundations: []FoundationReadiness{}}
+	if maxAge > 0 {
+		readiness.MaxSnapshotAge = maxAge.String()
+	}
+
+	sort.Strings(foundations)
+	for _, foundation := range foundations {
+		foundationReadiness := FoundationReadiness{Foundation: foundation}
+		if foundationScrape, ok := telemetry.LatestFoundation(foundation); ok {
+			foundationReadiness.Scraped = true
+			foundationReadiness.Authenticated = foundationScrape.Authenticated
+		}
+		readiness.Foundations = append(readiness.Foundations, foundationReadiness)
+	}
+
+	lastSuccess, ok := telemetry.LastSuccess()
+	if !ok {
+		readiness.Reason = "no scrape has succeeded yet"
+		return readiness
+	}
+
+	lastSnapshot := lastSuccess.Start.Add(lastSuccess.Duration)
+	age := now.Sub(lastSnapshot)
+	readiness.LastSnapshot = &lastSnapshot
+	readiness.SnapshotAge = age.Round(time.Second).String()
+	if maxAge > 0 && age > maxAge {
+		readiness.Reason = "the last successful scrape is older than " + maxAge.String()
+		return readiness
+	}
+
+	readiness.Ready = true
+	return readiness
+}
+
+func readinessStatus(readiness Readiness) int {
+	if readiness.Ready {
+		return http.StatusOK
+	}
+	return http.StatusServiceUnavailable
+}
@@ -0,0 +1,670 @@
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultPageSize = 100
+
+// V2Resource is a resource of a v2 list, eg an app of /v2/apps
+type V2Resource struct {
+	Metadata map[string]interface{} `json:"metadata"`
+	Entity   map[string]interface{} `json:"entity"`
+}
+
+// FakeCloudController is a Cloud Controller serving v2 and v3 lists from
+// memory. It paginates like the real API, can replay the responses saved by
+// cf-loupe dump, and can be told to fail or slow down.
+//
+// Any v2 or v3 list it has no resources for is empty. The instances of a
+// started app are all running unless they are set with SetAppInstances, and
+// the routes of an app are derived from /v2/route_mappings.
+type FakeCloudController struct {
+	*FakeApi
+
+	// PageSize is the largest page it returns, whatever the client asks for
+	PageSize int
+
+	mutex        sync.Mutex
+	lists        map[string][]map[string]interface{}
+	appInstances map[string]interface{}
+	appStats     map[string]interface{}
+	failures     map[string]*injectedFailure
+	retryAfter   string
+	latency      time.Duration
+	requests     []string
+	inFlight     int
+	maxInFlight  int
+}
+
+// NewFakeCloudController returns a running fake Cloud Controller with no resources
+func NewFakeCloudController() *FakeCloudController {
+	cc := &FakeCloudController{
+		FakeApi:      NewFakeApi(),
+		PageSize:     defaultPageSize,
+		lists:        map[string][]map[string]interface{}{},
+		appInstances: map[string]interface{}{},
+		appStats:     map[string]interface{}{},
+		failures:     map[string]*injectedFailure{},
+	}
+
+	cc.Mux.HandleFunc("/v2/", cc.serve)
+	cc.Mux.HandleFunc("/v3/", cc.serve)
+	return cc
+}
+
+// Close stops the Cloud Controller and its UAA
+func (cc *FakeCloudController) Close() {
+	cc.TeardownFakeApi()
+}
+
+// AddV2 adds resources to a v2 list, eg /v2/apps
+func (cc *FakeCloudController) AddV2(path string, resources ...V2Resource) {
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+
+	for _, resource := range resources {
+		if resource.Metadata == nil {
+			resource.Metadata = map[string]interface{}{}
+		}
+		if resource.Entity == nil {
+			resource.Entity = map[string]interface{}{}
+		}
+		if guid, ok := resource.Metadata["guid"].(string); ok {
+			resource.Metadata["url"] = path + "/" + guid
+		}
+		cc.lists[path] = append(cc.lists[path], map[string]interface{}{
+			"metadata": resource.Metadata,
+			"entity":   resource.Entity,
+		})
+	}
+}
+
+// AddV3 adds resources to a v3 list, eg /v3/apps
+func (cc *FakeCloudController) AddV3(path string, resources ...map[string]interface{}) {
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+
+	cc.lists[path] = append(cc.lists[path], resources...)
+}
+
+// SetAppInstances sets the response of /v2/apps/<guid>/instances
+func (cc *FakeCloudController) SetAppInstances(appGUID string, instances interface{}) {
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+
+	cc.appInstances[appGUID] = instances
+}
+
+// SetAppStats sets the response of /v2/apps/<guid>/stats
+func (cc *FakeCloudController) SetAppStats(appGUID string, stats interface{}) {
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+
+	cc.appStats[appGUID] = stats
+}
+
+// LoadFixtures adds the resources saved in a directory by cf-loupe dump.
+// apps.json and apps-2.json are replayed as /v2/apps and v3_apps.json as
+// /v3/apps. app_instances.json and app_stats.json, if they exist, map app
+// GUIDs to the responses of /v2/apps/<guid>/instances and /v2/apps/<guid>/stats.
+func (cc *FakeCloudController) LoadFixtures(dir string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		name := strings.TrimSuffix(filepath.Base(path), ".json")
+		switch name {
+		case "app_instances", "app_stats":
+			var responses map[string]interface{}
+			if err = json.Unmarshal(contents, &responses); err != nil {
+				return fmt.Errorf("could not parse %s: %s", path, err)
+			}
+			for appGUID, response := range responses {
+				if name == "app_instances" {
+					cc.SetAppInstances(appGUID, response)
+				} else {
+					cc.SetAppStats(appGUID, response)
+				}
+			}
+			continue
+		}
+
+		var page struct {
+			Resources []map[string]interface{} `json:"resources"`
+		}
+		if err = json.Unmarshal(contents, &page); err != nil {
+			return fmt.Errorf("could not parse %s: %s", path, err)
+		}
+
+		// apps-2.json is the second page of apps
+		if i := strings.LastIndex(name, "-"); i > 0 {
+			if _, err := strconv.Atoi(name[i+1:]); err == nil {
+				name = name[:i]
+			}
+		}
+		listPath := "/v2/" + name
+		if strings.HasPrefix(name, "v3_") {
+			listPath = "/v3/" + strings.TrimPrefix(name, "v3_")
+		}
+
+		cc.mutex.Lock()
+		cc.lists[listPath] = append(cc.lists[listPath], page.Resources...)
+		cc.mutex.Unlock()
+	}
+
+	return nil
+}
+
+// ShiftTimestamps moves the created_at, updated_at and package_updated_at of
+// every v2 resource so the latest update is at a given time, keeping recorded fixtures as old
+// relative to now as they were when they were recorded
+func (cc *FakeCloudController) ShiftTimestamps(latest time.Time) {
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+
+	var recordedLatest time.Time
+	cc.eachV2Timestamp(func(t time.Time) string {
+		if t.After(recordedLatest) {
+			recordedLatest = t
+		}
+		return t.Format(time.RFC3339)
+	})
+	if recordedLatest.IsZero() {
+		return
+	}
+
+	shift := latest.Sub(recordedLatest)
+	cc.eachV2Timestamp(func(t time.Time) string {
+		return t.Add(shift).UTC().Format(time.RFC3339)
+	})
+}
+
+func (cc *FakeCloudController) eachV2Timestamp(update func(time.Time) string) {
+	for _, resources := range cc.lists {
+		for _, resource := range resources {
+			metadata, _ := resource["metadata"].(map[string]interface{})
+			entity, _ := resource["entity"].(map[string]interface{})
+			for _, fields := range []map[string]interface{}{metadata, entity} {
+				for _, key := range []string{"created_at", "updated_at", "package_updated_at"} {
+					value, _ := fields[key].(string)
+					if t, err := time.Parse(time.RFC3339, value); err == nil {
+						fields[key] = update(t)
+					}
+				}
+			}
+		}
+	}
+}
+
+// injectedFailure is a status a path fails with, a number of times or, if
+// times is zero, until Recover
+type injectedFailure struct {
+	status int
+	times  int
+}
+
+// Fail makes every request for a path fail with a status, until Recover
+func (cc *FakeCloudController) Fail(path string, status int) {
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+
+	cc.failures[path] = &injectedFailure{status: status}
+}
+
+// FailTimes makes the next requests for a path fail with a status
+func (cc *FakeCloudController) FailTimes(path string, status, times int) {
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+
+	cc.failures[path] = &injectedFailure{status: status, times: times}
+}
+
+// SetRetryAfter sends a Retry-After header with the failures started by Fail
+// and FailTimes
+func (cc *FakeCloudController) SetRetryAfter(retryAfter string) {
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+
+	cc.retryAfter = retryAfter
+}
+
+// Recover stops the failures started by Fail and FailTimes
+func (cc *FakeCloudController) Recover() {
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+
+	cc.failures = map[string]*injectedFailure{}
+}
+
+// SetLatency delays every response
+func (cc *FakeCloudController) SetLatency(latency time.Duration) {
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+
+	cc.latency = latency
+}
+
+// Requests returns the path and query of every request made so far
+func (cc *FakeCloudController) Requests() []string {
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+
+	return append([]string{}, cc.requests...)
+}
+
+// MaxConcurrentRequests returns the most requests that were in flight at once
+func (cc *FakeCloudController) MaxConcurrentRequests() int {
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+
+	return cc.maxInFlight
+}
+
+func (cc *FakeCloudController) serve(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/v2/info" {
+		writeJSON(w, map[string]interface{}{
+			"authorization_endpoint": cc.fakeUAAServer.URL,
+			"token_endpoint":         cc.fakeUAAServer.URL,
+			"logging_endpoint":       cc.Server.URL,
+		})
+		return
+	}
+
+	cc.mutex.Lock()
+	cc.requests = append(cc.requests, r.URL.RequestURI())
+	latency := cc.latency
+	failure, failing := cc.failures[r.URL.Path]
+	var status int
+	if failing {
+		status = failure.status
+		if failure.times > 0 {
+			failure.times--
+			if failure.times == 0 {
+				delete(cc.failures, r.URL.Path)
+			}
+		}
+	}
+	retryAfter := cc.retryAfter
+	cc.inFlight++
+	if cc.inFlight > cc.maxInFlight {
+		cc.maxInFlight = cc.inFlight
+	}
+	cc.mutex.Unlock()
+
+	defer func() {
+		cc.mutex.Lock()
+		cc.inFlight--
+		cc.mutex.Unlock()
+	}()
+
+	time.Sleep(latency)
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "bearer ") && !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		writeCCError(w, http.StatusUnauthorized, 1000, "CF-InvalidAuthToken", "Invalid Auth Token")
+		return
+	}
+	if failing {
+		if retryAfter != "" {
+			w.Header().Set("Retry-After", retryAfter)
+		}
+		writeCCError(w, status, 10001, "CF-InjectedFailure", "injected failure")
+		return
+	}
+	if r.Method != "GET" {
+		writeCCError(w, http.StatusMethodNotAllowed, 10000, "CF-NotAuthorized", "the fake Cloud Controller is read only")
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) == 4 && parts[0] == "v2" && parts[1] == "apps" {
+		cc.serveApp(w, r, parts[2], parts[3])
+		return
+	}
+	if len(parts) == 3 && parts[0] == "v2" {
+		cc.serveV2Resource(w, "/v2/"+parts[1], parts[2])
+		return
+	}
+
+	cc.mutex.Lock()
+	resources := filterV2(cc.lists[r.URL.Path], r.URL.Query()["q"])
+	cc.mutex.Unlock()
+
+	if parts[0] == "v3" {
+		cc.serveV3Page(w, r, filterV3(resources, r.URL.Query()))
+	} else {
+		cc.serveV2Page(w, r, resources)
+	}
+}
+
+// serveV2Resource serves one resource of a v2 list, eg /v2/apps/<guid>
+func (cc *FakeCloudController) serveV2Resource(w http.ResponseWriter, listPath, guid string) {
+	cc.mutex.Lock()
+	resource := findV2(cc.lists[listPath], guid)
+	cc.mutex.Unlock()
+
+	if resource == nil {
+		if listPath == "/v2/apps" {
+			writeCCError(w, http.StatusNotFound, 100004, "CF-AppNotFound", "The app could not be found: "+guid)
+			return
+		}
+		writeCCError(w, http.StatusNotFound, 10000, "CF-NotFound", "Unknown request")
+		return
+	}
+	writeJSON(w, resource)
+}
+
+// RemoveV2 removes a resource from a v2 list, eg to delete an app
+func (cc *FakeCloudController) RemoveV2(path, guid string) {
+	cc.mutex.Lock()
+	defer cc.mutex.Unlock()
+
+	resources := []map[string]interface{}{}
+	for _, resource := range cc.lists[path] {
+		metadata, _ := resource["metadata"].(map[string]interface{})
+		if metadata["guid"] != guid {
+			resources = append(resources, resource)
+		}
+	}
+	cc.lists[path] = resources
+}
+
+// serveApp serves the instances, stats and routes of an app
+func (cc *FakeCloudController) serveApp(w http.ResponseWriter, r *http.Request, appGUID, relation string) {
+	cc.mutex.Lock()
+	app := findV2(cc.lists["/v2/apps"], appGUID)
+	instances, hasInstances := cc.appInstances[appGUID]
+	stats, hasStats := cc.appStats[appGUID]
+	routes := cc.appRoutes(appGUID)
+	cc.mutex.Unlock()
+
+	if app == nil {
+		writeCCError(w, http.StatusNotFound, 100004, "CF-AppNotFound", "The app could not be found: "+appGUID)
+		return
+	}
+	entity, _ := app["entity"].(map[string]interface{})
+	if relation != "routes" && entity["state"] != "STARTED" {
+		writeCCError(w, http.StatusBadRequest, 220001, "CF-InstancesError", "Instances error: App is stopped")
+		return
+	}
+
+	switch relation {
+	case "instances":
+		if !hasInstances {
+			instances = runningInstances(entity, func(int) interface{} {
+				return map[string]interface{}{"state": "RUNNING", "since": float64(time.Now().Unix())}
+			})
+		}
+		writeJSON(w, instances)
+	case "stats":
+		if !hasStats {
+			stats = runningInstances(entity, func(int) interface{} {
+				return map[string]interface{}{"state": "RUNNING"}
+			})
+		}
+		writeJSON(w, stats)
+	case "routes":
+		cc.serveV2Page(w, r, routes)
+	default:
+		writeCCError(w, http.StatusNotFound, 10000, "CF-NotFound", "Unknown request")
+	}
+}
+
+// appRoutes returns the routes mapped to an app. The caller holds the mutex.
+func (cc *FakeCloudController) appRoutes(appGUID string) []map[string]interface{} {
+	routes := []map[string]interface{}{}
+	for _, mapping := range cc.lists["/v2/route_mappings"] {
+		entity, _ := mapping["entity"].(map[string]interface{})
+		if entity["app_guid"] != appGUID {
+			continue
+		}
+		routeGUID, _ := entity["route_guid"].(string)
+		if route := findV2(cc.lists["/v2/routes"], routeGUID); route != nil {
+			routes = append(routes, route)
+		}
+	}
+	return routes
+}
+
+func runningInstances(entity map[string]interface{}, instance func(int) interface{}) map[string]interface{} {
+	// entities are decoded from fixtures as float64 but may be added as int
+	count, _ := strconv.Atoi(fmt.Sprint(entity["instances"]))
+	if count == 0 {
+		count = 1
+	}
+
+	instances := map[string]interface{}{}
+	for i := 0; i < count; i++ {
+		instances[strconv.Itoa(i)] = instance(i)
+	}
+	return instances
+}
+
+func (cc *FakeCloudController) pageOf(r *http.Request, perPageParam string, resources []map[string]interface{}) (int, int, int, []map[string]interface{}) {
+	perPage, _ := strconv.Atoi(r.URL.Query().Get(perPageParam))
+	if perPage <= 0 || perPage > cc.PageSize {
+		perPage = cc.PageSize
+	}
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page <= 0 {
+		page = 1
+	}
+
+	totalPages := (len(resources) + perPage - 1) / perPage
+	if totalPages == 0 {
+		totalPages = 1
+	}
+
+	start := (page - 1) * perPage
+	if start > len(resources) {
+		start = len(resources)
+	}
+	end := start + perPage
+	if end > len(resources) {
+		end = len(resources)
+	}
+	return page, perPage, totalPages, resources[start:end]
+}
+
+func (cc *FakeCloudController) serveV2Page(w http.ResponseWriter, r *http.Request, resources []map[string]interface{}) {
+	page, perPage, totalPages, pageResources := cc.pageOf(r, "results-per-page", resources)
+
+	pageURL := func(n int) interface{} {
+		if n < 1 || n > totalPages {
+			return nil
+		}
+		query := r.URL.Query()
+		query.Set("page", strconv.Itoa(n))
+		query.Set("results-per-page", strconv.Itoa(perPage))
+		return r.URL.Path + "?" + query.Encode()
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"total_results": len(resources),
+		"total_pages":   totalPages,
+		"prev_url":      pageURL(page - 1),
+		"next_url":      pageURL(page + 1),
+		"resources":     pageResources,
+	})
+}
+
+func (cc *FakeCloudController) serveV3Page(w http.ResponseWriter, r *http.Request, resources []map[string]interface{}) {
+	page, perPage, totalPages, pageResources := cc.pageOf(r, "per_page", resources)
+
+	link := func(n int) interface{} {
+		if n < 1 || n > totalPages {
+			return nil
+		}
+		query := r.URL.Query()
+		query.Set("page", strconv.Itoa(n))
+		query.Set("per_page", strconv.Itoa(perPage))
+		return map[string]string{"href": cc.Server.URL + r.URL.Path + "?" + query.Encode()}
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"pagination": map[string]interface{}{
+			"total_results": len(resources),
+			"total_pages":   totalPages,
+			"first":         link(1),
+			"last":          link(totalPages),
+			"next":          link(page + 1),
+			"previous":      link(page - 1),
+		},
+		"resources": pageResources,
+	})
+}
+
+// filterV2 keeps the v2 resources matching every q filter, eg name:possum,
+// timestamp>2017-08-15T15:00:06Z or type IN audit.app.create,audit.app.update.
+// Values are compared as strings, which orders RFC 3339 timestamps correctly.
+func filterV2(resources []map[string]interface{}, filters []string) []map[string]interface{} {
+	if len(filters) == 0 {
+		return resources
+	}
+
+	filtered := []map[string]interface{}{}
+	for _, resource := range resources {
+		entity, _ := resource["entity"].(map[string]interface{})
+		matches := true
+		for _, filter := range filters {
+			if !matchesV2Filter(entity, filter) {
+				matches = false
+			}
+		}
+		if matches {
+			filtered = append(filtered, resource)
+		}
+	}
+	return filtered
+}
+
+func matchesV2Filter(entity map[string]interface{}, filter string) bool {
+	if parts := strings.SplitN(filter, " IN ", 2); len(parts) == 2 {
+		value := fmt.Sprint(entity[parts[0]])
+		for _, candidate := range strings.Split(parts[1], ",") {
+			if value == candidate {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, operator := range []string{">=", "<=", ">", "<", ":"} {
+		parts := strings.SplitN(filter, operator, 2)
+		if len(parts) != 2 {
+			continue
+		}
+		value := fmt.Sprint(entity[parts[0]])
+		switch operator {
+		case ">=":
+			return value >= parts[1]
+		case "<=":
+			return value <= parts[1]
+		case ">":
+			return value > parts[1]
+		case "<":
+			return value < parts[1]
+		default:
+			return value == parts[1]
+		}
+	}
+	return false
+}
+
+// v3Operators maps the relational operators of v3 filters, eg
+// updated_ats[gte]=2017-08-15T15:00:06Z, to the v2 operators matching them
+var v3Operators = map[string]string{"gt": ">", "gte": ">=", "lt": "<", "lte": "<="}
+
+// filterV3 keeps the v3 resources matching every timestamp filter of a query,
+// eg updated_ats[gte]=2017-08-15T15:00:06Z. Other parameters are ignored.
+func filterV3(resources []map[string]interface{}, query url.Values) []map[string]interface{} {
+	filters := []string{}
+	for key, values := range query {
+		bracket := strings.Index(key, "[")
+		if bracket < 0 || !strings.HasSuffix(key, "]") {
+			continue
+		}
+		operator, ok := v3Operators[key[bracket+1:len(key)-1]]
+		if !ok {
+			continue
+		}
+		for _, value := range values {
+			filters = append(filters, strings.TrimSuffix(key[:bracket], "s")+operator+value)
+		}
+	}
+	if len(filters) == 0 {
+		return resources
+	}
+
+	filtered := []map[string]interface{}{}
+	for _, resource := range resources {
+		matches := true
+		for _, filter := range filters {
+			if !matchesV2Filter(resource, filter) {
+				matches = false
+			}
+		}
+		if matches {
+			filtered = append(filtered, resource)
+		}
+	}
+	return filtered
+}
+
+func findV2(resources []map[string]interface{}, guid string) map[string]interface{} {
+	for _, resource := range resources {
+		metadata, _ := resource["metadata"].(map[string]interface{})
+		if metadata["guid"] == guid {
+			return resource
+		}
+	}
+	return nil
+}
+
+func writeCCError(w http.ResponseWriter, status, code int, errorCode, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"code":        code,
+		"description": description,
+		"error_code":  errorCode,
+	})
+}
+
+// FixtureFoundations returns the foundations of a fixtures directory, one
+// subdirectory each, in name order
+func FixtureFoundations(dir string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	foundations := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			foundations = append(foundations, entry.Name())
+		}
+	}
+	sort.Strings(foundations)
+	if len(foundations) == 0 {
+		return nil, fmt.Errorf("%s has no foundation directories", dir)
+	}
+	return foundations, nil
+}
@@ -0,0 +1,81 @@
+package helpers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+)
+
+const fakeAccessToken = "fake-access-token"
+
+// FakeOIDCProvider is an OpenID Connect issuer that logs every visitor in as
+// the same user. It also serves /v2/info so it can stand in for the UAA of a
+// Cloud Foundry API.
+type FakeOIDCProvider struct {
+	Server *httptest.Server
+	// Claims are returned by the userinfo endpoint
+	Claims map[string]interface{}
+}
+
+func NewFakeOIDCProvider(claims map[string]interface{}) *FakeOIDCProvider {
+	provider := &FakeOIDCProvider{Claims: claims}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]string{
+			"issuer":                 provider.Server.URL,
+			"authorization_endpoint": provider.Server.URL + "/authorize",
+			"token_endpoint":         provider.Server.URL + "/token",
+			"userinfo_endpoint":      provider.Server.URL + "/userinfo",
+		})
+	})
+	mux.HandleFunc("/v2/info", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]string{
+			"authorization_endpoint": provider.Server.URL,
+			"token_endpoint":         provider.Server.URL,
+		})
+	})
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		redirectURL, err := url.Parse(r.URL.Query().Get("redirect_uri"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		query := redirectURL.Query()
+		query.Set("code", "fake-code")
+		query.Set("state", r.URL.Query().Get("state"))
+		redirectURL.RawQuery = query.Encode()
+		http.Redirect(w, r, redirectURL.String(), http.StatusFound)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != "fake-code" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, map[string]interface{}{
+			"access_token": fakeAccessToken,
+			"token_type":   "bearer",
+			"expires_in":   3600,
+		})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+fakeAccessToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		writeJSON(w, provider.Claims)
+	})
+
+	provider.Server = httptest.NewServer(mux)
+	return provider
+}
+
+func (provider *FakeOIDCProvider) Close() {
+	provider.Server.Close()
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
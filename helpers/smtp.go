@@ -0,0 +1,112 @@
+package helpers
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"sync"
+)
+
+// SMTPMessage is a message received by the fake SMTP server
+type SMTPMessage struct {
+	From string
+	To   []string
+	Data string
+}
+
+// FakeSMTPServer accepts messages over SMTP and keeps them in memory
+type FakeSMTPServer struct {
+	Addr     string
+	listener net.Listener
+	mutex    sync.Mutex
+	messages []SMTPMessage
+}
+
+func NewFakeSMTPServer() (*FakeSMTPServer, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	server := &FakeSMTPServer{
+		Addr:     listener.Addr().String(),
+		listener: listener,
+	}
+	go server.serve()
+
+	return server, nil
+}
+
+func (server *FakeSMTPServer) Close() {
+	server.listener.Close()
+}
+
+func (server *FakeSMTPServer) Messages() []SMTPMessage {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	return append([]SMTPMessage{}, server.messages...)
+}
+
+func (server *FakeSMTPServer) serve() {
+	for {
+		conn, err := server.listener.Accept()
+		if err != nil {
+			return
+		}
+		go server.handle(conn)
+	}
+}
+
+func (server *FakeSMTPServer) handle(conn net.Conn) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	reply := func(line string) {
+		conn.Write([]byte(line + "\r\n"))
+	}
+
+	reply("220 localhost fake SMTP")
+	message := SMTPMessage{}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		command := strings.ToUpper(line)
+
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			message = SMTPMessage{From: strings.Trim(line[len("MAIL FROM:"):], "<> ")}
+			reply("250 OK")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			message.To = append(message.To, strings.Trim(line[len("RCPT TO:"):], "<> "))
+			reply("250 OK")
+		case command == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				dataLine, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(dataLine, "."))
+			}
+			message.Data = data.String()
+			server.mutex.Lock()
+			server.messages = append(server.messages, message)
+			server.mutex.Unlock()
+			reply("250 OK")
+		case command == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
@@ -2,14 +2,19 @@ package integration_test
 
 import (
 	"fmt"
+	"net"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/onsi/gomega/gbytes"
 	"github.com/onsi/gomega/gexec"
 
+	"github.com/FidelityInternational/cf-loupe/helpers"
+
 	"testing"
 )
 
@@ -18,33 +23,54 @@ func TestIntegration(t *testing.T) {
 	RunSpecs(t, "Integration Suite")
 }
 
-var session *gexec.Session
+var pathToCFLoupe string
 
 var _ = BeforeSuite(func() {
-	checkVar("CF_FOUNDATION_1")
-	checkVar("CF_API_1")
-	checkVar("CF_USERNAME_1")
-	checkVar("CF_PASSWORD_1")
-	pathToCFLoupe, err := gexec.Build("github.com/FidelityInternational/cf-loupe")
-	Expect(err).To(Succeed())
-
-	cmd := exec.Command(pathToCFLoupe)
-	cmd.Dir = "../"
-	session, err = gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
+	var err error
+	pathToCFLoupe, err = gexec.Build("github.com/FidelityInternational/cf-loupe")
 	Expect(err).To(Succeed())
-
-	Eventually(session, 10).Should(gbytes.Say("Starting app on port"))
 })
 
 var _ = AfterSuite(func() {
-	if session != nil {
-		session.Kill()
-	}
+	gexec.CleanupBuildArtifacts()
 })
 
-func checkVar(varName string) {
-	defer GinkgoRecover()
-	if os.Getenv(varName) == "" {
-		Fail(fmt.Sprintf("%s is required but was not set", varName))
+// startFoundation starts a fake Cloud Controller replaying fixtures/<name>,
+// as old relative to now as when the fixtures were written
+func startFoundation(name string) *helpers.FakeCloudController {
+	cc := helpers.NewFakeCloudController()
+	Expect(cc.LoadFixtures(filepath.Join("fixtures", name))).To(Succeed())
+	cc.ShiftTimestamps(time.Now())
+	return cc
+}
+
+// startLoupe runs cf-loupe against fake foundations, returning the session
+// and the URL it listens on
+func startLoupe(foundations map[string]*helpers.FakeCloudController, env ...string) (*gexec.Session, string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).To(Succeed())
+	_, port, err := net.SplitHostPort(listener.Addr().String())
+	Expect(err).To(Succeed())
+	listener.Close()
+
+	cmd := exec.Command(pathToCFLoupe)
+	cmd.Dir = "../"
+	cmd.Env = append(os.Environ(), "PORT="+port)
+	i := 1
+	for name, cc := range foundations {
+		cmd.Env = append(cmd.Env,
+			fmt.Sprintf("CF_FOUNDATION_%d=%s", i, name),
+			fmt.Sprintf("CF_API_%d=%s", i, cc.Server.URL),
+			fmt.Sprintf("CF_USERNAME_%d=admin", i),
+			fmt.Sprintf("CF_PASSWORD_%d=admin", i),
+		)
+		i++
 	}
+	cmd.Env = append(cmd.Env, env...)
+
+	session, err := gexec.Start(cmd, GinkgoWriter, GinkgoWriter)
+	Expect(err).To(Succeed())
+	Eventually(session, 10).Should(gbytes.Say("Starting app on port"))
+
+	return session, "http://127.0.0.1:" + port
 }
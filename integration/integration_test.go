@@ -1,31 +1,159 @@
 package integration_test
 
 import (
+	"encoding/json"
 	"io/ioutil"
 	"net/http"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+
+	"github.com/FidelityInternational/cf-loupe/applist"
+	"github.com/FidelityInternational/cf-loupe/helpers"
 )
 
+func get(url string) (int, string) {
+	resp, err := http.Get(url)
+	Expect(err).To(Succeed())
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	Expect(err).To(Succeed())
+	return resp.StatusCode, string(body)
+}
+
+func getAppData(loupeURL, query string) applist.AppData {
+	status, body := get(loupeURL + "/listapps" + query)
+	Expect(status).To(Equal(http.StatusOK), body)
+
+	var appData applist.AppData
+	Expect(json.Unmarshal([]byte(body), &appData)).To(Succeed())
+	return appData
+}
+
+func appsByName(apps []applist.App) map[string]applist.App {
+	byName := map[string]applist.App{}
+	for _, app := range apps {
+		byName[app.Name] = app
+	}
+	return byName
+}
+
 var _ = Describe("Integration", func() {
-	Describe("GET /", func() {
-		It("returns 200 OK", func() {
-			resp, err := http.Get("http://localhost:8080")
-			Expect(err).To(Succeed())
-			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+	var alpha, beta *helpers.FakeCloudController
+	var session *gexec.Session
+	var loupeURL string
+
+	BeforeEach(func() {
+		alpha = startFoundation("alpha")
+		beta = startFoundation("beta")
+	})
+
+	AfterEach(func() {
+		if session != nil {
+			session.Kill().Wait()
+		}
+		alpha.Close()
+		beta.Close()
+	})
+
+	Context("When every foundation is up", func() {
+		BeforeEach(func() {
+			session, loupeURL = startLoupe(map[string]*helpers.FakeCloudController{
+				"alpha": alpha,
+				"beta":  beta,
+			}, "LOUPE_INSTANCE_HEALTH=true")
 		})
 
-		PIt("shows a list of apps", func() {
-			resp, err := http.Get("http://localhost:8080")
-			Expect(err).To(Succeed())
+		Describe("GET /", func() {
+			It("renders the dashboard", func() {
+				status, body := get(loupeURL)
+				Expect(status).To(Equal(http.StatusOK))
+				Expect(body).To(ContainSubstring("CF Loupe"))
+				Expect(body).To(ContainSubstring("/listapps"))
+			})
+		})
+
+		Describe("GET /listapps", func() {
+			It("shows a list of apps", func() {
+				_, body := get(loupeURL + "/listapps")
+				Expect(body).To(ContainSubstring("possum"))
+			})
+
+			It("merges the apps of every foundation", func() {
+				apps := appsByName(getAppData(loupeURL, "").Apps)
+				Expect(apps).To(HaveLen(5))
+
+				Expect(apps["possum"].Foundation).To(Equal("alpha"))
+				Expect(apps["possum"].Org).To(Equal("project-x"))
+				Expect(apps["possum"].Space).To(Equal("dev"))
+				Expect(apps["numbat"].Foundation).To(Equal("beta"))
+				Expect(apps["numbat"].Instances).To(Equal(2))
+			})
+
+			It("checks every app", func() {
+				apps := appsByName(getAppData(loupeURL, "").Apps)
+
+				Expect(apps["possum"].IsHappy()).To(BeTrue())
+				Expect(apps["wombat"].IsStale).To(BeTrue())
+				Expect(apps["quokka"].Buildpack.Name).To(Equal("ruby"))
+				Expect(apps["quokka"].Buildpack.Version).To(Equal("1.7.40"))
+				Expect(apps["quokka"].Buildpack.IsDeprecated).To(BeTrue())
+				Expect(apps["bilby"].Status).To(Equal(applist.StatusCrashed))
+			})
+
+			It("summarises every foundation", func() {
+				summary := getAppData(loupeURL, "").Summary
+				Expect(summary.TotalApps).To(Equal(5))
+				Expect(summary.StaleApps).To(Equal(1))
+				Expect(summary.DeprecatedApps).To(Equal(1))
+				Expect(summary.CrashedApps).To(Equal(1))
+			})
+
+			It("filters by status", func() {
+				appData := getAppData(loupeURL, "?status=crashed")
+				Expect(appData.Apps).To(HaveLen(1))
+				Expect(appData.Apps[0].Name).To(Equal("bilby"))
+				Expect(appData.Summary.TotalApps).To(Equal(1))
+			})
+		})
+	})
+
+	Context("When a foundation cannot be scraped", func() {
+		BeforeEach(func() {
+			beta.Fail("/v2/apps", http.StatusServiceUnavailable)
+			session, loupeURL = startLoupe(map[string]*helpers.FakeCloudController{
+				"alpha": alpha,
+				"beta":  beta,
+			})
+		})
+
+		It("says which foundation failed", func() {
+			status, body := get(loupeURL + "/listapps")
+			Expect(status).To(Equal(http.StatusInternalServerError))
+			Expect(body).To(ContainSubstring("could not scrape beta"))
+		})
+
+		It("is alive but not ready, without serving the error", func() {
+			get(loupeURL + "/listapps")
+
+			status, _ := get(loupeURL + "/healthz")
+			Expect(status).To(Equal(http.StatusOK))
+
+			status, body := get(loupeURL + "/readyz")
+			Expect(status).To(Equal(http.StatusServiceUnavailable))
+			Expect(body).To(ContainSubstring(`{"Foundation":"alpha","Scraped":true,"Authenticated":true}`))
+			Expect(body).To(ContainSubstring(`{"Foundation":"beta","Scraped":true,"Authenticated":true}`))
+			Expect(body).NotTo(ContainSubstring("CF-InjectedFailure"))
+		})
 
-			bytes, err := ioutil.ReadAll(resp.Body)
-			Expect(err).To(Succeed())
-			defer resp.Body.Close()
+		It("shows every foundation once it is back", func() {
+			status, _ := get(loupeURL + "/listapps")
+			Expect(status).To(Equal(http.StatusInternalServerError))
 
-			str := string(bytes)
-			Expect(str).To(ContainSubstring("possum"))
+			beta.Recover()
+			Expect(getAppData(loupeURL, "").Apps).To(HaveLen(5))
 		})
 	})
 })
@@ -1,22 +1,173 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
 	"time"
 
+	"github.com/FidelityInternational/cf-loupe/auth"
 	"github.com/FidelityInternational/cf-loupe/cf"
+	"github.com/FidelityInternational/cf-loupe/helpers"
 )
 
+const usage = `Usage: cf-loupe [command] [flags]
+
+Commands:
+  serve           run the dashboard (default)
+  report          scrape the foundations once and print the apps, see cf-loupe report -h
+  dump            save the Cloud Controller responses of the foundations, see cf-loupe dump -h
+  demo            run the dashboard against fake foundations, see cf-loupe demo -h
+  generate-token  print a new API token and its hash
+`
+
 func main() {
+	command, args := "serve", os.Args[1:]
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+
+	switch command {
+	case "serve":
+		cfClients, err := cf.BuildClientsFromEnvironment(os.Environ())
+		if err != nil {
+			log.Fatal(err)
+		}
+		serve(cfClients)
+	case "report":
+		os.Exit(report(args))
+	case "demo":
+		os.Exit(demo(args))
+	case "dump":
+		os.Exit(dump(args))
+	case "generate-token":
+		token, hash := auth.GenerateToken()
+		fmt.Printf("token:  %s\nsha256: %s\n", token, hash)
+	case "help", "-h", "-help", "--help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", command, usage)
+		os.Exit(ReportError)
+	}
+}
+
+func report(args []string) int {
+	cfClients, err := cf.BuildClientsFromEnvironment(os.Environ())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return ReportError
+	}
+
+	config, err := BuildConfigFromEnvironment(os.Environ())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return ReportError
+	}
+
+	return Report(args, cfClients, time.Now(), config, os.Stdout, os.Stderr)
+}
+
+// dump saves the responses of each foundation to <dir>/<foundation>, to be
+// read back with CF_OFFLINE_DIR_<n>
+func dump(args []string) int {
+	flags := flag.NewFlagSet("dump", flag.ContinueOnError)
+	dir := flags.String("dir", "", "directory to save the responses to, one subdirectory per foundation")
+	foundationName := flags.String("foundation", "", "only save this foundation")
+	if err := flags.Parse(args); err != nil {
+		return ReportError
+	}
+	if *dir == "" {
+		fmt.Fprintln(os.Stderr, "-dir is required")
+		return ReportError
+	}
+
 	cfClients, err := cf.BuildClientsFromEnvironment(os.Environ())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return ReportError
+	}
+
+	dumped := 0
+	for foundation, cfClient := range cfClients {
+		if *foundationName != "" && foundation != *foundationName {
+			continue
+		}
+		client, ok := cfClient.(*cf.Client)
+		if !ok {
+			continue // already offline
+		}
+
+		if err = client.Dump(filepath.Join(*dir, foundation)); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", foundation, err)
+			return ReportError
+		}
+		fmt.Printf("saved %s to %s\n", foundation, filepath.Join(*dir, foundation))
+		dumped++
+	}
+
+	if dumped == 0 {
+		fmt.Fprintln(os.Stderr, "no foundations to save")
+		return ReportError
+	}
+	return ReportOK
+}
+
+// demo runs the dashboard against a fake Cloud Controller for each foundation
+// of a fixtures directory, as saved by dump
+func demo(args []string) int {
+	flags := flag.NewFlagSet("demo", flag.ContinueOnError)
+	fixtures := flags.String("fixtures", "demo", "directory of saved foundations, one subdirectory per foundation")
+	latency := flags.Duration("latency", 0, "delay every Cloud Controller response, eg 200ms")
+	if err := flags.Parse(args); err != nil {
+		return ReportError
+	}
+
+	foundations, err := helpers.FixtureFoundations(*fixtures)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return ReportError
+	}
+
+	env := []string{}
+	for i, foundation := range foundations {
+		cc := helpers.NewFakeCloudController()
+		defer cc.Close()
+		if err = cc.LoadFixtures(filepath.Join(*fixtures, foundation)); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return ReportError
+		}
+		// the fixtures stay as old, relative to now, as they were when saved
+		cc.ShiftTimestamps(time.Now())
+		cc.SetLatency(*latency)
+
+		env = append(env,
+			fmt.Sprintf("CF_FOUNDATION_%d=%s", i+1, foundation),
+			fmt.Sprintf("CF_API_%d=%s", i+1, cc.Server.URL),
+			fmt.Sprintf("CF_USERNAME_%d=demo", i+1),
+			fmt.Sprintf("CF_PASSWORD_%d=demo", i+1),
+		)
+	}
+
+	cfClients, err := cf.BuildClientsFromEnvironment(env)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return ReportError
+	}
+
+	serve(cfClients)
+	return ReportOK
+}
+
+func serve(cfClients map[string]cf.IClient) {
+	config, err := BuildConfigFromEnvironment(os.Environ())
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	router := BuildRouter(cfClients, time.Now)
+	router := BuildRouter(cfClients, time.Now, config)
 	router.ServeFiles("/assets/*filepath", http.Dir("assets"))
 
 	port := os.Getenv("PORT")
@@ -24,8 +175,15 @@ func main() {
 		port = "8080"
 	}
 
+	var handler http.Handler = router
+	if config.Auth.Enabled() {
+		config.Auth.ReadOnlyPaths = readOnlyPOSTPaths
+		config.Auth.PublicPaths = healthPaths
+		handler = auth.NewAuthenticator(config.Auth, time.Now).Wrap(router)
+	}
+
 	webServer := &http.Server{
-		Handler:      router,
+		Handler:      handler,
 		Addr:         ":" + port,
 		WriteTimeout: 15 * time.Second,
 		ReadTimeout:  15 * time.Second,
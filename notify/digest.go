@@ -0,0 +1,109 @@
+package notify
+
+import (
+	"log"
+	"net/mail"
+	"sort"
+	"strings"
+
+	"github.com/FidelityInternational/cf-loupe/applist"
+)
+
+// Recipients decides who receives the digest for an app. Addresses are looked
+// up by the app's owner, then by "org/space", then by org.
+type Recipients struct {
+	Addresses map[string]string
+	// Default receives the apps that have no other recipient. Those apps are
+	// left out of every digest if it is empty.
+	Default string
+}
+
+// Digest contains the apps needing attention that belong to a recipient
+type Digest struct {
+	Recipient      string
+	StaleApps      []applist.App
+	DeprecatedApps []applist.App
+}
+
+// recipient returns the address to send an app's violations to, or an empty
+// string if there is none. An owner that is not a valid address goes to the
+// default recipient, as it could otherwise add headers to the email.
+func (recipients Recipients) recipient(app applist.App) string {
+	if strings.Contains(app.Owner, "@") {
+		address, err := mail.ParseAddress(app.Owner)
+		if err != nil {
+			log.Printf("the owner of %s/%s/%s is not a valid address: %s\n", app.Org, app.Space, app.Name, err)
+			return recipients.Default
+		}
+		return address.Address
+	}
+
+	keys := []string{app.Org + "/" + app.Space, app.Org}
+	if app.Owner != "" {
+		keys = append([]string{app.Owner}, keys...)
+	}
+	for _, key := range keys {
+		if address, ok := recipients.Addresses[key]; ok {
+			return address
+		}
+	}
+
+	return recipients.Default
+}
+
+// BuildDigests groups the stale apps and the apps on deprecated buildpacks by
+// recipient. Recipients without any such apps do not get a digest.
+func BuildDigests(apps []applist.App, recipients Recipients) []Digest {
+	digestsByRecipient := map[string]*Digest{}
+
+	for _, app := range apps {
+		if app.IsHappy() {
+			continue
+		}
+
+		address := recipients.recipient(app)
+		if address == "" {
+			continue
+		}
+
+		digest, ok := digestsByRecipient[address]
+		if !ok {
+			digest = &Digest{Recipient: address}
+			digestsByRecipient[address] = digest
+		}
+		if app.IsStale {
+			digest.StaleApps = append(digest.StaleApps, app)
+		}
+		if app.Buildpack.IsDeprecated {
+			digest.DeprecatedApps = append(digest.DeprecatedApps, app)
+		}
+	}
+
+	digests := []Digest{}
+	for _, digest := range digestsByRecipient {
+		sortApps(digest.StaleApps)
+		sortApps(digest.DeprecatedApps)
+		digests = append(digests, *digest)
+	}
+	sort.Slice(digests, func(i, j int) bool {
+		return digests[i].Recipient < digests[j].Recipient
+	})
+
+	return digests
+}
+
+func sortApps(apps []applist.App) {
+	sort.Slice(apps, func(i, j int) bool {
+		a, b := apps[i], apps[j]
+		if a.Foundation != b.Foundation {
+			return a.Foundation < b.Foundation
+		}
+		if a.Org != b.Org {
+			return a.Org < b.Org
+		}
+		if a.Space != b.Space {
+			return a.Space < b.Space
+		}
+		return a.Name < b.Name
+	})
+}
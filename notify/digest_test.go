@@ -0,0 +1,67 @@
+package notify_test
+
+import (
+	"github.com/FidelityInternational/cf-loupe/applist"
+	. "github.com/FidelityInternational/cf-loupe/notify"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("BuildDigests", func() {
+	var apps []applist.App
+	var recipients Recipients
+
+	BeforeEach(func() {
+		apps = []applist.App{
+			{Name: "happy", Org: "project-x", Space: "dev"},
+			{Name: "stale", Org: "project-x", Space: "dev", IsStale: true},
+			{Name: "deprecated", Org: "project-x", Space: "test", Buildpack: applist.Buildpack{IsDeprecated: true}},
+			{Name: "owned", Org: "project-x", Space: "dev", IsStale: true, Owner: "payments"},
+			{Name: "emailed", Org: "project-y", Space: "dev", IsStale: true, Owner: "orders@example.com"},
+			{Name: "orphan", Org: "project-z", Space: "dev", IsStale: true},
+		}
+		recipients = Recipients{
+			Addresses: map[string]string{
+				"payments":      "payments@example.com",
+				"project-x/dev": "dev@example.com",
+				"project-x":     "project-x@example.com",
+			},
+		}
+	})
+
+	It("groups apps needing attention by owner, then space, then org", func() {
+		digests := BuildDigests(apps, recipients)
+
+		Expect(digests).To(HaveLen(4))
+		Expect(digests[0].Recipient).To(Equal("dev@example.com"))
+		Expect(digests[0].StaleApps).To(HaveLen(1))
+		Expect(digests[0].StaleApps[0].Name).To(Equal("stale"))
+		Expect(digests[1].Recipient).To(Equal("orders@example.com"))
+		Expect(digests[2].Recipient).To(Equal("payments@example.com"))
+		Expect(digests[2].StaleApps[0].Name).To(Equal("owned"))
+		Expect(digests[3].Recipient).To(Equal("project-x@example.com"))
+		Expect(digests[3].StaleApps).To(BeEmpty())
+		Expect(digests[3].DeprecatedApps[0].Name).To(Equal("deprecated"))
+	})
+
+	It("sends apps without a recipient to the default recipient", func() {
+		recipients.Default = "platform@example.com"
+		digests := BuildDigests(apps, recipients)
+
+		Expect(digests).To(HaveLen(5))
+		Expect(digests[3].Recipient).To(Equal("platform@example.com"))
+		Expect(digests[3].StaleApps[0].Name).To(Equal("orphan"))
+	})
+
+	It("sends apps whose owner is not a valid address to the default recipient", func() {
+		recipients.Default = "platform@example.com"
+		apps = []applist.App{
+			{Name: "injected", Org: "project-y", Space: "dev", IsStale: true, Owner: "orders@example.com\r\nBcc: all@example.com"},
+		}
+		digests := BuildDigests(apps, recipients)
+
+		Expect(digests).To(HaveLen(1))
+		Expect(digests[0].Recipient).To(Equal("platform@example.com"))
+	})
+})
@@ -0,0 +1,130 @@
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"mime/multipart"
+	"net/textproto"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+const subject = "CF Loupe: apps needing attention"
+
+const textBody = `Hello,
+
+The following apps on Cloud Foundry need your attention.
+{{if .StaleApps}}
+Apps that have not been updated for two weeks or more:
+{{range .StaleApps}}
+  - {{.Name}} ({{.Foundation}} / {{.Org}} / {{.Space}}), last updated {{.UpdatedAt}}
+{{- end}}
+{{end}}{{if .DeprecatedApps}}
+Apps using a deprecated buildpack:
+{{range .DeprecatedApps}}
+  - {{.Name}} ({{.Foundation}} / {{.Org}} / {{.Space}}), {{.Buildpack.Name}} {{.Buildpack.Version}}
+{{- end}}
+{{end}}
+Please restage or update these apps.
+`
+
+const htmlBody = `<html>
+<body>
+<p>Hello,</p>
+<p>The following apps on Cloud Foundry need your attention.</p>
+{{if .StaleApps}}
+<h3>Apps that have not been updated for two weeks or more</h3>
+<table>
+<tr><th>App</th><th>Foundation</th><th>Org</th><th>Space</th><th>Last Updated</th></tr>
+{{range .StaleApps}}<tr><td>{{.Name}}</td><td>{{.Foundation}}</td><td>{{.Org}}</td><td>{{.Space}}</td><td>{{.UpdatedAt}}</td></tr>
+{{end}}</table>
+{{end}}{{if .DeprecatedApps}}
+<h3>Apps using a deprecated buildpack</h3>
+<table>
+<tr><th>App</th><th>Foundation</th><th>Org</th><th>Space</th><th>Buildpack</th></tr>
+{{range .DeprecatedApps}}<tr><td>{{.Name}}</td><td>{{.Foundation}}</td><td>{{.Org}}</td><td>{{.Space}}</td><td>{{.Buildpack.Name}} {{.Buildpack.Version}}</td></tr>
+{{end}}</table>
+{{end}}
+<p>Please restage or update these apps.</p>
+</body>
+</html>
+`
+
+var textTemplate = texttemplate.Must(texttemplate.New("text").Parse(textBody))
+var htmlTemplate = htmltemplate.Must(htmltemplate.New("html").Parse(htmlBody))
+
+// Email is a rendered digest
+type Email struct {
+	From    string
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// RenderDigest renders a digest as a plain text and HTML email
+func RenderDigest(digest Digest, from string) (Email, error) {
+	var text, html bytes.Buffer
+	if err := textTemplate.Execute(&text, digest); err != nil {
+		return Email{}, err
+	}
+	if err := htmlTemplate.Execute(&html, digest); err != nil {
+		return Email{}, err
+	}
+
+	return Email{
+		From:    from,
+		To:      digest.Recipient,
+		Subject: subject,
+		Text:    text.String(),
+		HTML:    html.String(),
+	}, nil
+}
+
+// Message returns the email as a multipart MIME message
+func (email Email) Message(now time.Time) ([]byte, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	for _, part := range []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=utf-8", email.Text},
+		{"text/html; charset=utf-8", email.HTML},
+	} {
+		partWriter, err := writer.CreatePart(textproto.MIMEHeader{"Content-Type": {part.contentType}})
+		if err != nil {
+			return nil, err
+		}
+		if _, err = partWriter.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	for _, header := range []string{email.From, email.To, email.Subject} {
+		if strings.ContainsAny(header, "\r\n") {
+			return nil, fmt.Errorf("header %q contains a line break", header)
+		}
+	}
+
+	var message bytes.Buffer
+	headers := []string{
+		"From: " + email.From,
+		"To: " + email.To,
+		"Subject: " + email.Subject,
+		"Date: " + now.Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		fmt.Sprintf("Content-Type: multipart/alternative; boundary=%q", writer.Boundary()),
+	}
+	message.WriteString(strings.Join(headers, "\r\n"))
+	message.WriteString("\r\n\r\n")
+	message.Write(body.Bytes())
+
+	return message.Bytes(), nil
+}
@@ -0,0 +1,99 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/FidelityInternational/cf-loupe/applist"
+)
+
+// Options configures the digest emails
+type Options struct {
+	// Interval between digests. No digests are sent if it is zero.
+	Interval   time.Duration
+	From       string
+	Recipients Recipients
+	SMTP       SMTPSender
+	// DryRunDir is a directory to write the emails to instead of sending them
+	DryRunDir string
+}
+
+// Enabled returns true if digests should be sent
+func (options Options) Enabled() bool {
+	return options.Interval > 0
+}
+
+// Notifier sends a digest to every recipient with apps needing attention
+type Notifier struct {
+	Sender     Sender
+	From       string
+	Recipients Recipients
+	TimeNow    func() time.Time
+}
+
+// NewNotifier returns a notifier sending through SMTP, or writing to the dry
+// run directory if one is set
+func NewNotifier(options Options, timeNow func() time.Time) Notifier {
+	var sender Sender = options.SMTP
+	if options.DryRunDir != "" {
+		sender = DirSender{Dir: options.DryRunDir}
+	}
+
+	return Notifier{
+		Sender:     sender,
+		From:       options.From,
+		Recipients: options.Recipients,
+		TimeNow:    timeNow,
+	}
+}
+
+// Notify sends the digests for a list of apps. A failure to send one digest
+// does not stop the others from being sent.
+func (notifier Notifier) Notify(apps []applist.App) error {
+	failures := []string{}
+
+	for _, digest := range BuildDigests(apps, notifier.Recipients) {
+		email, err := RenderDigest(digest, notifier.From)
+		if err != nil {
+			return err
+		}
+		message, err := email.Message(notifier.TimeNow())
+		if err != nil {
+			return err
+		}
+		if err = notifier.Sender.Send(email.From, email.To, message); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %s", email.To, err))
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("could not send digests to %s", strings.Join(failures, ", "))
+	}
+	return nil
+}
+
+// Run sends digests every interval until ctx is done
+func (notifier Notifier) Run(ctx context.Context, interval time.Duration, fetchAppData func() (applist.AppData, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		appData, err := fetchAppData()
+		if err != nil {
+			log.Printf("could not fetch apps for the digest: %s\n", err)
+			continue
+		}
+		if err = notifier.Notify(appData.Apps); err != nil {
+			log.Println(err.Error())
+		}
+	}
+}
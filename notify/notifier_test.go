@@ -0,0 +1,99 @@
+package notify_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/FidelityInternational/cf-loupe/applist"
+	"github.com/FidelityInternational/cf-loupe/helpers"
+	. "github.com/FidelityInternational/cf-loupe/notify"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Notifier", func() {
+	var apps []applist.App
+	var options Options
+	var timeNow func() time.Time
+
+	BeforeEach(func() {
+		apps = []applist.App{
+			{Name: "stale-app", Foundation: "dev", Org: "project-x", Space: "dev", UpdatedAt: "2017-07-01", IsStale: true},
+			{Name: "old-app", Foundation: "dev", Org: "project-x", Space: "dev", Buildpack: applist.Buildpack{Name: "java_buildpack", Version: "v1.19", IsDeprecated: true}},
+		}
+		options = Options{
+			Interval: time.Hour,
+			From:     "loupe@example.com",
+			Recipients: Recipients{
+				Addresses: map[string]string{"project-x": "project-x@example.com"},
+			},
+		}
+		timeNow = func() time.Time {
+			t, _ := time.Parse(time.RFC3339, "2017-08-15T15:00:06Z")
+			return t
+		}
+	})
+
+	Context("When sending through SMTP", func() {
+		var smtpServer *helpers.FakeSMTPServer
+
+		BeforeEach(func() {
+			var err error
+			smtpServer, err = helpers.NewFakeSMTPServer()
+			Expect(err).To(Succeed())
+			options.SMTP = SMTPSender{Addr: smtpServer.Addr}
+		})
+
+		AfterEach(func() {
+			smtpServer.Close()
+		})
+
+		It("sends a text and HTML digest to each recipient", func() {
+			err := NewNotifier(options, timeNow).Notify(apps)
+			Expect(err).To(Succeed())
+
+			messages := smtpServer.Messages()
+			Expect(messages).To(HaveLen(1))
+			Expect(messages[0].From).To(Equal("loupe@example.com"))
+			Expect(messages[0].To).To(Equal([]string{"project-x@example.com"}))
+			Expect(messages[0].Data).To(ContainSubstring("Subject: CF Loupe: apps needing attention"))
+			Expect(messages[0].Data).To(ContainSubstring("multipart/alternative"))
+			Expect(messages[0].Data).To(ContainSubstring("stale-app (dev / project-x / dev), last updated 2017-07-01"))
+			Expect(messages[0].Data).To(ContainSubstring("<td>java_buildpack v1.19</td>"))
+		})
+
+		It("reports recipients that could not be sent to", func() {
+			smtpServer.Close()
+			err := NewNotifier(options, timeNow).Notify(apps)
+			Expect(err).To(MatchError(ContainSubstring("could not send digests to project-x@example.com")))
+		})
+	})
+
+	Context("When running dry", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "digests")
+			Expect(err).To(Succeed())
+			options.DryRunDir = filepath.Join(dir, "out")
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("writes the digests to the directory", func() {
+			err := NewNotifier(options, timeNow).Notify(apps)
+			Expect(err).To(Succeed())
+
+			message, err := ioutil.ReadFile(filepath.Join(dir, "out", "project-x@example.com.eml"))
+			Expect(err).To(Succeed())
+			Expect(string(message)).To(ContainSubstring("To: project-x@example.com"))
+			Expect(string(message)).To(ContainSubstring("old-app"))
+		})
+	})
+})
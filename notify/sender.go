@@ -0,0 +1,58 @@
+package notify
+
+import (
+	"io/ioutil"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Sender delivers an email message
+type Sender interface {
+	Send(from, to string, message []byte) error
+}
+
+// SMTPSender sends emails through an SMTP server
+type SMTPSender struct {
+	Addr     string // host:port
+	Username string // no authentication is used if empty
+	Password string
+}
+
+// Send sends a message through the SMTP server
+func (sender SMTPSender) Send(from, to string, message []byte) error {
+	var auth smtp.Auth
+	if sender.Username != "" {
+		host, _, err := net.SplitHostPort(sender.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", sender.Username, sender.Password, host)
+	}
+
+	return smtp.SendMail(sender.Addr, auth, from, []string{to}, message)
+}
+
+// DirSender writes emails to a directory instead of sending them, one file
+// per recipient
+type DirSender struct {
+	Dir string
+}
+
+// Send writes a message to <dir>/<recipient>.eml
+func (sender DirSender) Send(from, to string, message []byte) error {
+	if err := os.MkdirAll(sender.Dir, 0755); err != nil {
+		return err
+	}
+
+	filename := strings.Map(func(r rune) rune {
+		if r == '/' || r == os.PathSeparator {
+			return '_'
+		}
+		return r
+	}, to) + ".eml"
+
+	return ioutil.WriteFile(filepath.Join(sender.Dir, filename), message, 0644)
+}
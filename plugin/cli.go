@@ -0,0 +1,146 @@
+package main
+
+import (
+	"net"
+	"net/rpc"
+	"time"
+)
+
+// The cf CLI runs a plugin with the port of an RPC server as its first
+// argument, and the plugin calls back into the CLI through it. The types
+// below mirror those of the plugin SDK, which net/rpc encodes with gob, so
+// only their field names matter.
+
+// PluginMetadata describes the plugin to the CLI when it is installed
+type PluginMetadata struct {
+	Name          string
+	Version       VersionType
+	MinCliVersion VersionType
+	Commands      []Command
+}
+
+// VersionType is a plugin or CLI version
+type VersionType struct {
+	Major int
+	Minor int
+	Build int
+}
+
+// Command is a command the plugin adds to the CLI
+type Command struct {
+	Name         string
+	Alias        string
+	HelpText     string
+	UsageDetails Usage
+}
+
+// Usage is the help of a command
+type Usage struct {
+	Usage   string
+	Options map[string]string
+}
+
+// Org is the org the CLI targets
+type Org struct {
+	OrganizationFields
+}
+
+// OrganizationFields identify an org
+type OrganizationFields struct {
+	Guid string
+	Name string
+}
+
+// Space is the space the CLI targets
+type Space struct {
+	SpaceFields
+}
+
+// SpaceFields identify a space
+type SpaceFields struct {
+	Guid string
+	Name string
+}
+
+// CLI is the part of the cf CLI the plugin needs
+type CLI interface {
+	ApiEndpoint() (string, error)
+	AccessToken() (string, error)
+	IsSSLDisabled() (bool, error)
+	GetCurrentOrg() (Org, error)
+	GetCurrentSpace() (Space, error)
+}
+
+// CLIConnection calls the RPC server of the cf CLI
+type CLIConnection struct {
+	port string
+}
+
+// NewCLIConnection returns a connection to the CLI listening on a local port
+func NewCLIConnection(port string) *CLIConnection {
+	return &CLIConnection{port: port}
+}
+
+// Ping waits for the CLI's RPC server to accept connections
+func (connection *CLIConnection) Ping() error {
+	var err error
+	for i := 0; i < 5; i++ {
+		var conn net.Conn
+		if conn, err = net.Dial("tcp", "127.0.0.1:"+connection.port); err == nil {
+			return conn.Close()
+		}
+		time.Sleep(time.Second)
+	}
+	return err
+}
+
+func (connection *CLIConnection) call(method string, args interface{}, reply interface{}) error {
+	client, err := rpc.Dial("tcp", "127.0.0.1:"+connection.port)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return client.Call("CliRpcCmd."+method, args, reply)
+}
+
+// SetPluginMetadata sends the plugin's commands to the CLI
+func (connection *CLIConnection) SetPluginMetadata(metadata PluginMetadata) error {
+	var success bool
+	return connection.call("SetPluginMetadata", metadata, &success)
+}
+
+// ApiEndpoint returns the URL of the targeted Cloud Controller
+func (connection *CLIConnection) ApiEndpoint() (string, error) {
+	var endpoint string
+	err := connection.call("ApiEndpoint", "", &endpoint)
+	return endpoint, err
+}
+
+// AccessToken returns the logged in user's access token, refreshing it if needed
+func (connection *CLIConnection) AccessToken() (string, error) {
+	var token string
+	err := connection.call("AccessToken", "", &token)
+	return token, err
+}
+
+// IsSSLDisabled returns true if the CLI skips SSL validation
+func (connection *CLIConnection) IsSSLDisabled() (bool, error) {
+	var disabled bool
+	err := connection.call("IsSSLDisabled", "", &disabled)
+	return disabled, err
+}
+
+// GetCurrentOrg returns the targeted org
+func (connection *CLIConnection) GetCurrentOrg() (Org, error) {
+	var org Org
+	err := connection.call("GetCurrentOrg", "", &org)
+	return org, err
+}
+
+// GetCurrentSpace returns the targeted space
+func (connection *CLIConnection) GetCurrentSpace() (Space, error) {
+	var space Space
+	err := connection.call("GetCurrentSpace", "", &space)
+	return space, err
+}
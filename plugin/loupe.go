@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/FidelityInternational/cf-loupe/applist"
+	"github.com/FidelityInternational/cf-loupe/cf"
+	gocf "github.com/cloudfoundry-community/go-cfclient"
+)
+
+// Metadata tells the CLI about the loupe command
+var Metadata = PluginMetadata{
+	Name:    "loupe",
+	Version: VersionType{Major: 1, Minor: 0, Build: 0},
+	Commands: []Command{
+		{
+			Name:     "loupe",
+			HelpText: "Show which apps in the targeted space are stale or use a deprecated buildpack",
+			UsageDetails: Usage{
+				Usage: "cf loupe\n   cf loupe app APP_NAME",
+			},
+		},
+	},
+}
+
+// uninstallCommand is sent by the CLI when the plugin is uninstalled
+const uninstallCommand = "CLI-MESSAGE-UNINSTALL"
+
+// Run runs a loupe command against the CLI's target and returns the exit code.
+// args start with the name of the command.
+func Run(cli CLI, args []string, now time.Time, out io.Writer) int {
+	if len(args) > 0 && args[0] == uninstallCommand {
+		return 0
+	}
+	if len(args) > 0 {
+		args = args[1:]
+	}
+	if len(args) != 0 && (len(args) != 2 || args[0] != "app") {
+		fmt.Fprintf(out, "Usage: %s\n", Metadata.Commands[0].UsageDetails.Usage)
+		return 1
+	}
+
+	foundation, org, space, apps, err := targetedApps(cli, now)
+	if err != nil {
+		fmt.Fprintln(out, err.Error())
+		return 1
+	}
+
+	if len(args) == 2 {
+		return checkApp(out, apps, applist.AppQuery{Foundation: foundation, Org: org, Space: space, App: args[1]})
+	}
+
+	fmt.Fprintf(out, "Apps in org %s / space %s\n\n", org, space)
+	table := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "APP\tBUILDPACK\tVERSION\tUPDATED\tLOUPE")
+	for _, app := range apps {
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\n", app.Name, app.Buildpack.Name, app.Buildpack.Version, app.UpdatedAt, verdict(app))
+	}
+	table.Flush()
+
+	summary := applist.BuildSummary(apps)
+	fmt.Fprintf(out, "\n%d apps, %d stale, %d deprecated\n", summary.TotalApps, summary.StaleApps, summary.DeprecatedApps)
+	return 0
+}
+
+// targetedApps lists the apps of the targeted space with the logged in user's token
+func targetedApps(cli CLI, now time.Time) (foundation, org, space string, apps []applist.App, err error) {
+	endpoint, err := cli.ApiEndpoint()
+	if err != nil {
+		return "", "", "", nil, err
+	}
+	token, err := cli.AccessToken()
+	if err != nil {
+		return "", "", "", nil, err
+	}
+	if endpoint == "" || token == "" {
+		return "", "", "", nil, errors.New("Not logged in. Use 'cf login' to log in.")
+	}
+	sslDisabled, err := cli.IsSSLDisabled()
+	if err != nil {
+		return "", "", "", nil, err
+	}
+	currentOrg, err := cli.GetCurrentOrg()
+	if err != nil {
+		return "", "", "", nil, err
+	}
+	currentSpace, err := cli.GetCurrentSpace()
+	if err != nil {
+		return "", "", "", nil, err
+	}
+	if currentSpace.Guid == "" {
+		return "", "", "", nil, errors.New("No space targeted, use 'cf target -s SPACE'")
+	}
+
+	client, err := cf.NewClientFromToken(endpoint, token, sslDisabled)
+	if err != nil {
+		return "", "", "", nil, err
+	}
+	cfApps, err := client.ListSpaceApps(currentSpace.Guid)
+	if err != nil {
+		return "", "", "", nil, err
+	}
+	buildpacks, err := client.GetBuildpacks()
+	if err != nil {
+		return "", "", "", nil, err
+	}
+
+	foundation = endpoint
+	if endpointURL, err := url.Parse(endpoint); err == nil && endpointURL.Host != "" {
+		foundation = endpointURL.Host
+	}
+
+	apps, err = applist.BuildAppList(applist.Foundation{
+		GoCFApps:       cfApps,
+		GoCFBuildpacks: buildpacks,
+		GoCFOrgs: map[string]gocf.Org{
+			currentOrg.Guid: {Guid: currentOrg.Guid, Name: currentOrg.Name},
+		},
+		GoCFSpaces: map[string]gocf.Space{
+			currentSpace.Guid: {Guid: currentSpace.Guid, Name: currentSpace.Name, OrganizationGuid: currentOrg.Guid},
+		},
+	}, now, foundation)
+	if err != nil {
+		return "", "", "", nil, err
+	}
+	sort.Slice(apps, func(i, j int) bool {
+		return apps[i].Name < apps[j].Name
+	})
+
+	return foundation, currentOrg.Name, currentSpace.Name, apps, nil
+}
+
+func checkApp(out io.Writer, apps []applist.App, query applist.AppQuery) int {
+	result := applist.CheckApp(apps, query)
+	if !result.Found {
+		fmt.Fprintf(out, "App %s not found in org %s / space %s\n", query.App, query.Org, query.Space)
+		return 1
+	}
+	if result.Pass {
+		fmt.Fprintf(out, "%s is neither stale nor using a deprecated buildpack\n", query.App)
+		return 0
+	}
+
+	fmt.Fprintf(out, "%s needs attention:\n", query.App)
+	for _, reason := range result.Reasons {
+		fmt.Fprintf(out, "  - %s\n", reason)
+	}
+	return 1
+}
+
+func verdict(app applist.App) string {
+	problems := []string{}
+	if app.IsStale {
+		problems = append(problems, "stale")
+	}
+	if app.Buildpack.IsDeprecated {
+		problems = append(problems, "deprecated")
+	}
+	if len(problems) == 0 {
+		return "ok"
+	}
+	return strings.Join(problems, ", ")
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Println("This is a cf CLI plugin, install it with 'cf install-plugin'")
+		os.Exit(1)
+	}
+
+	connection := NewCLIConnection(os.Args[1])
+	if err := connection.Ping(); err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
+	}
+
+	if len(os.Args) == 3 && os.Args[2] == "SendMetadata" {
+		if err := connection.SetPluginMetadata(Metadata); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
+	os.Exit(Run(connection, os.Args[2:], time.Now(), os.Stdout))
+}
@@ -0,0 +1,156 @@
+package main_test
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"net/rpc"
+	"time"
+
+	"github.com/FidelityInternational/cf-loupe/helpers"
+	. "github.com/FidelityInternational/cf-loupe/plugin"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// FakeCLI stands in for the RPC server of the cf CLI
+type FakeCLI struct {
+	Endpoint string
+	Token    string
+	Org      Org
+	Space    Space
+	Metadata *PluginMetadata
+}
+
+func (cli *FakeCLI) SetPluginMetadata(metadata PluginMetadata, success *bool) error {
+	cli.Metadata = &metadata
+	*success = true
+	return nil
+}
+
+func (cli *FakeCLI) ApiEndpoint(_ string, endpoint *string) error {
+	*endpoint = cli.Endpoint
+	return nil
+}
+
+func (cli *FakeCLI) AccessToken(_ string, token *string) error {
+	*token = cli.Token
+	return nil
+}
+
+func (cli *FakeCLI) IsSSLDisabled(_ string, disabled *bool) error {
+	*disabled = false
+	return nil
+}
+
+func (cli *FakeCLI) GetCurrentOrg(_ string, org *Org) error {
+	*org = cli.Org
+	return nil
+}
+
+func (cli *FakeCLI) GetCurrentSpace(_ string, space *Space) error {
+	*space = cli.Space
+	return nil
+}
+
+var _ = Describe("cf loupe", func() {
+	var fakeAPI *helpers.FakeApi
+	var fakeCLI *FakeCLI
+	var listener net.Listener
+	var connection *CLIConnection
+	var now time.Time
+	var out *bytes.Buffer
+
+	BeforeEach(func() {
+		now, _ = time.Parse(time.RFC3339, "2017-08-15T15:00:06Z")
+		out = &bytes.Buffer{}
+
+		fakeAPI = helpers.NewFakeApi()
+		fakeAPI.Mux.HandleFunc("/v2/apps", func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.URL.Query().Get("q")).To(Equal("space_guid:space-guid"))
+			Expect(r.Header.Get("Authorization")).To(Equal("Bearer user-token"))
+			fmt.Fprint(w, `{"total_results": 2, "total_pages": 1, "resources": [
+				{"metadata": {"guid": "fresh-guid", "updated_at": "2017-08-12T16:41:45Z"},
+				 "entity": {"name": "fresh", "space_guid": "space-guid", "detected_buildpack_guid": "latest", "state": "STARTED"}},
+				{"metadata": {"guid": "old-guid", "updated_at": "2016-07-19T16:41:45Z"},
+				 "entity": {"name": "old", "space_guid": "space-guid", "detected_buildpack_guid": "oldest", "state": "STARTED"}}
+			]}`)
+		})
+		fakeAPI.Mux.HandleFunc("/v2/buildpacks", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"total_results": 3, "total_pages": 1, "resources": [
+				{"metadata": {"guid": "oldest"}, "entity": {"name": "ruby_buildpack", "filename": "ruby_buildpack-cached-v2.0.0.zip"}},
+				{"metadata": {"guid": "middle"}, "entity": {"name": "ruby_buildpack", "filename": "ruby_buildpack-cached-v2.0.1.zip"}},
+				{"metadata": {"guid": "latest"}, "entity": {"name": "ruby_buildpack", "filename": "ruby_buildpack-cached-v2.0.2.zip"}}
+			]}`)
+		})
+
+		fakeCLI = &FakeCLI{
+			Endpoint: fakeAPI.Server.URL,
+			Token:    "bearer user-token",
+			Org:      Org{OrganizationFields{Guid: "org-guid", Name: "project-x"}},
+			Space:    Space{SpaceFields{Guid: "space-guid", Name: "dev"}},
+		}
+		server := rpc.NewServer()
+		Expect(server.RegisterName("CliRpcCmd", fakeCLI)).To(Succeed())
+
+		var err error
+		listener, err = net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).To(Succeed())
+		go server.Accept(listener)
+
+		_, port, err := net.SplitHostPort(listener.Addr().String())
+		Expect(err).To(Succeed())
+		connection = NewCLIConnection(port)
+		Expect(connection.Ping()).To(Succeed())
+	})
+
+	AfterEach(func() {
+		listener.Close()
+		fakeAPI.TeardownFakeApi()
+	})
+
+	It("sends its commands to the CLI", func() {
+		Expect(connection.SetPluginMetadata(Metadata)).To(Succeed())
+
+		Expect(fakeCLI.Metadata.Name).To(Equal("loupe"))
+		Expect(fakeCLI.Metadata.Commands[0].Name).To(Equal("loupe"))
+	})
+
+	It("lists the apps in the targeted space with their status", func() {
+		Expect(Run(connection, []string{"loupe"}, now, out)).To(Equal(0))
+
+		Expect(out.String()).To(ContainSubstring("Apps in org project-x / space dev"))
+		Expect(out.String()).To(MatchRegexp(`fresh\s+ruby\s+2.0.2\s+2017-08-12\s+ok`))
+		Expect(out.String()).To(MatchRegexp(`old\s+ruby\s+2.0.0\s+2016-07-19\s+stale, deprecated`))
+		Expect(out.String()).To(ContainSubstring("2 apps, 1 stale, 1 deprecated"))
+	})
+
+	It("passes a healthy app", func() {
+		Expect(Run(connection, []string{"loupe", "app", "fresh"}, now, out)).To(Equal(0))
+		Expect(out.String()).To(ContainSubstring("fresh is neither stale nor using a deprecated buildpack"))
+	})
+
+	It("fails an app that needs attention, with the reasons", func() {
+		Expect(Run(connection, []string{"loupe", "app", "old"}, now, out)).To(Equal(1))
+		Expect(out.String()).To(ContainSubstring("old needs attention:"))
+		Expect(out.String()).To(ContainSubstring("app was last updated on 2016-07-19, more than 14 days ago"))
+	})
+
+	It("fails an unknown app", func() {
+		Expect(Run(connection, []string{"loupe", "app", "missing"}, now, out)).To(Equal(1))
+		Expect(out.String()).To(ContainSubstring("App missing not found in org project-x / space dev"))
+	})
+
+	It("needs a targeted space", func() {
+		fakeCLI.Space = Space{}
+		Expect(Run(connection, []string{"loupe"}, now, out)).To(Equal(1))
+		Expect(out.String()).To(ContainSubstring("No space targeted"))
+	})
+
+	It("shows the usage for unknown arguments", func() {
+		Expect(Run(connection, []string{"loupe", "apps"}, now, out)).To(Equal(1))
+		Expect(out.String()).To(ContainSubstring("cf loupe app APP_NAME"))
+	})
+})
@@ -0,0 +1,87 @@
+package publish
+
+import (
+	"sort"
+	"time"
+
+	"github.com/FidelityInternational/cf-loupe/applist"
+)
+
+// Event types
+const (
+	TypeSnapshotCompleted = "snapshot.completed"
+	TypeAppAdded          = "app.added"
+	TypeAppChanged        = "app.changed"
+	TypeAppRemoved        = "app.removed"
+)
+
+// Event is published after each completed scrape
+type Event struct {
+	Type string
+	Time time.Time
+	// Summary is only set on snapshot events
+	Summary *applist.Summary `json:",omitempty"`
+	// App is the app after the change, or before it for removals
+	App *applist.App `json:",omitempty"`
+}
+
+// appState contains the fields of an app whose change is published. Usage
+// figures change on every scrape, so they are left out.
+type appState struct {
+	UpdatedAt  string
+	Buildpack  applist.Buildpack
+	IsStale    bool
+	Instances  int
+	MemoryMB   int
+	State      string
+	Status     string
+	IsDegraded bool
+	Owner      string
+}
+
+func stateOf(app applist.App) appState {
+	return appState{
+		UpdatedAt:  app.UpdatedAt,
+		Buildpack:  app.Buildpack,
+		IsStale:    app.IsStale,
+		Instances:  app.Instances,
+		MemoryMB:   app.MemoryMB,
+		State:      app.State,
+		Status:     app.Status,
+		IsDegraded: app.Health != nil && app.Health.IsDegraded,
+		Owner:      app.Owner,
+	}
+}
+
+// Changes returns the events for the apps that were added, changed or removed
+// between two scrapes, ordered by app
+func Changes(previous, current []applist.App, now time.Time) []Event {
+	previousApps := map[string]applist.App{}
+	for _, app := range previous {
+		previousApps[app.Key()] = app
+	}
+
+	events := []Event{}
+	currentKeys := map[string]bool{}
+	for i, app := range current {
+		key := app.Key()
+		currentKeys[key] = true
+
+		previousApp, ok := previousApps[key]
+		if !ok {
+			events = append(events, Event{Type: TypeAppAdded, Time: now, App: &current[i]})
+		} else if stateOf(previousApp) != stateOf(app) {
+			events = append(events, Event{Type: TypeAppChanged, Time: now, App: &current[i]})
+		}
+	}
+	for i, app := range previous {
+		if !currentKeys[app.Key()] {
+			events = append(events, Event{Type: TypeAppRemoved, Time: now, App: &previous[i]})
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].App.Key() < events[j].App.Key()
+	})
+	return events
+}
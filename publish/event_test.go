@@ -0,0 +1,43 @@
+package publish_test
+
+import (
+	"time"
+
+	"github.com/FidelityInternational/cf-loupe/applist"
+	. "github.com/FidelityInternational/cf-loupe/publish"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Changes", func() {
+	var now time.Time
+
+	BeforeEach(func() {
+		now, _ = time.Parse(time.RFC3339, "2017-08-15T15:00:06Z")
+	})
+
+	It("returns the added, changed and removed apps", func() {
+		previous := []applist.App{
+			{Name: "kept", Foundation: "dev", Org: "project-x", Space: "dev", State: "started"},
+			{Name: "changed", Foundation: "dev", Org: "project-x", Space: "dev", State: "started"},
+			{Name: "removed", Foundation: "dev", Org: "project-x", Space: "dev", State: "started"},
+		}
+		current := []applist.App{
+			{Name: "kept", Foundation: "dev", Org: "project-x", Space: "dev", State: "started", Usage: &applist.ResourceUsage{}},
+			{Name: "changed", Foundation: "dev", Org: "project-x", Space: "dev", State: "stopped"},
+			{Name: "added", Foundation: "dev", Org: "project-x", Space: "dev", State: "started"},
+		}
+
+		events := Changes(previous, current, now)
+
+		Expect(events).To(HaveLen(3))
+		Expect(events[0].Type).To(Equal(TypeAppAdded))
+		Expect(events[0].App.Name).To(Equal("added"))
+		Expect(events[1].Type).To(Equal(TypeAppChanged))
+		Expect(events[1].App.State).To(Equal("stopped"))
+		Expect(events[2].Type).To(Equal(TypeAppRemoved))
+		Expect(events[2].App.Name).To(Equal("removed"))
+		Expect(events[2].Time).To(Equal(now))
+	})
+})
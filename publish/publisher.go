@@ -0,0 +1,165 @@
+package publish
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/FidelityInternational/cf-loupe/applist"
+)
+
+// Sink kinds
+const (
+	SinkWebhook = "webhook"
+	SinkFile    = "file"
+	SinkStdout  = "stdout"
+)
+
+const (
+	defaultRetries = 3
+	defaultBackoff = time.Second
+	queueSize      = 100
+)
+
+// Options configures the event stream
+type Options struct {
+	// Sink is webhook, file or stdout. No events are published if it is empty.
+	Sink    string
+	URL     string
+	Secret  string
+	File    string
+	Retries int
+	// Backoff is the wait before the first retry. It doubles on every retry.
+	Backoff time.Duration
+}
+
+// Enabled returns true if events should be published
+func (options Options) Enabled() bool {
+	return options.Sink != ""
+}
+
+// NewSink returns the configured sink
+func (options Options) NewSink() (Sink, error) {
+	switch options.Sink {
+	case SinkWebhook:
+		if options.URL == "" {
+			return nil, fmt.Errorf("the %s sink needs a url", SinkWebhook)
+		}
+		return WebhookSink{URL: options.URL, Secret: options.Secret, Client: &http.Client{Timeout: 10 * time.Second}}, nil
+	case SinkFile:
+		if options.File == "" {
+			return nil, fmt.Errorf("the %s sink needs a file", SinkFile)
+		}
+		return FileSink{Path: options.File}, nil
+	case SinkStdout:
+		return WriterSink{Writer: os.Stdout}, nil
+	}
+	return nil, fmt.Errorf("unknown sink %q", options.Sink)
+}
+
+// Publisher turns each completed scrape into events and publishes them to a
+// sink in the background
+type Publisher struct {
+	sink    Sink
+	retries int
+	backoff time.Duration
+	timeNow func() time.Time
+	queue   chan []Event
+
+	mutex    sync.Mutex
+	previous []applist.App // nil until the first scrape
+}
+
+// NewPublisher returns a publisher. Run must be called to publish the events.
+func NewPublisher(sink Sink, options Options, timeNow func() time.Time) *Publisher {
+	retries := options.Retries
+	if retries <= 0 {
+		retries = defaultRetries
+	}
+	backoff := options.Backoff
+	if backoff <= 0 {
+		backoff = defaultBackoff
+	}
+
+	return &Publisher{
+		sink:    sink,
+		retries: retries,
+		backoff: backoff,
+		timeNow: timeNow,
+		queue:   make(chan []Event, queueSize),
+	}
+}
+
+// Observe queues a snapshot event and the app changes since the previous
+// scrape. The first scrape only produces a snapshot event. Failed scrapes
+// are not published.
+func (publisher *Publisher) Observe(appData applist.AppData, scrapeErr error) {
+	if scrapeErr != nil {
+		return
+	}
+
+	publisher.mutex.Lock()
+	now := publisher.timeNow()
+	summary := appData.Summary
+	events := []Event{{Type: TypeSnapshotCompleted, Time: now, Summary: &summary}}
+	if publisher.previous != nil {
+		events = append(events, Changes(publisher.previous, appData.Apps, now)...)
+	}
+	publisher.previous = appData.Apps
+	publisher.mutex.Unlock()
+
+	select {
+	case publisher.queue <- events:
+	default:
+		log.Printf("dropped %d events as the publish queue is full\n", len(events))
+	}
+}
+
+// Run publishes the queued events until ctx is done
+func (publisher *Publisher) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case events := <-publisher.queue:
+			if err := publisher.Publish(events); err != nil {
+				log.Printf("could not publish %d events: %s\n", len(events), err)
+			}
+		}
+	}
+}
+
+// Publish sends events to the sink, retrying with exponential backoff when
+// it may succeed the next time
+func (publisher *Publisher) Publish(events []Event) error {
+	backoff := publisher.backoff
+	var err error
+	for attempt := 0; attempt <= publisher.retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		if err = publisher.sink.Publish(events); err == nil || !retryable(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// retryable says if a sink error may go away: network errors, and webhooks
+// answering 429 Too Many Requests or a 5xx status. Other errors, such as a
+// rejected body or a file that cannot be written, are not retried.
+func retryable(err error) bool {
+	var statusErr StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= http.StatusInternalServerError
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
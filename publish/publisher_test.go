@@ -0,0 +1,182 @@
+package publish_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/FidelityInternational/cf-loupe/applist"
+	. "github.com/FidelityInternational/cf-loupe/publish"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type fakeSink struct {
+	mutex    sync.Mutex
+	failures int
+	// err is returned by the failures, a 503 if nil
+	err     error
+	batches [][]Event
+}
+
+func (sink *fakeSink) Publish(events []Event) error {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	if sink.failures > 0 {
+		sink.failures--
+		if sink.err != nil {
+			return sink.err
+		}
+		return StatusError{StatusCode: http.StatusServiceUnavailable, Status: "503 Service Unavailable"}
+	}
+	sink.batches = append(sink.batches, events)
+	return nil
+}
+
+func (sink *fakeSink) published() [][]Event {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	return sink.batches
+}
+
+var _ = Describe("Publisher", func() {
+	var timeNow func() time.Time
+	var options Options
+
+	BeforeEach(func() {
+		timeNow = func() time.Time {
+			t, _ := time.Parse(time.RFC3339, "2017-08-15T15:00:06Z")
+			return t
+		}
+		options = Options{Retries: 2, Backoff: time.Millisecond}
+	})
+
+	It("publishes a snapshot event and the app changes of each scrape", func() {
+		sink := &fakeSink{}
+		publisher := NewPublisher(sink, options, timeNow)
+		go publisher.Run(context.Background())
+
+		apps := []applist.App{{Name: "app1", Foundation: "dev", Org: "project-x", Space: "dev"}}
+		publisher.Observe(applist.AppData{Apps: apps, Summary: applist.Summary{TotalApps: 1}}, nil)
+		publisher.Observe(applist.AppData{}, errors.New("The server is on fire!"))
+		publisher.Observe(applist.AppData{Apps: []applist.App{}}, nil)
+
+		Eventually(sink.published).Should(HaveLen(2))
+		batches := sink.published()
+		Expect(batches[0]).To(HaveLen(1))
+		Expect(batches[0][0].Type).To(Equal(TypeSnapshotCompleted))
+		Expect(batches[0][0].Summary.TotalApps).To(Equal(1))
+		Expect(batches[1]).To(HaveLen(2))
+		Expect(batches[1][1].Type).To(Equal(TypeAppRemoved))
+	})
+
+	It("retries a failing sink", func() {
+		sink := &fakeSink{failures: 2}
+		publisher := NewPublisher(sink, options, timeNow)
+
+		Expect(publisher.Publish([]Event{{Type: TypeSnapshotCompleted}})).To(Succeed())
+		Expect(sink.published()).To(HaveLen(1))
+	})
+
+	It("gives up after the configured retries", func() {
+		sink := &fakeSink{failures: 3}
+		publisher := NewPublisher(sink, options, timeNow)
+
+		Expect(publisher.Publish([]Event{{Type: TypeSnapshotCompleted}})).To(MatchError("webhook returned 503 Service Unavailable"))
+	})
+
+	It("retries network errors", func() {
+		sink := &fakeSink{failures: 2, err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}}
+		publisher := NewPublisher(sink, options, timeNow)
+
+		Expect(publisher.Publish([]Event{{Type: TypeSnapshotCompleted}})).To(Succeed())
+		Expect(sink.published()).To(HaveLen(1))
+	})
+
+	It("does not retry errors that would happen again", func() {
+		for _, err := range []error{
+			StatusError{StatusCode: http.StatusBadRequest, Status: "400 Bad Request"},
+			errors.New("disk is full"),
+		} {
+			sink := &fakeSink{failures: 1, err: err}
+			publisher := NewPublisher(sink, options, timeNow)
+
+			Expect(publisher.Publish([]Event{{Type: TypeSnapshotCompleted}})).To(MatchError(err))
+			Expect(sink.published()).To(BeEmpty())
+		}
+	})
+})
+
+var _ = Describe("Sinks", func() {
+	var events []Event
+
+	BeforeEach(func() {
+		events = []Event{
+			{Type: TypeSnapshotCompleted, Summary: &applist.Summary{TotalApps: 3}},
+			{Type: TypeAppAdded, App: &applist.App{Name: "app1"}},
+		}
+	})
+
+	It("posts signed events to a webhook", func() {
+		var body []byte
+		var signature string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ = ioutil.ReadAll(r.Body)
+			signature = r.Header.Get(SignatureHeader)
+		}))
+		defer server.Close()
+
+		err := WebhookSink{URL: server.URL, Secret: "s3cret"}.Publish(events)
+		Expect(err).To(Succeed())
+
+		Expect(signature).To(Equal(Sign("s3cret", body)))
+		var received []Event
+		Expect(json.Unmarshal(body, &received)).To(Succeed())
+		Expect(received).To(HaveLen(2))
+		Expect(received[1].App.Name).To(Equal("app1"))
+	})
+
+	It("reports webhook errors", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer server.Close()
+
+		err := WebhookSink{URL: server.URL}.Publish(events)
+		Expect(err).To(MatchError("webhook returned 502 Bad Gateway"))
+	})
+
+	It("appends events to a file as JSON lines", func() {
+		dir, err := ioutil.TempDir("", "events")
+		Expect(err).To(Succeed())
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "events.jsonl")
+
+		Expect(FileSink{Path: path}.Publish(events)).To(Succeed())
+		Expect(FileSink{Path: path}.Publish(events[:1])).To(Succeed())
+
+		file, err := os.Open(path)
+		Expect(err).To(Succeed())
+		defer file.Close()
+
+		lines := []Event{}
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			var event Event
+			Expect(json.Unmarshal(scanner.Bytes(), &event)).To(Succeed())
+			lines = append(lines, event)
+		}
+		Expect(lines).To(HaveLen(3))
+		Expect(lines[2].Type).To(Equal(TypeSnapshotCompleted))
+	})
+})
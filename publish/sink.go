@@ -0,0 +1,117 @@
+package publish
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+)
+
+// SignatureHeader carries the HMAC-SHA256 of a webhook body, signed with the
+// shared secret
+const SignatureHeader = "X-Loupe-Signature"
+
+// Sink receives the events of a scrape
+type Sink interface {
+	Publish(events []Event) error
+}
+
+// WebhookSink posts the events of a scrape as a JSON list
+type WebhookSink struct {
+	URL    string
+	Secret string // the body is not signed if empty
+	Client *http.Client
+}
+
+// Publish posts the events to the webhook
+func (sink WebhookSink) Publish(events []Event) error {
+	body, err := json.Marshal(events)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", sink.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if sink.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(sink.Secret, body))
+	}
+
+	client := sink.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return StatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	return nil
+}
+
+// StatusError is returned when the webhook answers with an error status
+type StatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (err StatusError) Error() string {
+	return fmt.Sprintf("webhook returned %s", err.Status)
+}
+
+// Sign returns the signature of a body, as sent in the signature header
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// FileSink appends the events to a file in JSON Lines format
+type FileSink struct {
+	Path string
+}
+
+// Publish appends one line per event to the file
+func (sink FileSink) Publish(events []Event) error {
+	file, err := os.OpenFile(sink.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return writeJSONLines(file, events)
+}
+
+// WriterSink writes the events to a writer, such as stdout, in JSON Lines format
+type WriterSink struct {
+	Writer io.Writer
+}
+
+// Publish writes one line per event
+func (sink WriterSink) Publish(events []Event) error {
+	return writeJSONLines(sink.Writer, events)
+}
+
+func writeJSONLines(writer io.Writer, events []Event) error {
+	var lines bytes.Buffer
+	encoder := json.NewEncoder(&lines)
+	for _, event := range events {
+		if err := encoder.Encode(event); err != nil {
+			return err
+		}
+	}
+
+	_, err := writer.Write(lines.Bytes())
+	return err
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/FidelityInternational/cf-loupe/applist"
+	"github.com/FidelityInternational/cf-loupe/cf"
+)
+
+// Report exit codes
+const (
+	ReportOK         = 0
+	ReportViolations = 1 // more apps are stale or deprecated than allowed
+	ReportError      = 2 // the flags are invalid or the foundations could not be scraped
+)
+
+var reportCSVHeader = []string{"Foundation", "Org", "Space", "App", "Buildpack", "Version", "UpdatedAt", "Stale", "Deprecated", "Status", "Owner"}
+
+// Report scrapes the foundations once and writes the apps and their summary
+// to out as a table, JSON or CSV. It returns the exit code of the command.
+func Report(args []string, cfClients map[string]cf.IClient, now time.Time, config Config, out io.Writer, errOut io.Writer) int {
+	flags := flag.NewFlagSet("report", flag.ContinueOnError)
+	flags.SetOutput(errOut)
+	format := flags.String("format", "table", "output format: table, json or csv")
+	foundation := flags.String("foundation", "", "only scrape and report this foundation")
+	org := flags.String("org", "", "only report apps in this org")
+	space := flags.String("space", "", "only report apps in this space")
+	status := flags.String("status", "", "only report apps with this status, eg crashed")
+	label := flags.String("label", "", "only report apps with this label, as key or key=value")
+	violationsOnly := flags.Bool("violations", false, "only report apps that are stale or use a deprecated buildpack")
+	maxViolations := flags.Int("max-violations", -1, "exit with 1 if more apps than this are stale or use a deprecated buildpack")
+	if err := flags.Parse(args); err != nil {
+		return ReportError
+	}
+	if *format != "table" && *format != "json" && *format != "csv" {
+		fmt.Fprintf(errOut, "-format must be table, json or csv, got %q\n", *format)
+		return ReportError
+	}
+
+	if *foundation != "" {
+		cfClient, ok := cfClients[*foundation]
+		if !ok {
+			fmt.Fprintf(errOut, "-foundation must be one of the configured foundations, got %q\n", *foundation)
+			return ReportError
+		}
+		cfClients = map[string]cf.IClient{*foundation: cfClient}
+	}
+
+	appData, err := applist.BuildAppData(cfClients, now, config.AppList)
+	if err != nil {
+		fmt.Fprintln(errOut, err.Error())
+		return ReportError
+	}
+
+	apps := []applist.App{}
+	violations := 0
+	for _, app := range applist.FilterByLabel(applist.FilterByStatus(appData.Apps, *status), *label) {
+		if (*org != "" && app.Org != *org) || (*space != "" && app.Space != *space) {
+			continue
+		}
+		if !app.IsHappy() {
+			violations++
+		} else if *violationsOnly {
+			continue
+		}
+		apps = append(apps, app)
+	}
+	sort.Slice(apps, func(i, j int) bool {
+		return apps[i].Key() < apps[j].Key()
+	})
+	summary := applist.BuildSummary(apps)
+
+	switch *format {
+	case "json":
+		err = json.NewEncoder(out).Encode(applist.AppData{Apps: apps, Summary: summary})
+	case "csv":
+		err = writeReportCSV(out, apps)
+	default:
+		err = writeReportTable(out, apps, summary)
+	}
+	if err != nil {
+		fmt.Fprintln(errOut, err.Error())
+		return ReportError
+	}
+
+	if *maxViolations >= 0 && violations > *maxViolations {
+		fmt.Fprintf(errOut, "%d apps are stale or use a deprecated buildpack, at most %d are allowed\n", violations, *maxViolations)
+		return ReportViolations
+	}
+	return ReportOK
+}
+
+func writeReportTable(out io.Writer, apps []applist.App, summary applist.Summary) error {
+	table := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "FOUNDATION\tORG\tSPACE\tAPP\tBUILDPACK\tVERSION\tUPDATED\tSTALE\tDEPRECATED\tSTATUS")
+	for _, app := range apps {
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			app.Foundation, app.Org, app.Space, app.Name, app.Buildpack.Name, app.Buildpack.Version,
+			app.UpdatedAt, yesNo(app.IsStale), yesNo(app.Buildpack.IsDeprecated), app.Status)
+	}
+	if err := table.Flush(); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(out, "\n%d apps, %d stale, %d deprecated, %d crashed\n",
+		summary.TotalApps, summary.StaleApps, summary.DeprecatedApps, summary.CrashedApps)
+	return err
+}
+
+func writeReportCSV(out io.Writer, apps []applist.App) error {
+	writer := csv.NewWriter(out)
+	writer.Write(reportCSVHeader)
+	for _, app := range apps {
+		writer.Write([]string{
+			app.Foundation, app.Org, app.Space, app.Name, app.Buildpack.Name, app.Buildpack.Version,
+			app.UpdatedAt, strconv.FormatBool(app.IsStale), strconv.FormatBool(app.Buildpack.IsDeprecated), app.Status, app.Owner,
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
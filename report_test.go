@@ -0,0 +1,140 @@
+package main_test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"time"
+
+	gocf "github.com/cloudfoundry-community/go-cfclient"
+
+	. "github.com/FidelityInternational/cf-loupe"
+	"github.com/FidelityInternational/cf-loupe/applist"
+	"github.com/FidelityInternational/cf-loupe/cf"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Report", func() {
+	var cfClient FakeClient
+	var now time.Time
+	var out, errOut *bytes.Buffer
+
+	BeforeEach(func() {
+		now, _ = time.Parse(time.RFC3339, "2017-08-15T15:00:06Z")
+		out = &bytes.Buffer{}
+		errOut = &bytes.Buffer{}
+
+		cfClient = FakeClient{
+			ReAuthFunc: func() error { return nil },
+			ListAppsFunc: func() ([]gocf.App, error) {
+				return []gocf.App{
+					{Name: "fresh", UpdatedAt: "2017-08-12T16:41:45Z", DetectedBuildpackGuid: "latest", SpaceGuid: "dev-guid", State: "STARTED"},
+					{Name: "stale", UpdatedAt: "2016-07-19T16:41:45Z", DetectedBuildpackGuid: "latest", SpaceGuid: "dev-guid", State: "STARTED"},
+					{Name: "old-buildpack", UpdatedAt: "2017-08-12T16:41:45Z", DetectedBuildpackGuid: "oldest", SpaceGuid: "test-guid", State: "STARTED"},
+				}, nil
+			},
+			GetBuildpacksFunc: func() (map[string]gocf.Buildpack, error) {
+				return map[string]gocf.Buildpack{
+					"oldest": {Name: "ruby_buildpack", Filename: "ruby_buildpack-cached-v2.0.0.zip"},
+					"middle": {Name: "ruby_buildpack", Filename: "ruby_buildpack-cached-v2.0.1.zip"},
+					"latest": {Name: "ruby_buildpack", Filename: "ruby_buildpack-cached-v2.0.2.zip"},
+				}, nil
+			},
+			GetOrgsFunc: func() (map[string]gocf.Org, error) {
+				return map[string]gocf.Org{"org-guid": {Name: "project-x"}}, nil
+			},
+			GetSpacesFunc: func() (map[string]gocf.Space, error) {
+				return map[string]gocf.Space{
+					"dev-guid":  {Name: "dev", OrganizationGuid: "org-guid"},
+					"test-guid": {Name: "test", OrganizationGuid: "org-guid"},
+				}, nil
+			},
+			GetOrgQuotasFunc: func() (map[string]gocf.OrgQuota, error) {
+				return map[string]gocf.OrgQuota{}, nil
+			},
+			GetSpaceQuotasFunc: func() (map[string]gocf.SpaceQuota, error) {
+				return map[string]gocf.SpaceQuota{}, nil
+			},
+		}
+	})
+
+	report := func(args ...string) int {
+		return Report(args, map[string]cf.IClient{"dev": &cfClient}, now, Config{}, out, errOut)
+	}
+
+	It("prints a table of the apps and a summary", func() {
+		Expect(report()).To(Equal(ReportOK))
+
+		Expect(out.String()).To(ContainSubstring("FOUNDATION  ORG        SPACE  APP"))
+		Expect(out.String()).To(MatchRegexp(`dev\s+project-x\s+dev\s+fresh\s+ruby\s+2.0.2\s+2017-08-12\s+no\s+no\s+staged`))
+		Expect(out.String()).To(ContainSubstring("3 apps, 1 stale, 1 deprecated, 0 crashed"))
+	})
+
+	It("prints JSON", func() {
+		Expect(report("-format", "json")).To(Equal(ReportOK))
+
+		var appData applist.AppData
+		Expect(json.Unmarshal(out.Bytes(), &appData)).To(Succeed())
+		Expect(appData.Apps).To(HaveLen(3))
+		Expect(appData.Summary.TotalApps).To(Equal(3))
+	})
+
+	It("prints CSV sorted by foundation, org, space and app", func() {
+		Expect(report("-format", "csv")).To(Equal(ReportOK))
+
+		records, err := csv.NewReader(out).ReadAll()
+		Expect(err).To(Succeed())
+		Expect(records).To(HaveLen(4))
+		Expect(records[0][:4]).To(Equal([]string{"Foundation", "Org", "Space", "App"}))
+		Expect(records[1][3]).To(Equal("fresh"))
+		Expect(records[2][3]).To(Equal("stale"))
+		Expect(records[2][7]).To(Equal("true"))
+		Expect(records[3][3]).To(Equal("old-buildpack"))
+		Expect(records[3][8]).To(Equal("true"))
+	})
+
+	It("filters the apps", func() {
+		Expect(report("-format", "csv", "-space", "dev", "-violations")).To(Equal(ReportOK))
+
+		records, err := csv.NewReader(out).ReadAll()
+		Expect(err).To(Succeed())
+		Expect(records).To(HaveLen(2))
+		Expect(records[1][3]).To(Equal("stale"))
+	})
+
+	It("only scrapes the foundation it reports", func() {
+		failing := FakeClient{
+			ReAuthFunc: func() error { return errors.New("The server is on fire!") },
+		}
+		cfClients := map[string]cf.IClient{"dev": &cfClient, "prod": &failing}
+
+		Expect(Report([]string{"-foundation", "dev"}, cfClients, now, Config{}, out, errOut)).To(Equal(ReportOK))
+		Expect(out.String()).To(ContainSubstring("fresh"))
+
+		Expect(Report([]string{"-foundation", "test"}, cfClients, now, Config{}, out, errOut)).To(Equal(ReportError))
+		Expect(errOut.String()).To(ContainSubstring(`-foundation must be one of the configured foundations, got "test"`))
+	})
+
+	It("exits with 1 when more apps than allowed are stale or deprecated", func() {
+		Expect(report("-max-violations", "2")).To(Equal(ReportOK))
+		Expect(report("-max-violations", "1")).To(Equal(ReportViolations))
+		Expect(errOut.String()).To(ContainSubstring("2 apps are stale or use a deprecated buildpack, at most 1 are allowed"))
+	})
+
+	It("exits with 2 when the flags are invalid", func() {
+		Expect(report("-format", "xml")).To(Equal(ReportError))
+		Expect(errOut.String()).To(ContainSubstring(`-format must be table, json or csv, got "xml"`))
+	})
+
+	It("exits with 2 when a foundation cannot be scraped", func() {
+		cfClient.ListAppsFunc = func() ([]gocf.App, error) {
+			return nil, errors.New("The server is on fire!")
+		}
+
+		Expect(report()).To(Equal(ReportError))
+		Expect(errOut.String()).To(ContainSubstring("The server is on fire!"))
+	})
+})
@@ -1,31 +1,164 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"html/template"
 	"log"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
+	"github.com/FidelityInternational/cf-loupe/alert"
 	"github.com/FidelityInternational/cf-loupe/applist"
 	"github.com/FidelityInternational/cf-loupe/cf"
+	"github.com/FidelityInternational/cf-loupe/notify"
+	"github.com/FidelityInternational/cf-loupe/publish"
 	"github.com/julienschmidt/httprouter"
 )
 
+// readOnlyPOSTPaths are the POST endpoints that only read, which API tokens may call
+var readOnlyPOSTPaths = []string{"/api/check"}
+
 // caches response App Data
 type crAppData struct {
-	marshalledAppData *[]byte
-	lastFetched       time.Time
-	activelyScraping  *bool
+	mutex       sync.Mutex
+	appData     *applist.AppData
+	lastFetched time.Time
+	// inFlight is the scrape running, if any, which other requests wait for
+	inFlight *scrapeCall
+	// build fetches new app data
+	build func(now time.Time) (applist.AppData, error)
+	// telemetry records how each scrape went
+	telemetry *applist.Telemetry
+	// observers are called after every scrape, successful or not
+	observers []func(applist.AppData, error)
+}
+
+// scrapeCall is a running scrape. done is closed once it has finished.
+type scrapeCall struct {
+	done    chan struct{}
+	appData applist.AppData
+	err     error
+}
+
+// Router serves the dashboard. Its background scrapes, alerts, events and
+// digests run until it is stopped.
+type Router struct {
+	*httprouter.Router
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	mutex  sync.Mutex
+	// stopped is set by Stop, after which no background work is started
+	stopped bool
+	running sync.WaitGroup
 }
 
-// BuildRouter returns the main router
-func BuildRouter(cfClients map[string]cf.IClient, timeNow func() time.Time) *httprouter.Router {
-	crAppData := crAppData{
-		activelyScraping: new(bool),
+// Stop ends the background work of the router and waits for it to finish
+func (router *Router) Stop() {
+	router.mutex.Lock()
+	router.stopped = true
+	router.cancel()
+	router.mutex.Unlock()
+
+	router.running.Wait()
+}
+
+// background runs work in a goroutine until the router is stopped
+func (router *Router) background(work func(ctx context.Context)) {
+	router.mutex.Lock()
+	defer router.mutex.Unlock()
+	if router.stopped {
+		return
+	}
+
+	router.running.Add(1)
+	go func() {
+		defer router.running.Done()
+		work(router.ctx)
+	}()
+}
+
+// BuildRouter returns the main router. Stop must be called to end its
+// background work.
+func BuildRouter(cfClients map[string]cf.IClient, timeNow func() time.Time, config Config) *Router {
+	started := time.Now()
+	router := &Router{Router: httprouter.New()}
+	router.ctx, router.cancel = context.WithCancel(context.Background())
+
+	telemetry := applist.NewTelemetry(config.statusScrapes())
+	options := config.AppList
+	options.Telemetry = telemetry
+	crAppData := &crAppData{
+		build: func(now time.Time) (applist.AppData, error) {
+			return applist.BuildAppData(cfClients, now, options)
+		},
+		telemetry: telemetry,
+	}
+	if config.IncrementalRefresh {
+		crAppData.build = applist.NewSyncer(cfClients, options, config.FullSyncInterval).BuildAppData
+	}
+	resolver := newVisibilityResolver(config.Visibility, cfClients, timeNow)
+	broker := newEventBroker(timeNow, resolver.resolve)
+	crAppData.observers = append(crAppData.observers, resolver.observe, broker.observe)
+	if config.Alerts.Enabled() && !config.SecondaryInstance {
+		alerter := alert.NewAlerter(config.Alerts, timeNow)
+		router.background(alerter.Run)
+		crAppData.observers = append(crAppData.observers, func(appData applist.AppData, err error) {
+			alerter.Observe(appData, err)
+		})
+	}
+	if config.Publish.Enabled() && !config.SecondaryInstance {
+		sink, err := config.Publish.NewSink()
+		if err != nil {
+			log.Printf("not publishing events: %s\n", err)
+		} else {
+			publisher := publish.NewPublisher(sink, config.Publish, timeNow)
+			router.background(publisher.Run)
+			crAppData.observers = append(crAppData.observers, publisher.Observe)
+		}
+	}
+
+	if config.RefreshInterval > 0 {
+		router.background(func(ctx context.Context) {
+			ticker := time.NewTicker(config.RefreshInterval)
+			defer ticker.Stop()
+			for {
+				if _, err := crAppData.scrape(timeNow); err != nil {
+					log.Println(err.Error())
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		})
 	}
 
-	router := httprouter.New()
+	if config.Digest.Enabled() && !config.SecondaryInstance {
+		notifier := notify.NewNotifier(config.Digest, timeNow)
+		router.background(func(ctx context.Context) {
+			notifier.Run(ctx, config.Digest.Interval, func() (applist.AppData, error) {
+				return crAppData.scrape(timeNow)
+			})
+		})
+	}
+
+	// visibleAppData returns the part of the app data the user of a request can see
+	visibleAppData := func(r *http.Request) (applist.AppData, error) {
+		appData, err := crAppData.scrape(timeNow)
+		if err != nil {
+			return applist.AppData{}, err
+		}
+		return resolver.resolve(r).Filter(appData), nil
+	}
+
+	router.Handler("GET", "/events", broker)
 
 	router.GET("/", func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		templ, err := template.ParseFiles("templates/index.html")
@@ -40,56 +173,312 @@ func BuildRouter(cfClients map[string]cf.IClient, timeNow func() time.Time) *htt
 		}
 	})
 
+	router.GET("/services", func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		templ, err := template.ParseFiles("templates/services.html")
+		if err != nil {
+			renderInternalServerError(w, err)
+			return
+		}
+
+		if err = templ.Execute(w, nil); err != nil {
+			log.Println(err.Error())
+			return
+		}
+	})
+
+	router.GET("/healthz", func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		renderJSON(w, Health{Status: "ok", Uptime: time.Since(started).Round(time.Second).String()})
+	})
+
+	router.GET("/readyz", func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		foundations := []string{}
+		for foundation := range cfClients {
+			foundations = append(foundations, foundation)
+		}
+		readiness := buildReadiness(telemetry, foundations, config.readyMaxAge(), timeNow())
+		if !crAppData.scraped() {
+			// without a background refresh nothing else may ever scrape
+			router.background(func(context.Context) {
+				if _, err := crAppData.scrape(timeNow); err != nil {
+					log.Println(err.Error())
+				}
+			})
+		}
+		renderJSONWithStatus(w, readinessStatus(readiness), readiness)
+	})
+
+	router.GET("/status", func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		templ, err := template.ParseFiles("templates/status.html")
+		if err != nil {
+			renderInternalServerError(w, err)
+			return
+		}
+
+		if err = templ.Execute(w, telemetry.Scrapes()); err != nil {
+			log.Println(err.Error())
+			return
+		}
+	})
+
+	router.GET("/listscrapes", func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		renderJSON(w, telemetry.Scrapes())
+	})
+
 	router.GET("/listapps", func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-		jAppData, err := crAppData.scrape(cfClients, timeNow)
+		appData, err := visibleAppData(r)
 		if err != nil {
 			renderInternalServerError(w, err)
 			return
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		w.Write(jAppData)
+		status := r.URL.Query().Get("status")
+		label := r.URL.Query().Get("label")
+		if status != "" || label != "" {
+			appData.Apps = applist.FilterByLabel(applist.FilterByStatus(appData.Apps, status), label)
+			appData.Summary = applist.BuildSummary(appData.Apps)
+		}
+
+		renderJSON(w, appData)
 	})
 
-	return router
-}
+	router.GET("/groups", func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		label := r.URL.Query().Get("label")
+		if label == "" {
+			renderBadRequest(w, errors.New("label is required"))
+			return
+		}
 
-func renderInternalServerError(w http.ResponseWriter, err error) {
-	w.WriteHeader(http.StatusInternalServerError)
-	w.Write([]byte(err.Error()))
-}
+		appData, err := visibleAppData(r)
+		if err != nil {
+			renderInternalServerError(w, err)
+			return
+		}
 
-func (crAppData *crAppData) scrape(cfClients map[string]cf.IClient, timeNow func() time.Time) ([]byte, error) {
-	now := timeNow()
-	if crAppData.lastFetched.Before(now.Add(-60*time.Second)) && !*crAppData.activelyScraping {
-		crAppData.activelyScraping = setPointerBool(true)
-		appData, err := applist.BuildAppData(cfClients, now)
+		renderJSON(w, applist.GroupByLabel(appData.Apps, label))
+	})
+
+	router.GET("/usage", func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		appData, err := visibleAppData(r)
+		if err != nil {
+			renderInternalServerError(w, err)
+			return
+		}
+
+		renderJSON(w, applist.BuildUsageReport(appData.Apps))
+	})
+
+	router.GET("/capacity", func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		appData, err := visibleAppData(r)
+		if err != nil {
+			renderInternalServerError(w, err)
+			return
+		}
+
+		if appData.Capacity == nil {
+			renderNotFound(w, errors.New("capacity is not being collected, set LOUPE_CAPACITY=true to enable it"))
+			return
+		}
+
+		renderJSON(w, appData.Capacity)
+	})
+
+	router.GET("/routes", func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		appData, err := visibleAppData(r)
+		if err != nil {
+			renderInternalServerError(w, err)
+			return
+		}
+
+		if appData.Routes == nil {
+			renderNotFound(w, errors.New("routes are not being collected, set LOUPE_ROUTES=true to enable them"))
+			return
+		}
+
+		renderJSON(w, appData.Routes)
+	})
+
+	router.GET("/listservices", func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		appData, err := visibleAppData(r)
+		if err != nil {
+			renderInternalServerError(w, err)
+			return
+		}
+
+		if appData.Services == nil {
+			renderNotFound(w, errors.New("services are not being collected, set LOUPE_SERVICES=true to enable them"))
+			return
+		}
+
+		renderJSON(w, appData.Services)
+	})
+
+	router.GET("/rightsizing", func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		threshold := config.RightSizingThreshold
+		if value := r.URL.Query().Get("threshold"); value != "" {
+			var err error
+			threshold, err = strconv.ParseFloat(value, 64)
+			if err != nil {
+				renderBadRequest(w, fmt.Errorf("threshold must be a number, got %q", value))
+				return
+			}
+		}
+
+		appData, err := visibleAppData(r)
 		if err != nil {
-			return nil, err
+			renderInternalServerError(w, err)
+			return
 		}
 
-		jAppData, err := json.Marshal(appData)
+		renderJSON(w, applist.BuildRightSizingReport(appData.Apps, threshold))
+	})
+
+	router.GET("/api/check", func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		query := applist.AppQuery{
+			Foundation: r.URL.Query().Get("foundation"),
+			Org:        r.URL.Query().Get("org"),
+			Space:      r.URL.Query().Get("space"),
+			App:        r.URL.Query().Get("app"),
+		}
+		if err := query.Validate(); err != nil {
+			renderBadRequest(w, err)
+			return
+		}
+
+		appData, err := visibleAppData(r)
 		if err != nil {
-			return nil, err
+			renderInternalServerError(w, err)
+			return
 		}
 
-		crAppData.marshalledAppData = &jAppData
-		crAppData.lastFetched = time.Now()
+		result := applist.CheckApp(appData.Apps, query)
+		status := checkStatus([]applist.CheckResult{result})
+		if !result.Found {
+			status = http.StatusNotFound
+		}
+		renderJSONWithStatus(w, status, result)
+	})
 
-		crAppData.activelyScraping = setPointerBool(false)
+	router.POST("/api/check", func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		var queries []applist.AppQuery
+		if err := json.NewDecoder(r.Body).Decode(&queries); err != nil {
+			renderBadRequest(w, fmt.Errorf("body must be a JSON list of apps: %s", err))
+			return
+		}
+		if len(queries) == 0 {
+			renderBadRequest(w, errors.New("body must list at least one app"))
+			return
+		}
+		for _, query := range queries {
+			if err := query.Validate(); err != nil {
+				renderBadRequest(w, err)
+				return
+			}
+		}
+
+		appData, err := visibleAppData(r)
+		if err != nil {
+			renderInternalServerError(w, err)
+			return
+		}
+
+		results := []applist.CheckResult{}
+		for _, query := range queries {
+			results = append(results, applist.CheckApp(appData.Apps, query))
+		}
+		renderJSONWithStatus(w, checkStatus(results), results)
+	})
+
+	return router
+}
+
+func renderJSON(w http.ResponseWriter, data interface{}) {
+	renderJSONWithStatus(w, http.StatusOK, data)
+}
+
+func renderJSONWithStatus(w http.ResponseWriter, status int, data interface{}) {
+	jData, err := json.Marshal(data)
+	if err != nil {
+		renderInternalServerError(w, err)
+		return
 	}
 
-	ticker := time.NewTicker(1 * time.Second)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(jData)
+}
 
-	for range ticker.C {
-		if !*crAppData.activelyScraping {
-			break
+// checkStatus is 200 OK if every app passed its check and 412 Precondition Failed otherwise
+func checkStatus(results []applist.CheckResult) int {
+	for _, result := range results {
+		if !result.Pass {
+			return http.StatusPreconditionFailed
 		}
 	}
+	return http.StatusOK
+}
 
-	return *crAppData.marshalledAppData, nil
+func renderNotFound(w http.ResponseWriter, err error) {
+	w.WriteHeader(http.StatusNotFound)
+	w.Write([]byte(err.Error()))
 }
 
-func setPointerBool(b bool) *bool {
-	return &b
+func renderBadRequest(w http.ResponseWriter, err error) {
+	w.WriteHeader(http.StatusBadRequest)
+	w.Write([]byte(err.Error()))
+}
+
+func renderInternalServerError(w http.ResponseWriter, err error) {
+	w.WriteHeader(http.StatusInternalServerError)
+	w.Write([]byte(err.Error()))
+}
+
+// scraped returns true once a scrape has succeeded
+func (crAppData *crAppData) scraped() bool {
+	crAppData.mutex.Lock()
+	defer crAppData.mutex.Unlock()
+	return crAppData.appData != nil
+}
+
+// scrape returns the cached app data, scraping again if it is over a minute
+// old. Requests arriving while a scrape runs wait for it and share its result.
+func (crAppData *crAppData) scrape(timeNow func() time.Time) (applist.AppData, error) {
+	now := timeNow()
+
+	crAppData.mutex.Lock()
+	if crAppData.appData != nil && !crAppData.lastFetched.Before(now.Add(-60*time.Second)) {
+		appData := *crAppData.appData
+		crAppData.mutex.Unlock()
+		return appData, nil
+	}
+	if call := crAppData.inFlight; call != nil {
+		crAppData.mutex.Unlock()
+		<-call.done
+		return call.appData, call.err
+	}
+	call := &scrapeCall{done: make(chan struct{})}
+	crAppData.inFlight = call
+	crAppData.mutex.Unlock()
+
+	// the snapshot is dated by timeNow, as /readyz ages it, but timed by the
+	// wall clock
+	start := time.Now()
+	call.appData, call.err = crAppData.build(now)
+	crAppData.telemetry.Finish(now, time.Since(start), call.err)
+	for _, observe := range crAppData.observers {
+		observe(call.appData, call.err)
+	}
+	if call.err != nil {
+		call.appData = applist.AppData{}
+	}
+
+	crAppData.mutex.Lock()
+	if call.err == nil {
+		crAppData.appData = &call.appData
+		crAppData.lastFetched = now
+	}
+	crAppData.inFlight = nil
+	crAppData.mutex.Unlock()
+	close(call.done)
+
+	return call.appData, call.err
 }
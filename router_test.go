@@ -1,6 +1,7 @@
 package main_test
 
 import (
+	"bufio"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -8,6 +9,10 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	xmlpath "gopkg.in/xmlpath.v2"
@@ -16,8 +21,10 @@ import (
 
 	. "github.com/FidelityInternational/cf-loupe"
 	"github.com/FidelityInternational/cf-loupe/applist"
+	"github.com/FidelityInternational/cf-loupe/auth"
 	"github.com/FidelityInternational/cf-loupe/cf"
 	"github.com/FidelityInternational/cf-loupe/helpers"
+	"github.com/FidelityInternational/cf-loupe/notify"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -29,6 +36,28 @@ type FakeClient struct {
 	GetBuildpacksFunc func() (map[string]gocf.Buildpack, error)
 	GetOrgsFunc       func() (map[string]gocf.Org, error)
 	GetSpacesFunc     func() (map[string]gocf.Space, error)
+
+	GetOrgQuotasFunc   func() (map[string]gocf.OrgQuota, error)
+	GetSpaceQuotasFunc func() (map[string]gocf.SpaceQuota, error)
+
+	GetAppInstancesFunc func(appGUID string) (map[string]gocf.AppInstance, error)
+	GetAppStatsFunc     func(appGUID string) (map[string]gocf.AppStats, error)
+	GetRoutesFunc       func() (map[string]gocf.Route, error)
+	GetDomainsFunc      func() (map[string]gocf.Domain, error)
+	GetAppRoutesFunc    func(appGUID string) ([]gocf.Route, error)
+
+	GetServiceInstancesFunc             func() (map[string]gocf.ServiceInstance, error)
+	GetUserProvidedServiceInstancesFunc func() (map[string]gocf.UserProvidedServiceInstance, error)
+	GetServiceBindingsFunc              func() (map[string]gocf.ServiceBinding, error)
+	GetServicesFunc                     func() (map[string]gocf.Service, error)
+	GetServicePlansFunc                 func() (map[string]gocf.ServicePlan, error)
+
+	GetAppMetadataFunc   func() (map[string]cf.Metadata, error)
+	GetSpaceMetadataFunc func() (map[string]cf.Metadata, error)
+	GetOrgMetadataFunc   func() (map[string]cf.Metadata, error)
+
+	GetUserSpacesFunc func(userGUID string) (map[string]gocf.Space, error)
+	GetUserOrgsFunc   func(userGUID string) (map[string]gocf.Org, error)
 }
 
 func (client FakeClient) ReAuth() error {
@@ -51,24 +80,107 @@ func (client FakeClient) GetSpaces() (map[string]gocf.Space, error) {
 	return client.GetSpacesFunc()
 }
 
+func (client FakeClient) GetOrgQuotas() (map[string]gocf.OrgQuota, error) {
+	return client.GetOrgQuotasFunc()
+}
+
+func (client FakeClient) GetSpaceQuotas() (map[string]gocf.SpaceQuota, error) {
+	return client.GetSpaceQuotasFunc()
+}
+
+func (client FakeClient) GetAppInstances(appGUID string) (map[string]gocf.AppInstance, error) {
+	return client.GetAppInstancesFunc(appGUID)
+}
+
+func (client FakeClient) GetAppStats(appGUID string) (map[string]gocf.AppStats, error) {
+	return client.GetAppStatsFunc(appGUID)
+}
+
+func (client FakeClient) GetRoutes() (map[string]gocf.Route, error) {
+	return client.GetRoutesFunc()
+}
+
+func (client FakeClient) GetDomains() (map[string]gocf.Domain, error) {
+	return client.GetDomainsFunc()
+}
+
+func (client FakeClient) GetAppRoutes(appGUID string) ([]gocf.Route, error) {
+	return client.GetAppRoutesFunc(appGUID)
+}
+
+func (client FakeClient) GetServiceInstances() (map[string]gocf.ServiceInstance, error) {
+	return client.GetServiceInstancesFunc()
+}
+
+func (client FakeClient) GetUserProvidedServiceInstances() (map[string]gocf.UserProvidedServiceInstance, error) {
+	return client.GetUserProvidedServiceInstancesFunc()
+}
+
+func (client FakeClient) GetServiceBindings() (map[string]gocf.ServiceBinding, error) {
+	return client.GetServiceBindingsFunc()
+}
+
+func (client FakeClient) GetServices() (map[string]gocf.Service, error) {
+	return client.GetServicesFunc()
+}
+
+func (client FakeClient) GetServicePlans() (map[string]gocf.ServicePlan, error) {
+	return client.GetServicePlansFunc()
+}
+
+func (client FakeClient) GetAppMetadata() (map[string]cf.Metadata, error) {
+	return client.GetAppMetadataFunc()
+}
+
+func (client FakeClient) GetSpaceMetadata() (map[string]cf.Metadata, error) {
+	return client.GetSpaceMetadataFunc()
+}
+
+func (client FakeClient) GetOrgMetadata() (map[string]cf.Metadata, error) {
+	return client.GetOrgMetadataFunc()
+}
+
+func (client FakeClient) GetUserSpaces(userGUID string) (map[string]gocf.Space, error) {
+	return client.GetUserSpacesFunc(userGUID)
+}
+
+func (client FakeClient) GetUserOrgs(userGUID string) (map[string]gocf.Org, error) {
+	return client.GetUserOrgsFunc(userGUID)
+}
+
 var _ = Describe("Main", func() {
 	var server *httptest.Server
-	var cfClient FakeClient
+	// servers are closed after each test
+	var servers []*httptest.Server
+	// routers are stopped after each test, once their servers are closed
+	var routers []*Router
+	var cfClient *FakeClient
 	var realCfClient cf.IClient
 	var fakeEnv []string
 	var fakeApi *helpers.FakeApi
 
-	BeforeEach(func() {
-		timeNow := func() time.Time {
-			t, _ := time.Parse(time.RFC3339, "2017-08-15T15:00:06Z")
-			return t
-		}
-
-		cfClients := map[string]cf.IClient{
-			"dev": &cfClient,
-		}
+	timeNow := func() time.Time {
+		t, _ := time.Parse(time.RFC3339, "2017-08-15T15:00:06Z")
+		return t
+	}
+
+	// newRouter builds the router of the dev foundation with a config
+	newRouter := func(timeNow func() time.Time, config Config) *Router {
+		router := BuildRouter(map[string]cf.IClient{"dev": cfClient}, timeNow, config)
+		routers = append(routers, router)
+		return router
+	}
+
+	// newServer serves the dashboard of the dev foundation with a config
+	newServer := func(config Config) *httptest.Server {
+		started := httptest.NewServer(newRouter(timeNow, config))
+		servers = append(servers, started)
+		return started
+	}
 
-		server = httptest.NewServer(BuildRouter(cfClients, timeNow))
+	BeforeEach(func() {
+		cfClient = &FakeClient{}
+		server = newServer(Config{})
 
 		fakeApi = helpers.NewFakeApi()
 		fakeEnv = []string{
@@ -88,6 +200,7 @@ var _ = Describe("Main", func() {
 		cfClient.ListAppsFunc = func() ([]gocf.App, error) {
 			return []gocf.App{
 				gocf.App{
+					Guid:                  "app1-guid",
 					Name:                  "app1",
 					UpdatedAt:             "2017-08-12T16:41:45Z",
 					DetectedBuildpackGuid: "hij789",
@@ -97,6 +210,7 @@ var _ = Describe("Main", func() {
 					State:                 "started",
 				},
 				gocf.App{
+					Guid:                  "app2-guid",
 					Name:                  "app2",
 					UpdatedAt:             "2016-07-19T16:41:45Z",
 					DetectedBuildpackGuid: "def456",
@@ -106,6 +220,7 @@ var _ = Describe("Main", func() {
 					State:                 "stopped",
 				},
 				gocf.App{
+					Guid:                  "app3-guid",
 					Name:                  "app3",
 					UpdatedAt:             "2016-07-28T16:41:45Z",
 					DetectedBuildpackGuid: "",
@@ -146,7 +261,8 @@ var _ = Describe("Main", func() {
 		cfClient.GetOrgsFunc = func() (map[string]gocf.Org, error) {
 			return map[string]gocf.Org{
 				"123123123": gocf.Org{
-					Name: "project-x",
+					Name:                "project-x",
+					QuotaDefinitionGuid: "quota-1",
 				},
 			}, nil
 		}
@@ -163,6 +279,19 @@ var _ = Describe("Main", func() {
 				},
 			}, nil
 		}
+
+		cfClient.GetOrgQuotasFunc = func() (map[string]gocf.OrgQuota, error) {
+			return map[string]gocf.OrgQuota{
+				"quota-1": gocf.OrgQuota{
+					Name:        "default",
+					MemoryLimit: 10240,
+				},
+			}, nil
+		}
+
+		cfClient.GetSpaceQuotasFunc = func() (map[string]gocf.SpaceQuota, error) {
+			return map[string]gocf.SpaceQuota{}, nil
+		}
 	})
 
 	Describe("GET /", func() {
@@ -335,6 +464,37 @@ var _ = Describe("Main", func() {
 			})
 		})
 
+		Context("When requests arrive while the first scrape is failing", func() {
+			var scrapes int32
+
+			BeforeEach(func() {
+				scrapes = 0
+				cfClient.ListAppsFunc = func() ([]gocf.App, error) {
+					atomic.AddInt32(&scrapes, 1)
+					time.Sleep(200 * time.Millisecond)
+					return nil, errors.New("The server is on fire!")
+				}
+			})
+
+			It("makes them all wait for the same scrape and returns its error", func() {
+				statuses := make(chan int, 5)
+				for i := 0; i < 5; i++ {
+					go func() {
+						defer GinkgoRecover()
+						resp, err := http.Get(url.String())
+						Expect(err).To(Succeed())
+						resp.Body.Close()
+						statuses <- resp.StatusCode
+					}()
+				}
+
+				for i := 0; i < 5; i++ {
+					Eventually(statuses).Should(Receive(Equal(http.StatusInternalServerError)))
+				}
+				Expect(atomic.LoadInt32(&scrapes)).To(Equal(int32(1)))
+			})
+		})
+
 		Context("When the endpoint works", func() {
 			It("returns 200 OK", func() {
 				resp, err := http.Get(url.String())
@@ -386,6 +546,83 @@ var _ = Describe("Main", func() {
 			})
 		})
 
+		Context("When filtering by status", func() {
+			It("returns only the apps with that status", func() {
+				url.RawQuery = "status=crashed"
+				resp, err := http.Get(url.String())
+				Expect(err).To(Succeed())
+
+				bytes, err := ioutil.ReadAll(resp.Body)
+				Expect(err).To(Succeed())
+				defer resp.Body.Close()
+
+				var appData applist.AppData
+				err = json.Unmarshal(bytes, &appData)
+				Expect(err).To(Succeed())
+
+				Expect(appData.Apps).To(BeEmpty())
+				Expect(appData.Summary.TotalApps).To(Equal(0))
+			})
+
+			It("returns the summary of the filtered apps", func() {
+				url.RawQuery = "status=staged"
+				resp, err := http.Get(url.String())
+				Expect(err).To(Succeed())
+
+				bytes, err := ioutil.ReadAll(resp.Body)
+				Expect(err).To(Succeed())
+				defer resp.Body.Close()
+
+				var appData applist.AppData
+				err = json.Unmarshal(bytes, &appData)
+				Expect(err).To(Succeed())
+
+				Expect(appData.Apps).To(HaveLen(3))
+				Expect(appData.Summary.TotalApps).To(Equal(3))
+				Expect(appData.Summary.StaleApps).To(Equal(2))
+			})
+		})
+
+		Context("When instance health is enabled", func() {
+			var healthServer *httptest.Server
+
+			BeforeEach(func() {
+				healthServer = newServer(Config{AppList: applist.Options{InstanceHealth: true, InstanceWorkers: 2}})
+
+				cfClient.GetAppInstancesFunc = func(appGUID string) (map[string]gocf.AppInstance, error) {
+					switch appGUID {
+					case "app1-guid":
+						return map[string]gocf.AppInstance{"0": {State: "RUNNING"}}, nil
+					case "app3-guid":
+						return map[string]gocf.AppInstance{
+							"0": {State: "RUNNING"},
+							"1": {State: "CRASHED"},
+							"2": {State: "STARTING"},
+						}, nil
+					}
+					return nil, errors.New("instances unavailable")
+				}
+			})
+
+			It("reports the running, crashed and starting instances of started apps", func() {
+				resp, err := http.Get(healthServer.URL + "/listapps")
+				Expect(err).To(Succeed())
+
+				bytes, err := ioutil.ReadAll(resp.Body)
+				Expect(err).To(Succeed())
+				defer resp.Body.Close()
+
+				var appData applist.AppData
+				err = json.Unmarshal(bytes, &appData)
+				Expect(err).To(Succeed())
+
+				Expect(appData.Apps[0].Health).To(Equal(&applist.InstanceHealth{Running: 1, IsDegraded: false}))
+				Expect(appData.Apps[1].Health).To(BeNil())
+				Expect(appData.Apps[2].Health).To(Equal(&applist.InstanceHealth{Running: 1, Crashed: 1, Starting: 1, IsDegraded: true}))
+				Expect(appData.Summary.DegradedApps).To(Equal(1))
+			})
+		})
+
 		Context("When the auth token expires", func() {
 
 			BeforeEach(func() {
@@ -419,7 +656,807 @@ var _ = Describe("Main", func() {
 		})
 	})
 
+	Describe("GET /capacity", func() {
+		Context("When capacity is not being collected", func() {
+			It("returns 404 Not Found", func() {
+				resp, err := http.Get(server.URL + "/capacity")
+				Expect(err).To(Succeed())
+				Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+			})
+		})
+
+		It("returns the memory allocated to each org and space against its quota", func() {
+			resp, err := http.Get(newServer(Config{AppList: applist.Options{Capacity: true}}).URL + "/capacity")
+			Expect(err).To(Succeed())
+
+			bytes, err := ioutil.ReadAll(resp.Body)
+			Expect(err).To(Succeed())
+			defer resp.Body.Close()
+
+			var capacity applist.CapacityReport
+			err = json.Unmarshal(bytes, &capacity)
+			Expect(err).To(Succeed())
+
+			Expect(capacity.Orgs).To(HaveLen(1))
+			Expect(capacity.Orgs[0].Org).To(Equal("project-x"))
+			Expect(capacity.Orgs[0].Quota).To(Equal("default"))
+			Expect(capacity.Orgs[0].AllocatedMemoryMB).To(Equal(6208))
+			Expect(capacity.Orgs[0].MemoryLimitMB).To(Equal(10240))
+			Expect(capacity.Orgs[0].IsNearLimit).To(BeFalse())
+
+			Expect(capacity.Spaces).To(HaveLen(2))
+			Expect(capacity.Spaces[0].Space).To(Equal("dev"))
+			Expect(capacity.Spaces[0].AllocatedMemoryMB).To(Equal(64))
+			Expect(capacity.Spaces[0].MemoryLimitMB).To(Equal(applist.Unlimited))
+		})
+
+		It("keeps the capacity report when /listapps is filtered", func() {
+			resp, err := http.Get(newServer(Config{AppList: applist.Options{Capacity: true}}).URL + "/listapps?status=staged")
+			Expect(err).To(Succeed())
+
+			bytes, err := ioutil.ReadAll(resp.Body)
+			Expect(err).To(Succeed())
+			defer resp.Body.Close()
+
+			var appData applist.AppData
+			err = json.Unmarshal(bytes, &appData)
+			Expect(err).To(Succeed())
+
+			Expect(appData.Apps).To(HaveLen(3))
+			Expect(appData.Capacity).NotTo(BeNil())
+			Expect(appData.Capacity.Orgs).To(HaveLen(1))
+		})
+	})
+
+	Describe("GET /routes", func() {
+		Context("When routes are not being collected", func() {
+			It("returns 404 Not Found", func() {
+				resp, err := http.Get(server.URL + "/routes")
+				Expect(err).To(Succeed())
+				Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+			})
+		})
+
+		Context("When routes are being collected", func() {
+			var routesServer *httptest.Server
+
+			BeforeEach(func() {
+				routesServer = newServer(Config{AppList: applist.Options{Routes: true}})
+
+				cfClient.GetRoutesFunc = func() (map[string]gocf.Route, error) {
+					return map[string]gocf.Route{
+						"route1": {Guid: "route1", Host: "app1", DomainGuid: "domain1", SpaceGuid: "aaaaa"},
+						"route2": {Guid: "route2", Host: "old", DomainGuid: "domain1", SpaceGuid: "bbbbb"},
+					}, nil
+				}
+				cfClient.GetDomainsFunc = func() (map[string]gocf.Domain, error) {
+					return map[string]gocf.Domain{
+						"domain1": {Guid: "domain1", Name: "apps.example.com"},
+					}, nil
+				}
+				cfClient.GetAppRoutesFunc = func(appGUID string) ([]gocf.Route, error) {
+					if appGUID == "app1-guid" {
+						return []gocf.Route{{Guid: "route1", Host: "app1", DomainGuid: "domain1"}}, nil
+					}
+					return []gocf.Route{}, nil
+				}
+			})
+
+			It("returns the orphaned routes and unrouted apps", func() {
+				resp, err := http.Get(routesServer.URL + "/routes")
+				Expect(err).To(Succeed())
+
+				bytes, err := ioutil.ReadAll(resp.Body)
+				Expect(err).To(Succeed())
+				defer resp.Body.Close()
+
+				var routes applist.RouteReport
+				err = json.Unmarshal(bytes, &routes)
+				Expect(err).To(Succeed())
+
+				Expect(routes.OrphanedRoutes).To(HaveLen(1))
+				Expect(routes.OrphanedRoutes[0].URL).To(Equal("old.apps.example.com"))
+				Expect(routes.OrphanedRoutes[0].Space).To(Equal("test"))
+				Expect(routes.UnroutedApps).To(HaveLen(2))
+				Expect(routes.UnroutedApps[0].Name).To(Equal("app2"))
+				Expect(routes.UnroutedApps[1].Name).To(Equal("app3"))
+			})
+		})
+	})
+
+	Describe("GET /events", func() {
+		It("streams a notification after each scrape", func() {
+			resp, err := http.Get(server.URL + "/events")
+			Expect(err).To(Succeed())
+			defer resp.Body.Close()
+			Expect(resp.Header.Get("Content-Type")).To(Equal("text/event-stream"))
+
+			_, err = http.Get(server.URL + "/listapps")
+			Expect(err).To(Succeed())
+
+			reader := bufio.NewReader(resp.Body)
+			line, err := reader.ReadString('\n')
+			Expect(err).To(Succeed())
+			Expect(line).To(Equal("event: snapshot\n"))
+
+			line, err = reader.ReadString('\n')
+			Expect(err).To(Succeed())
+			Expect(line).To(HavePrefix("data: "))
+
+			var notification struct {
+				SnapshotID  int
+				Summary     applist.Summary
+				ChangedApps []string
+			}
+			err = json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &notification)
+			Expect(err).To(Succeed())
+			Expect(notification.SnapshotID).To(Equal(1))
+			Expect(notification.Summary.TotalApps).To(Equal(3))
+			Expect(notification.ChangedApps).To(BeEmpty())
+		})
+	})
+
+	Describe("GET /services", func() {
+		It("returns 200 as it is a static page", func() {
+			resp, err := http.Get(server.URL + "/services")
+			Expect(err).To(Succeed())
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		})
+	})
+
+	Describe("GET /healthz", func() {
+		It("returns 200 without scraping", func() {
+			cfClient.ListAppsFunc = func() ([]gocf.App, error) {
+				return nil, errors.New("The server is on fire!")
+			}
+
+			resp, err := http.Get(server.URL + "/healthz")
+			Expect(err).To(Succeed())
+			defer resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+			var health Health
+			Expect(json.NewDecoder(resp.Body).Decode(&health)).To(Succeed())
+			Expect(health.Status).To(Equal("ok"))
+		})
+	})
+
+	Describe("GET /readyz", func() {
+		getReadiness := func() (int, Readiness) {
+			resp, err := http.Get(server.URL + "/readyz")
+			Expect(err).To(Succeed())
+			defer resp.Body.Close()
+
+			var readiness Readiness
+			Expect(json.NewDecoder(resp.Body).Decode(&readiness)).To(Succeed())
+			return resp.StatusCode, readiness
+		}
+
+		It("is not ready before a scrape has succeeded", func() {
+			status, readiness := getReadiness()
+			Expect(status).To(Equal(http.StatusServiceUnavailable))
+			Expect(readiness.Ready).To(BeFalse())
+			Expect(readiness.Reason).To(Equal("no scrape has succeeded yet"))
+			Expect(readiness.Foundations).To(Equal([]FoundationReadiness{{Foundation: "dev"}}))
+		})
+
+		It("starts a scrape when none has succeeded, so it becomes ready without other requests", func() {
+			status, _ := getReadiness()
+			Expect(status).To(Equal(http.StatusServiceUnavailable))
+
+			Eventually(func() int {
+				status, _ := getReadiness()
+				return status
+			}).Should(Equal(http.StatusOK))
+		})
+
+		It("is ready once a scrape has succeeded", func() {
+			_, err := http.Get(server.URL + "/listapps")
+			Expect(err).To(Succeed())
+
+			status, readiness := getReadiness()
+			Expect(status).To(Equal(http.StatusOK))
+			Expect(readiness.Ready).To(BeTrue())
+			Expect(readiness.LastSnapshot).NotTo(BeNil())
+			Expect(readiness.MaxSnapshotAge).To(BeEmpty())
+			Expect(readiness.Foundations).To(Equal([]FoundationReadiness{{Foundation: "dev", Scraped: true, Authenticated: true}}))
+		})
+
+		Context("When the last successful scrape is too old", func() {
+			// elapsed is how far the clock of the router has moved, in minutes
+			var elapsed int64
+
+			BeforeEach(func() {
+				atomic.StoreInt64(&elapsed, 0)
+				movingTimeNow := func() time.Time {
+					return timeNow().Add(time.Duration(atomic.LoadInt64(&elapsed)) * time.Minute)
+				}
+				server = httptest.NewServer(newRouter(movingTimeNow, Config{ReadyMaxAge: time.Minute}))
+				servers = append(servers, server)
+			})
+
+			It("is not ready", func() {
+				_, err := http.Get(server.URL + "/listapps")
+				Expect(err).To(Succeed())
+				status, _ := getReadiness()
+				Expect(status).To(Equal(http.StatusOK))
+
+				atomic.StoreInt64(&elapsed, 2)
+				status, readiness := getReadiness()
+				Expect(status).To(Equal(http.StatusServiceUnavailable))
+				Expect(readiness.Reason).To(Equal("the last successful scrape is older than 1m0s"))
+				Expect(readiness.SnapshotAge).To(Equal("2m0s"))
+				Expect(readiness.MaxSnapshotAge).To(Equal("1m0s"))
+			})
+		})
+
+		Context("When a foundation can't be scraped", func() {
+			BeforeEach(func() {
+				cfClient.ListAppsFunc = func() ([]gocf.App, error) {
+					return nil, errors.New("The server is on fire!")
+				}
+			})
+
+			It("is not ready and says which foundation failed, without its error", func() {
+				_, err := http.Get(server.URL + "/listapps")
+				Expect(err).To(Succeed())
+
+				resp, err := http.Get(server.URL + "/readyz")
+				Expect(err).To(Succeed())
+				body, err := ioutil.ReadAll(resp.Body)
+				resp.Body.Close()
+				Expect(err).To(Succeed())
+				Expect(string(body)).NotTo(ContainSubstring("on fire"))
+
+				status, readiness := getReadiness()
+				Expect(status).To(Equal(http.StatusServiceUnavailable))
+				Expect(readiness.Foundations).To(Equal([]FoundationReadiness{
+					{Foundation: "dev", Scraped: true, Authenticated: true},
+				}))
+			})
+		})
+	})
+
+	Describe("GET /status", func() {
+		It("returns 200 before anything has been scraped", func() {
+			resp, err := http.Get(server.URL + "/status")
+			Expect(err).To(Succeed())
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		})
+
+		It("shows the last scrapes", func() {
+			_, err := http.Get(server.URL + "/listapps")
+			Expect(err).To(Succeed())
+
+			resp, err := http.Get(server.URL + "/status")
+			Expect(err).To(Succeed())
+			defer resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+			body, err := ioutil.ReadAll(resp.Body)
+			Expect(err).To(Succeed())
+			Expect(string(body)).To(ContainSubstring("<td>dev</td>"))
+		})
+	})
+
+	Describe("GET /listscrapes", func() {
+		It("returns no scrapes before anything has been scraped", func() {
+			resp, err := http.Get(server.URL + "/listscrapes")
+			Expect(err).To(Succeed())
+			defer resp.Body.Close()
+
+			var scrapes []applist.Scrape
+			Expect(json.NewDecoder(resp.Body).Decode(&scrapes)).To(Succeed())
+			Expect(scrapes).To(BeEmpty())
+		})
+
+		It("returns how each foundation was scraped, the latest scrape first", func() {
+			_, err := http.Get(server.URL + "/listapps")
+			Expect(err).To(Succeed())
+
+			resp, err := http.Get(server.URL + "/listscrapes")
+			Expect(err).To(Succeed())
+			defer resp.Body.Close()
+
+			var scrapes []applist.Scrape
+			Expect(json.NewDecoder(resp.Body).Decode(&scrapes)).To(Succeed())
+			Expect(scrapes).To(HaveLen(1))
+			Expect(scrapes[0].Error).To(BeEmpty())
+			Expect(scrapes[0].Foundations).To(HaveLen(1))
+			Expect(scrapes[0].Foundations[0].Foundation).To(Equal("dev"))
+			Expect(scrapes[0].Foundations[0].Authenticated).To(BeTrue())
+		})
+
+		Context("When a scrape fails", func() {
+			BeforeEach(func() {
+				cfClient.ListAppsFunc = func() ([]gocf.App, error) {
+					return nil, errors.New("The server is on fire!")
+				}
+			})
+
+			It("returns the error of the foundation that failed", func() {
+				_, err := http.Get(server.URL + "/listapps")
+				Expect(err).To(Succeed())
+
+				resp, err := http.Get(server.URL + "/listscrapes")
+				Expect(err).To(Succeed())
+				defer resp.Body.Close()
+
+				var scrapes []applist.Scrape
+				Expect(json.NewDecoder(resp.Body).Decode(&scrapes)).To(Succeed())
+				Expect(scrapes[0].Error).To(Equal("could not scrape dev: The server is on fire!"))
+				Expect(scrapes[0].Foundations[0].Error).To(Equal("The server is on fire!"))
+			})
+		})
+	})
+
+	Describe("GET /listservices", func() {
+		Context("When services are not being collected", func() {
+			It("returns 404 Not Found", func() {
+				resp, err := http.Get(server.URL + "/listservices")
+				Expect(err).To(Succeed())
+				Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+			})
+		})
+
+		Context("When services are being collected", func() {
+			var servicesServer *httptest.Server
+
+			BeforeEach(func() {
+				servicesServer = newServer(Config{AppList: applist.Options{Services: true}})
+
+				cfClient.GetServiceInstancesFunc = func() (map[string]gocf.ServiceInstance, error) {
+					return map[string]gocf.ServiceInstance{
+						"db1": {Name: "orders-db", ServicePlanGuid: "small", SpaceGuid: "aaaaa"},
+					}, nil
+				}
+				cfClient.GetUserProvidedServiceInstancesFunc = func() (map[string]gocf.UserProvidedServiceInstance, error) {
+					return map[string]gocf.UserProvidedServiceInstance{}, nil
+				}
+				cfClient.GetServiceBindingsFunc = func() (map[string]gocf.ServiceBinding, error) {
+					return map[string]gocf.ServiceBinding{}, nil
+				}
+				cfClient.GetServicesFunc = func() (map[string]gocf.Service, error) {
+					return map[string]gocf.Service{"mysql": {Label: "p-mysql", Active: true}}, nil
+				}
+				cfClient.GetServicePlansFunc = func() (map[string]gocf.ServicePlan, error) {
+					return map[string]gocf.ServicePlan{"small": {Name: "small", ServiceGuid: "mysql", Active: true}}, nil
+				}
+			})
+
+			It("returns the service plans and unbound service instances", func() {
+				resp, err := http.Get(servicesServer.URL + "/listservices")
+				Expect(err).To(Succeed())
+
+				bytes, err := ioutil.ReadAll(resp.Body)
+				Expect(err).To(Succeed())
+				defer resp.Body.Close()
+
+				var services applist.ServicesReport
+				err = json.Unmarshal(bytes, &services)
+				Expect(err).To(Succeed())
+
+				Expect(services.Plans).To(HaveLen(1))
+				Expect(services.Plans[0].Service).To(Equal("p-mysql"))
+				Expect(services.Plans[0].Instances).To(Equal(1))
+				Expect(services.UnboundInstances).To(HaveLen(1))
+				Expect(services.UnboundInstances[0].Name).To(Equal("orders-db"))
+				Expect(services.UnboundInstances[0].Org).To(Equal("project-x"))
+			})
+		})
+	})
+
+	Describe("Label filtering and grouping", func() {
+		var metadataServer *httptest.Server
+
+		BeforeEach(func() {
+			metadataServer = newServer(Config{AppList: applist.Options{Metadata: true}})
+
+			cfClient.GetAppMetadataFunc = func() (map[string]cf.Metadata, error) {
+				return map[string]cf.Metadata{
+					"app1-guid": {Labels: map[string]string{"team": "orders"}},
+				}, nil
+			}
+			cfClient.GetSpaceMetadataFunc = func() (map[string]cf.Metadata, error) {
+				return map[string]cf.Metadata{
+					"aaaaa": {Labels: map[string]string{"team": "payments"}},
+				}, nil
+			}
+			cfClient.GetOrgMetadataFunc = func() (map[string]cf.Metadata, error) {
+				return map[string]cf.Metadata{}, nil
+			}
+		})
+
+		It("filters apps by label", func() {
+			resp, err := http.Get(metadataServer.URL + "/listapps?label=team=payments")
+			Expect(err).To(Succeed())
+
+			bytes, err := ioutil.ReadAll(resp.Body)
+			Expect(err).To(Succeed())
+			defer resp.Body.Close()
+
+			var appData applist.AppData
+			err = json.Unmarshal(bytes, &appData)
+			Expect(err).To(Succeed())
+
+			Expect(appData.Apps).To(HaveLen(1))
+			Expect(appData.Apps[0].Name).To(Equal("app2"))
+			Expect(appData.Apps[0].Owner).To(Equal("payments"))
+		})
+
+		It("groups apps by label", func() {
+			resp, err := http.Get(metadataServer.URL + "/groups?label=team")
+			Expect(err).To(Succeed())
+
+			bytes, err := ioutil.ReadAll(resp.Body)
+			Expect(err).To(Succeed())
+			defer resp.Body.Close()
+
+			var groups []applist.LabelGroup
+			err = json.Unmarshal(bytes, &groups)
+			Expect(err).To(Succeed())
+
+			Expect(groups).To(HaveLen(3))
+			Expect(groups[0].Value).To(Equal(""))
+			Expect(groups[0].Summary.UnownedApps).To(Equal(1))
+			Expect(groups[1].Value).To(Equal("orders"))
+			Expect(groups[2].Value).To(Equal("payments"))
+			Expect(groups[2].Summary.TotalApps).To(Equal(1))
+		})
+
+		It("requires a label to group by", func() {
+			resp, err := http.Get(metadataServer.URL + "/groups")
+			Expect(err).To(Succeed())
+			Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+		})
+	})
+
+	Describe("Digests", func() {
+		var dryRunDir string
+
+		BeforeEach(func() {
+			var err error
+			dryRunDir, err = ioutil.TempDir("", "digests")
+			Expect(err).To(Succeed())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dryRunDir)
+		})
+
+		It("are built from the cached apps instead of scraping again", func() {
+			var scrapes int32
+			listApps := cfClient.ListAppsFunc
+			cfClient.ListAppsFunc = func() ([]gocf.App, error) {
+				atomic.AddInt32(&scrapes, 1)
+				return listApps()
+			}
+			digestServer := newServer(Config{Digest: notify.Options{
+				Interval:   20 * time.Millisecond,
+				From:       "loupe@example.com",
+				Recipients: notify.Recipients{Default: "platform@example.com"},
+				DryRunDir:  dryRunDir,
+			}})
+
+			_, err := http.Get(digestServer.URL + "/listapps")
+			Expect(err).To(Succeed())
+
+			Eventually(func() error {
+				_, err := os.Stat(filepath.Join(dryRunDir, "platform@example.com.eml"))
+				return err
+			}).Should(Succeed())
+			Expect(atomic.LoadInt32(&scrapes)).To(Equal(int32(1)))
+		})
+
+		It("are not sent by secondary instances", func() {
+			digestServer := newServer(Config{SecondaryInstance: true, Digest: notify.Options{
+				Interval:   20 * time.Millisecond,
+				From:       "loupe@example.com",
+				Recipients: notify.Recipients{Default: "platform@example.com"},
+				DryRunDir:  dryRunDir,
+			}})
+
+			_, err := http.Get(digestServer.URL + "/listapps")
+			Expect(err).To(Succeed())
+
+			Consistently(func() ([]os.FileInfo, error) {
+				return ioutil.ReadDir(dryRunDir)
+			}, 100*time.Millisecond).Should(BeEmpty())
+		})
+	})
+
+	Describe("GET /rightsizing", func() {
+		var usageServer *httptest.Server
+
+		BeforeEach(func() {
+			config := Config{
+				AppList:              applist.Options{ResourceUsage: true},
+				RightSizingThreshold: 25,
+			}
+			usageServer = newServer(config)
+
+			cfClient.GetAppStatsFunc = func(appGUID string) (map[string]gocf.AppStats, error) {
+				var stats gocf.AppStats
+				stats.Stats.MemQuota = 1000
+				stats.Stats.Usage.Mem = 100
+				if appGUID == "app3-guid" {
+					stats.Stats.Usage.Mem = 500
+				}
+				return map[string]gocf.AppStats{"0": stats}, nil
+			}
+		})
+
+		It("lists the apps using less than the configured threshold of their memory quota", func() {
+			resp, err := http.Get(usageServer.URL + "/rightsizing")
+			Expect(err).To(Succeed())
+
+			bytes, err := ioutil.ReadAll(resp.Body)
+			Expect(err).To(Succeed())
+			defer resp.Body.Close()
+
+			var candidates []applist.RightSizingCandidate
+			err = json.Unmarshal(bytes, &candidates)
+			Expect(err).To(Succeed())
+
+			Expect(candidates).To(HaveLen(1))
+			Expect(candidates[0].Name).To(Equal("app1"))
+			Expect(candidates[0].MemoryPercent).To(Equal(10.0))
+		})
+
+		It("accepts a threshold override", func() {
+			resp, err := http.Get(usageServer.URL + "/rightsizing?threshold=60")
+			Expect(err).To(Succeed())
+
+			bytes, err := ioutil.ReadAll(resp.Body)
+			Expect(err).To(Succeed())
+			defer resp.Body.Close()
+
+			var candidates []applist.RightSizingCandidate
+			err = json.Unmarshal(bytes, &candidates)
+			Expect(err).To(Succeed())
+
+			Expect(candidates).To(HaveLen(2))
+		})
+
+		It("rejects an invalid threshold", func() {
+			resp, err := http.Get(usageServer.URL + "/rightsizing?threshold=lots")
+			Expect(err).To(Succeed())
+			Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+		})
+	})
+
+	Describe("/api/check", func() {
+		BeforeEach(func() {
+			listApps := cfClient.ListAppsFunc
+			cfClient.ListAppsFunc = func() ([]gocf.App, error) {
+				apps, err := listApps()
+				apps[0].DetectedBuildpackGuid = "44444" // the latest ruby buildpack
+				return apps, err
+			}
+		})
+
+		check := func(resp *http.Response) []applist.CheckResult {
+			bytes, err := ioutil.ReadAll(resp.Body)
+			Expect(err).To(Succeed())
+			defer resp.Body.Close()
+
+			var results []applist.CheckResult
+			Expect(json.Unmarshal(bytes, &results)).To(Succeed())
+			return results
+		}
+
+		It("passes an app that is neither stale nor deprecated", func() {
+			resp, err := http.Get(server.URL + "/api/check?foundation=dev&org=project-x&space=dev&app=app1")
+			Expect(err).To(Succeed())
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+			bytes, err := ioutil.ReadAll(resp.Body)
+			Expect(err).To(Succeed())
+			var result applist.CheckResult
+			Expect(json.Unmarshal(bytes, &result)).To(Succeed())
+			Expect(result.Pass).To(BeTrue())
+		})
+
+		It("fails a stale app with 412 Precondition Failed and the reasons", func() {
+			resp, err := http.Get(server.URL + "/api/check?foundation=dev&org=project-x&space=dev&app=app2")
+			Expect(err).To(Succeed())
+			Expect(resp.StatusCode).To(Equal(http.StatusPreconditionFailed))
+
+			bytes, err := ioutil.ReadAll(resp.Body)
+			Expect(err).To(Succeed())
+			var result applist.CheckResult
+			Expect(json.Unmarshal(bytes, &result)).To(Succeed())
+			Expect(result.Pass).To(BeFalse())
+			Expect(result.Reasons).To(ContainElement("app was last updated on 2016-07-19, more than 14 days ago"))
+		})
+
+		It("returns 404 Not Found for an unknown app", func() {
+			resp, err := http.Get(server.URL + "/api/check?foundation=dev&org=project-x&space=dev&app=missing")
+			Expect(err).To(Succeed())
+			Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+		})
+
+		It("requires the foundation, org, space and app", func() {
+			resp, err := http.Get(server.URL + "/api/check?app=app1")
+			Expect(err).To(Succeed())
+			Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+		})
+
+		It("checks a batch of apps, failing if any of them fails", func() {
+			body := `[
+				{"foundation": "dev", "org": "project-x", "space": "dev", "app": "app1"},
+				{"foundation": "dev", "org": "project-x", "space": "test", "app": "app3"}
+			]`
+			resp, err := http.Post(server.URL+"/api/check", "application/json", strings.NewReader(body))
+			Expect(err).To(Succeed())
+			Expect(resp.StatusCode).To(Equal(http.StatusPreconditionFailed))
+
+			results := check(resp)
+			Expect(results).To(HaveLen(2))
+			Expect(results[0].App).To(Equal("app1"))
+			Expect(results[0].Pass).To(BeTrue())
+			Expect(results[1].App).To(Equal("app3"))
+			Expect(results[1].Pass).To(BeFalse())
+		})
+
+		It("rejects a batch that is not a list of apps", func() {
+			resp, err := http.Post(server.URL+"/api/check", "application/json", strings.NewReader(`{"app": "app1"}`))
+			Expect(err).To(Succeed())
+			Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+		})
+	})
+
+	Describe("Per-user visibility", func() {
+		var visibilityServer *httptest.Server
+		var visibility VisibilityOptions
+		var user auth.User
+
+		JustBeforeEach(func() {
+			config := Config{AppList: applist.Options{Capacity: true}, Visibility: visibility}
+			router := newRouter(timeNow, config)
+			visibilityServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				router.ServeHTTP(w, r.WithContext(auth.WithUser(r.Context(), user)))
+			}))
+			servers = append(servers, visibilityServer)
+		})
+
+		listApps := func() applist.AppData {
+			resp, err := http.Get(visibilityServer.URL + "/listapps")
+			Expect(err).To(Succeed())
+
+			bytes, err := ioutil.ReadAll(resp.Body)
+			Expect(err).To(Succeed())
+			defer resp.Body.Close()
+
+			var appData applist.AppData
+			Expect(json.Unmarshal(bytes, &appData)).To(Succeed())
+			return appData
+		}
+
+		Context("When visibility follows Cloud Foundry roles", func() {
+			BeforeEach(func() {
+				visibility = VisibilityOptions{Mode: VisibilityRoles, AdminUsers: []string{"admin"}}
+				user = auth.User{Subject: "user-guid", Name: "developer"}
+
+				cfClient.GetUserOrgsFunc = func(userGUID string) (map[string]gocf.Org, error) {
+					return map[string]gocf.Org{}, nil
+				}
+				cfClient.GetUserSpacesFunc = func(userGUID string) (map[string]gocf.Space, error) {
+					Expect(userGUID).To(Equal("user-guid"))
+					return map[string]gocf.Space{
+						"bbbbb": {Guid: "bbbbb", Name: "test", OrganizationGuid: "123123123"},
+					}, nil
+				}
+			})
+
+			It("only returns the apps in the spaces the user has a role in", func() {
+				appData := listApps()
+
+				Expect(appData.Apps).To(HaveLen(1))
+				Expect(appData.Apps[0].Name).To(Equal("app3"))
+				Expect(appData.Summary.TotalApps).To(Equal(1))
+			})
+
+			It("takes the names of the orgs from the scrape instead of listing them again", func() {
+				var orgLists int32
+				getOrgs := cfClient.GetOrgsFunc
+				cfClient.GetOrgsFunc = func() (map[string]gocf.Org, error) {
+					atomic.AddInt32(&orgLists, 1)
+					return getOrgs()
+				}
+
+				Expect(listApps().Apps).To(HaveLen(1))
+				Expect(atomic.LoadInt32(&orgLists)).To(Equal(int32(1)))
+			})
+
+			It("hides the capacity of orgs the user does not manage or audit", func() {
+				resp, err := http.Get(visibilityServer.URL + "/capacity")
+				Expect(err).To(Succeed())
+
+				bytes, err := ioutil.ReadAll(resp.Body)
+				Expect(err).To(Succeed())
+				defer resp.Body.Close()
+
+				var capacity applist.CapacityReport
+				Expect(json.Unmarshal(bytes, &capacity)).To(Succeed())
+				Expect(capacity.Orgs).To(BeEmpty())
+				Expect(capacity.Spaces).To(HaveLen(1))
+				Expect(capacity.Spaces[0].Space).To(Equal("test"))
+			})
+
+			Context("When the user manages the org", func() {
+				BeforeEach(func() {
+					cfClient.GetUserOrgsFunc = func(userGUID string) (map[string]gocf.Org, error) {
+						return map[string]gocf.Org{
+							"123123123": {Guid: "123123123", Name: "project-x"},
+						}, nil
+					}
+				})
+
+				It("returns every app in the org", func() {
+					Expect(listApps().Apps).To(HaveLen(3))
+				})
+			})
+
+			Context("When the user is an admin", func() {
+				BeforeEach(func() {
+					user = auth.User{Subject: "admin-guid", Name: "admin"}
+				})
+
+				It("returns every app", func() {
+					Expect(listApps().Apps).To(HaveLen(3))
+				})
+			})
+		})
+
+		Context("When visibility follows group membership", func() {
+			BeforeEach(func() {
+				visibility = VisibilityOptions{
+					Mode:   VisibilityGroups,
+					Groups: map[string][]string{"team-dev": {"dev/project-x/dev"}},
+				}
+				user = auth.User{Subject: "user-guid", Name: "developer", Groups: []string{"team-dev"}}
+			})
+
+			It("only returns the apps in the spaces mapped to the user's groups", func() {
+				appData := listApps()
+
+				Expect(appData.Apps).To(HaveLen(2))
+				Expect(appData.Apps[0].Space).To(Equal("dev"))
+				Expect(appData.Apps[1].Space).To(Equal("dev"))
+			})
+
+			It("only counts visible apps in the event stream", func() {
+				resp, err := http.Get(visibilityServer.URL + "/events")
+				Expect(err).To(Succeed())
+				defer resp.Body.Close()
+
+				listApps()
+
+				reader := bufio.NewReader(resp.Body)
+				_, err = reader.ReadString('\n')
+				Expect(err).To(Succeed())
+				line, err := reader.ReadString('\n')
+				Expect(err).To(Succeed())
+
+				var notification struct {
+					Summary applist.Summary
+				}
+				err = json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &notification)
+				Expect(err).To(Succeed())
+				Expect(notification.Summary.TotalApps).To(Equal(2))
+			})
+		})
+	})
+
 	AfterEach(func() {
-		server.Close()
+		for _, server := range servers {
+			server.Close()
+		}
+		servers = nil
+		for _, router := range routers {
+			router.Stop()
+		}
+		routers = nil
 	})
 })
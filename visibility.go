@@ -0,0 +1,209 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/FidelityInternational/cf-loupe/applist"
+	"github.com/FidelityInternational/cf-loupe/auth"
+	"github.com/FidelityInternational/cf-loupe/cf"
+)
+
+// Visibility modes
+const (
+	VisibilityRoles  = "roles"  // the org and space roles of the user in Cloud Foundry
+	VisibilityGroups = "groups" // a mapping of the user's groups to orgs and spaces
+)
+
+// The roles of a user are cached, for less time if a foundation could not be
+// asked so that it is soon asked again
+const (
+	visibilityCacheTTL = 5 * time.Minute
+	visibilityRetryTTL = 30 * time.Second
+)
+
+// VisibilityOptions configures which orgs and spaces each user can see
+type VisibilityOptions struct {
+	// Mode is roles or groups. Every user sees everything if it is empty.
+	Mode string
+
+	// Groups maps a group to the "foundation/org" and "foundation/org/space"
+	// keys its members can see in groups mode
+	Groups map[string][]string
+
+	// AdminUsers and AdminGroups see everything in both modes
+	AdminUsers  []string
+	AdminGroups []string
+}
+
+// Enabled returns true if users only see their own orgs and spaces
+func (options VisibilityOptions) Enabled() bool {
+	return options.Mode != ""
+}
+
+type cachedVisibility struct {
+	visibility applist.Visibility
+	expires    time.Time
+}
+
+// visibilityResolver works out what the user of a request can see
+type visibilityResolver struct {
+	options   VisibilityOptions
+	cfClients map[string]cf.IClient
+	timeNow   func() time.Time
+
+	mutex sync.Mutex
+	cache map[string]cachedVisibility
+	// orgNames are the org names of the last successful scrape, by
+	// foundation and org GUID
+	orgNames map[string]map[string]string
+}
+
+func newVisibilityResolver(options VisibilityOptions, cfClients map[string]cf.IClient, timeNow func() time.Time) *visibilityResolver {
+	return &visibilityResolver{
+		options:   options,
+		cfClients: cfClients,
+		timeNow:   timeNow,
+		cache:     map[string]cachedVisibility{},
+	}
+}
+
+// observe keeps the org names of each successful scrape, so that looking up
+// the roles of a user does not list the orgs again
+func (resolver *visibilityResolver) observe(appData applist.AppData, err error) {
+	if err != nil {
+		return
+	}
+
+	resolver.mutex.Lock()
+	resolver.orgNames = appData.OrgNames
+	resolver.mutex.Unlock()
+}
+
+// resolve returns the visibility of the user of a request. API tokens see
+// everything in their foundations, while requests without a user see nothing
+// when visibility is enabled.
+func (resolver *visibilityResolver) resolve(r *http.Request) applist.Visibility {
+	user, ok := auth.UserFromContext(r.Context())
+	if ok && len(user.Foundations) > 0 {
+		return resolver.userVisibility(user, ok).LimitToFoundations(user.Foundations)
+	}
+	return resolver.userVisibility(user, ok)
+}
+
+func (resolver *visibilityResolver) userVisibility(user auth.User, ok bool) applist.Visibility {
+	if !resolver.options.Enabled() || (ok && user.Token) {
+		return applist.FullVisibility()
+	}
+	if !ok {
+		return applist.NewVisibility()
+	}
+	if resolver.isAdmin(user) {
+		return applist.FullVisibility()
+	}
+
+	if resolver.options.Mode == VisibilityGroups {
+		return resolver.groupVisibility(user)
+	}
+
+	resolver.mutex.Lock()
+	cached, ok := resolver.cache[user.Subject]
+	resolver.mutex.Unlock()
+	if ok && resolver.timeNow().Before(cached.expires) {
+		return cached.visibility
+	}
+
+	visibility, complete := resolver.roleVisibility(user)
+	ttl := visibilityCacheTTL
+	if !complete {
+		ttl = visibilityRetryTTL
+	}
+
+	resolver.mutex.Lock()
+	resolver.cache[user.Subject] = cachedVisibility{
+		visibility: visibility,
+		expires:    resolver.timeNow().Add(ttl),
+	}
+	resolver.mutex.Unlock()
+	return visibility
+}
+
+func (resolver *visibilityResolver) isAdmin(user auth.User) bool {
+	for _, admin := range resolver.options.AdminUsers {
+		if admin == user.Name {
+			return true
+		}
+	}
+	for _, group := range user.Groups {
+		for _, admin := range resolver.options.AdminGroups {
+			if admin == group {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (resolver *visibilityResolver) groupVisibility(user auth.User) applist.Visibility {
+	visibility := applist.NewVisibility()
+	for _, group := range user.Groups {
+		for _, key := range resolver.options.Groups[group] {
+			parts := strings.SplitN(key, "/", 3)
+			if len(parts) == 3 {
+				visibility.AddSpace(parts[0], parts[1], parts[2])
+			} else if len(parts) == 2 {
+				visibility.AddOrg(parts[0], parts[1])
+			}
+		}
+	}
+	return visibility
+}
+
+// roleVisibility looks up the orgs the user manages or audits and the spaces
+// they have any role in. The subject of the user is their GUID in the UAA
+// they logged in with, so foundations with a different UAA will not know
+// them. The names of the orgs of their spaces are those of the last scrape.
+// complete is false if a foundation could not be asked or has not been
+// scraped yet.
+func (resolver *visibilityResolver) roleVisibility(user auth.User) (applist.Visibility, bool) {
+	visibility := applist.NewVisibility()
+	complete := true
+
+	resolver.mutex.Lock()
+	orgNames := resolver.orgNames
+	resolver.mutex.Unlock()
+
+	for foundation, cfClient := range resolver.cfClients {
+		orgs, ok := orgNames[foundation]
+		if !ok {
+			log.Printf("could not look up the roles of %s in %s as it has not been scraped yet\n", user.Name, foundation)
+			complete = false
+			continue
+		}
+
+		userOrgs, err := cfClient.GetUserOrgs(user.Subject)
+		if err != nil {
+			log.Printf("could not look up the orgs of %s in %s: %s\n", user.Name, foundation, err)
+			complete = false
+			continue
+		}
+		for _, org := range userOrgs {
+			visibility.AddOrg(foundation, org.Name)
+		}
+
+		userSpaces, err := cfClient.GetUserSpaces(user.Subject)
+		if err != nil {
+			log.Printf("could not look up the spaces of %s in %s: %s\n", user.Name, foundation, err)
+			complete = false
+			continue
+		}
+		for _, space := range userSpaces {
+			visibility.AddSpace(foundation, orgs[space.OrganizationGuid], space.Name)
+		}
+	}
+
+	return visibility, complete
+}